@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin guards handlers that expose per-visitor data. Requests must
+// send AdminToken as a bearer token, in X-Admin-Token, or as the admin_token
+// query param for pages opened directly in a browser. With no AdminToken
+// configured the wrapped endpoints are disabled entirely. Every attempt,
+// allowed or not, goes to the audit logger.
+func (pt *PixelTracker) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := pt.isAdmin(r)
+		pt.audit(r, allowed)
+		if !allowed {
+			pt.httpError(w, r, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (pt *PixelTracker) isAdmin(r *http.Request) bool {
+	expected := pt.config().AdminToken
+	if expected == "" {
+		return false
+	}
+
+	token := r.Header.Get("X-Admin-Token")
+	if auth := r.Header.Get("Authorization"); token == "" && auth != "" {
+		token, _ = strings.CutPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		token = r.URL.Query().Get("admin_token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
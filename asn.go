@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+type ASNRecord struct {
+	Number       uint
+	Organization string
+}
+
+type ASNResolver interface {
+	LookupASN(ip net.IP) (ASNRecord, error)
+}
+
+// Autonomous systems operated by the major cloud and hosting providers.
+var datacenterASNs = map[uint]string{
+	16509:  "Amazon",
+	14618:  "Amazon",
+	15169:  "Google",
+	396982: "Google Cloud",
+	8075:   "Microsoft",
+	14061:  "DigitalOcean",
+	16276:  "OVH",
+	24940:  "Hetzner",
+	63949:  "Linode",
+	31898:  "Oracle",
+	45102:  "Alibaba",
+	20473:  "Vultr",
+}
+
+type maxMindASN struct {
+	reader *geoip2.Reader
+}
+
+// OpenASNDatabase opens a MaxMind GeoLite2-ASN database file.
+func OpenASNDatabase(path string) (ASNResolver, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &maxMindASN{reader: reader}, nil
+}
+
+func (m *maxMindASN) LookupASN(ip net.IP) (ASNRecord, error) {
+	record, err := m.reader.ASN(ip)
+	if err != nil {
+		return ASNRecord{}, err
+	}
+	return ASNRecord{
+		Number:       record.AutonomousSystemNumber,
+		Organization: record.AutonomousSystemOrganization,
+	}, nil
+}
+
+func (pt *PixelTracker) SetASNResolver(resolver ASNResolver) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.asnResolver = resolver
+}
+
+func (pt *PixelTracker) enrichASN(data *TrackingData, r *http.Request) {
+	pt.mu.RLock()
+	resolver := pt.asnResolver
+	pt.mu.RUnlock()
+	if resolver == nil {
+		return
+	}
+
+	ip := net.ParseIP(getClientIP(r))
+	if ip == nil {
+		return
+	}
+
+	record, err := resolver.LookupASN(ip)
+	if err != nil || record.Number == 0 {
+		return
+	}
+
+	data.Geo.ASN = record.Number
+	data.Geo.ASNOrg = record.Organization
+	_, data.Geo.Datacenter = datacenterASNs[record.Number]
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubASNResolver struct {
+	records map[string]ASNRecord
+}
+
+func (s *stubASNResolver) LookupASN(ip net.IP) (ASNRecord, error) {
+	record, ok := s.records[ip.String()]
+	if !ok {
+		return ASNRecord{}, errors.New("not found")
+	}
+	return record, nil
+}
+
+func TestEnrichASN(t *testing.T) {
+	tracker := NewPixelTracker()
+	tracker.SetASNResolver(&stubASNResolver{records: map[string]ASNRecord{
+		"3.5.140.2":   {Number: 16509, Organization: "AMAZON-02"},
+		"81.2.69.142": {Number: 5089, Organization: "Virgin Media Limited"},
+	}})
+
+	tests := []struct {
+		name               string
+		ip                 string
+		expectedASN        uint
+		expectedOrg        string
+		expectedDatacenter bool
+	}{
+		{"Cloud provider", "3.5.140.2", 16509, "AMAZON-02", true},
+		{"Residential ISP", "81.2.69.142", 5089, "Virgin Media Limited", false},
+		{"Unknown IP", "192.0.2.1", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = tt.ip + ":12345"
+
+			data := &TrackingData{}
+			tracker.enrich(data, req)
+
+			if data.Geo.ASN != tt.expectedASN {
+				t.Errorf("Expected ASN %d, got %d", tt.expectedASN, data.Geo.ASN)
+			}
+			if data.Geo.ASNOrg != tt.expectedOrg {
+				t.Errorf("Expected ASN org %q, got %q", tt.expectedOrg, data.Geo.ASNOrg)
+			}
+			if data.Geo.Datacenter != tt.expectedDatacenter {
+				t.Errorf("Expected datacenter %v, got %v", tt.expectedDatacenter, data.Geo.Datacenter)
+			}
+		})
+	}
+}
+
+func TestEnrichASNWithoutResolver(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+
+	data := &TrackingData{}
+	tracker.enrichASN(data, req)
+
+	if data.Geo.ASN != 0 || data.Geo.Datacenter {
+		t.Errorf("Expected no ASN data without a resolver, got %+v", data.Geo)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+const defaultAttributionWindow = 30 * 24 * time.Hour
+
+// defaultConversionEvents are the events treated as conversions when
+// ConversionEvents is unset.
+var defaultConversionEvents = []string{"conversion"}
+
+// Touch is the campaign a conversion is credited to: the utm_campaign,
+// utm_source and utm_medium params of the visitor's event that carried it.
+type Touch struct {
+	Campaign  string    `json:"campaign"`
+	Source    string    `json:"source,omitempty"`
+	Medium    string    `json:"medium,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type AttributedConversion struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Touch     *Touch    `json:"touch,omitempty"`
+}
+
+type AttributionReport struct {
+	Window       string                 `json:"window"`
+	Conversions  []AttributedConversion `json:"conversions"`
+	Campaigns    map[string]int         `json:"campaigns"`
+	Unattributed int                    `json:"unattributed"`
+}
+
+// Attribute credits each conversion to the most recent campaign touch by the
+// same visitor at most window before it (last-touch attribution).
+// Conversions without a visitor token or a touch in the window count as
+// unattributed.
+func Attribute(data []TrackingData, conversionEvents []string, window time.Duration) AttributionReport {
+	byToken := make(map[string][]TrackingData)
+	for _, event := range data {
+		if event.Token != "" {
+			byToken[event.Token] = append(byToken[event.Token], event)
+		}
+	}
+	for _, events := range byToken {
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Timestamp.Before(events[j].Timestamp)
+		})
+	}
+
+	report := AttributionReport{
+		Window:      window.String(),
+		Conversions: []AttributedConversion{},
+		Campaigns:   make(map[string]int),
+	}
+	for _, event := range data {
+		if !slices.Contains(conversionEvents, event.Event) {
+			continue
+		}
+		conversion := AttributedConversion{ID: event.ID, Event: event.Event, Timestamp: event.Timestamp}
+		if event.Token != "" {
+			conversion.Touch = lastTouch(byToken[event.Token], event, window)
+		}
+		if conversion.Touch != nil {
+			report.Campaigns[conversion.Touch.Campaign]++
+		} else {
+			report.Unattributed++
+		}
+		report.Conversions = append(report.Conversions, conversion)
+	}
+	return report
+}
+
+// lastTouch finds the latest campaign touch in journey, which is sorted
+// oldest first, within window before conversion. The conversion's own
+// params count, so a campaign link that converts directly is credited.
+func lastTouch(journey []TrackingData, conversion TrackingData, window time.Duration) *Touch {
+	cutoff := conversion.Timestamp.Add(-window)
+	for i := len(journey) - 1; i >= 0; i-- {
+		event := journey[i]
+		if event.Timestamp.After(conversion.Timestamp) {
+			continue
+		}
+		if event.Timestamp.Before(cutoff) {
+			return nil
+		}
+		if campaign := event.Query["utm_campaign"]; campaign != "" {
+			return &Touch{
+				Campaign:  campaign,
+				Source:    event.Query["utm_source"],
+				Medium:    event.Query["utm_medium"],
+				Timestamp: event.Timestamp,
+			}
+		}
+	}
+	return nil
+}
+
+// AttributionHandler serves last-touch attribution for ConversionEvents over
+// AttributionWindow, or the window param (e.g. ?window=168h).
+func (pt *PixelTracker) AttributionHandler(w http.ResponseWriter, r *http.Request) {
+	window := pt.config().AttributionWindow
+	if window <= 0 {
+		window = defaultAttributionWindow
+	}
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+	conversionEvents := pt.config().ConversionEvents
+	if len(conversionEvents) == 0 {
+		conversionEvents = defaultConversionEvents
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Attribute(pt.GetTrackingData(), conversionEvents, window))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAttribute(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	data := []TrackingData{
+		// Visitor a saw two campaigns, then converted 2 days after the second.
+		{Token: "a", Timestamp: start, Query: map[string]string{"utm_campaign": "spring", "utm_source": "news"}},
+		{Token: "a", Timestamp: start.Add(day), Query: map[string]string{"utm_campaign": "retarget", "utm_source": "ads", "utm_medium": "cpc"}},
+		{Token: "a", Timestamp: start.Add(2 * day), Path: "/pricing"},
+		{ID: "conv-a", Token: "a", Event: "purchase", Timestamp: start.Add(3 * day)},
+		// Visitor b converted 10 days after their only campaign touch.
+		{Token: "b", Timestamp: start, Query: map[string]string{"utm_campaign": "spring"}},
+		{ID: "conv-b", Token: "b", Event: "purchase", Timestamp: start.Add(10 * day)},
+		// Visitor c's campaign touch came after the conversion.
+		{ID: "conv-c", Token: "c", Event: "purchase", Timestamp: start},
+		{Token: "c", Timestamp: start.Add(day), Query: map[string]string{"utm_campaign": "late"}},
+	}
+
+	report := Attribute(data, []string{"purchase"}, 7*day)
+	if len(report.Conversions) != 3 {
+		t.Fatalf("Expected 3 conversions, got %d", len(report.Conversions))
+	}
+
+	inside := report.Conversions[0]
+	if inside.ID != "conv-a" || inside.Touch == nil {
+		t.Fatalf("Expected conv-a attributed, got %+v", inside)
+	}
+	if inside.Touch.Campaign != "retarget" || inside.Touch.Source != "ads" || inside.Touch.Medium != "cpc" {
+		t.Errorf("Expected last touch retarget/ads/cpc, got %+v", inside.Touch)
+	}
+	if outside := report.Conversions[1]; outside.Touch != nil {
+		t.Errorf("Expected conv-b outside the window unattributed, got %+v", outside.Touch)
+	}
+	if later := report.Conversions[2]; later.Touch != nil {
+		t.Errorf("Expected a touch after the conversion ignored, got %+v", later.Touch)
+	}
+	if report.Campaigns["retarget"] != 1 || report.Campaigns["spring"] != 0 || report.Unattributed != 2 {
+		t.Errorf("Unexpected totals: %v with %d unattributed", report.Campaigns, report.Unattributed)
+	}
+
+	// A longer window reaches visitor b's touch.
+	if wide := Attribute(data, []string{"purchase"}, 14*day); wide.Campaigns["spring"] != 1 {
+		t.Errorf("Expected spring credited with a 14 day window, got %v", wide.Campaigns)
+	}
+}
+
+func TestAttributionHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+	now := time.Now()
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Timestamp: now.Add(-time.Hour), Query: map[string]string{"utm_campaign": "spring"}})
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Event: "conversion", Timestamp: now})
+
+	rr := httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/stats/attribution", nil))
+	var report AttributionReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if report.Campaigns["spring"] != 1 || report.Window != defaultAttributionWindow.String() {
+		t.Errorf("Expected spring credited over the default window, got %+v", report)
+	}
+
+	rr = httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/stats/attribution?window=30m", nil))
+	report = AttributionReport{}
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	if report.Unattributed != 1 {
+		t.Errorf("Expected the touch outside a 30m window, got %+v", report)
+	}
+
+	rr = httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/stats/attribution?window=soon", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid window, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
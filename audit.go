@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// AuditEntry records one request to an admin endpoint, allowed or not.
+type AuditEntry struct {
+	Time    time.Time         `json:"time"`
+	IP      string            `json:"ip"`
+	Action  string            `json:"action"`
+	Params  map[string]string `json:"params,omitempty"`
+	Allowed bool              `json:"allowed"`
+}
+
+// AuditLogger receives an entry for every admin request.
+type AuditLogger interface {
+	LogAudit(entry AuditEntry)
+}
+
+// JSONAuditLogger writes audit entries as JSON lines.
+type JSONAuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONAuditLogger(w io.Writer) *JSONAuditLogger {
+	return &JSONAuditLogger{w: w}
+}
+
+func (l *JSONAuditLogger) LogAudit(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
+
+// SetAuditLogger records admin requests to logger; nil turns auditing off.
+func (pt *PixelTracker) SetAuditLogger(logger AuditLogger) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.auditLogger = logger
+}
+
+// audit records an admin request. The action is the method and route, e.g.
+// "GET /stats/{id}", and params are the route variables and query params,
+// minus the admin token. The IP is always the real client IP, even with
+// HashIP, since audits must identify the requester.
+func (pt *PixelTracker) audit(r *http.Request, allowed bool) {
+	pt.mu.RLock()
+	logger := pt.auditLogger
+	pt.mu.RUnlock()
+	if logger == nil {
+		return
+	}
+
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			path = template
+		}
+	}
+	params := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if key != "admin_token" && len(values) > 0 {
+			params[key] = values[0]
+		}
+	}
+	for key, value := range mux.Vars(r) {
+		params[key] = value
+	}
+
+	logger.LogAudit(AuditEntry{
+		Time:    time.Now(),
+		IP:      getClientIP(r),
+		Action:  r.Method + " " + path,
+		Params:  params,
+		Allowed: allowed,
+	})
+}
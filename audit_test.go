@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type recordingAuditLogger struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (l *recordingAuditLogger) LogAudit(entry AuditEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func TestAuditLog(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	tracker.Configure(config)
+	logger := &recordingAuditLogger{}
+	tracker.SetAuditLogger(logger)
+	router := tracker.Router()
+
+	req := httptest.NewRequest("GET", "/stats/journey?token=visitor-a&admin_token=secret", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/stats/abc123", nil)
+	req.RemoteAddr = "198.51.100.9:4321"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(logger.entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d", len(logger.entries))
+	}
+	entry := logger.entries[0]
+	if entry.Action != "GET /stats/journey" || entry.IP != "203.0.113.7" || !entry.Allowed {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+	if entry.Params["token"] != "visitor-a" {
+		t.Errorf("Expected the token param recorded, got %v", entry.Params)
+	}
+	if _, ok := entry.Params["admin_token"]; ok {
+		t.Error("Expected the admin token left out of the audit log")
+	}
+	if entry.Time.IsZero() {
+		t.Error("Expected a timestamp")
+	}
+
+	denied := logger.entries[1]
+	if denied.Action != "GET /stats/{id}" || denied.Params["id"] != "abc123" || denied.Allowed {
+		t.Errorf("Expected a denied event lookup, got %+v", denied)
+	}
+}
+
+func TestJSONAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONAuditLogger(&buf)
+	logger.LogAudit(AuditEntry{IP: "203.0.113.7", Action: "GET /dashboard", Allowed: true})
+
+	var entry AuditEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", buf.String(), err)
+	}
+	if entry.Action != "GET /dashboard" || entry.IP != "203.0.113.7" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
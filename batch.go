@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultMaxBodyBytes caps request bodies after decompression.
+const defaultMaxBodyBytes = 1 << 20
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+func (pt *PixelTracker) maxBodyBytes() int64 {
+	if pt.config().MaxBodyBytes > 0 {
+		return pt.config().MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// readBody reads the request body, transparently decompressing gzip and
+// deflate. The limit applies to the decompressed size so a small compressed
+// body can't expand without bound.
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	var body io.Reader = r.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	case "deflate":
+		zr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deflate body: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+// decodeBatch accepts either a single JSON object or an array of them.
+func decodeBatch(body []byte) ([]map[string]any, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		var event map[string]any
+		if err := json.Unmarshal(body, &event); err != nil {
+			return nil, err
+		}
+		return []map[string]any{event}, nil
+	}
+
+	var events []map[string]any
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// BatchHandler accepts JSON events posted by SDKs and sendBeacon. Each event
+// becomes its own TrackingData with the object as its Payload; an "event"
+// string field also sets Event. The batch is validated against EventSchema
+// as a whole and rejected with 422 if any event fails. A batch repeating an
+// Idempotency-Key within IdempotencyWindow is acknowledged without storing.
+// RespectDNT and the consent settings apply as they do to the pixel, with
+// refused batches acknowledged as {"accepted":0}. Processing takes a
+// MaxConcurrent slot like the pixel does.
+func (pt *PixelTracker) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := pt.requestTenant(r)
+	if !ok {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := readBody(r, pt.maxBodyBytes())
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, errBodyTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := decodeBatch(body)
+	if err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var errs []FieldError
+	for i, event := range events {
+		for _, fe := range pt.config().EventSchema.Validate(event) {
+			fe.Field = fmt.Sprintf("[%d].%s", i, fe.Field)
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if reason := pt.suppressionReason(r); reason != "" {
+		if reason == "consent" && pt.config().RecordWithoutConsent {
+			for _, event := range events {
+				name, _ := event["event"].(string)
+				data := consentlessEvent(r, name)
+				data.Tenant = tenant
+				pt.storeAndDispatch(data)
+			}
+		}
+		if pt.config().SuppressedContentType != "" {
+			pt.writeSuppressed(w, r)
+			return
+		}
+		writeAccepted(w, 0)
+		return
+	}
+
+	token, _, _ := pt.trackerCookie(r)
+	if pt.skipRecording(r, token) {
+		writeAccepted(w, len(events))
+		return
+	}
+
+	// The slot is taken before the Idempotency-Key is remembered, so a batch
+	// turned away with 503 can be retried under the same key.
+	slots, enrich := pt.acquireSlot()
+	if !enrich {
+		atomic.AddInt64(&pt.overloaded, 1)
+		if pt.config().RejectOverload {
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	defer releaseSlot(slots)
+
+	if pt.replayedRequest(w, r, tenant) {
+		writeAccepted(w, len(events))
+		return
+	}
+
+	ctx := pt.withRequestContext(context.Background(), r, body)
+	for _, event := range events {
+		var data *TrackingData
+		if enrich {
+			data = pt.buildTrackingData(r, token)
+		} else {
+			// Over MaxConcurrent the events are stored as recordOverloaded
+			// stores a pixel: without enrichment.
+			data = pt.newTrackingData(r, token)
+			data.Overloaded = true
+		}
+		data.Payload = event
+		data.Tenant = tenant
+		if name, ok := event["event"].(string); ok {
+			data.Event = name
+		}
+		pt.storeAndDispatchContext(ctx, data)
+	}
+	writeAccepted(w, len(events))
+}
+
+func writeAccepted(w http.ResponseWriter, accepted int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"accepted": accepted})
+}
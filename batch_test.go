@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip write failed: %v", err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestBatchHandler(t *testing.T) {
+	batch := []byte(`[{"event":"signup","value":1},{"event":"purchase","value":42.5}]`)
+
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write(batch)
+	zw.Close()
+
+	tests := []struct {
+		name           string
+		encoding       string
+		body           []byte
+		expectedStatus int
+		expectedStored int
+	}{
+		{"Plain JSON", "", batch, http.StatusAccepted, 2},
+		{"Gzipped batch", "gzip", gzipBytes(t, batch), http.StatusAccepted, 2},
+		{"Deflated batch", "deflate", deflated.Bytes(), http.StatusAccepted, 2},
+		{"Single object", "", []byte(`{"event":"view"}`), http.StatusAccepted, 1},
+		{"Decompression bomb", "gzip", gzipBytes(t, []byte(`[{"pad":"`+strings.Repeat("a", 4096)+`"}]`)), http.StatusRequestEntityTooLarge, 0},
+		{"Unsupported encoding", "br", batch, http.StatusUnsupportedMediaType, 0},
+		{"Corrupt gzip", "gzip", []byte("not gzip"), http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.MaxBodyBytes = 1024
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("POST", "/batch", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rr := httptest.NewRecorder()
+			tracker.BatchHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			data := tracker.GetTrackingData()
+			if len(data) != tt.expectedStored {
+				t.Fatalf("Expected %d stored events, got %d", tt.expectedStored, len(data))
+			}
+			if tt.expectedStored == 2 && (data[1].Event != "purchase" || data[1].Payload["value"] != 42.5) {
+				t.Errorf("Expected second event to be the purchase payload, got %+v", data[1])
+			}
+		})
+	}
+}
+
+func TestBatchHandlerSchema(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EventSchema = EventSchema{"event": {Type: "string", Required: true}}
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"ok"},{"value":1}]`))
+	rr := httptest.NewRecorder()
+	tracker.BatchHandler(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	var body struct {
+		Errors []FieldError `json:"errors"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &body)
+	if len(body.Errors) != 1 || body.Errors[0].Field != "[1].event" {
+		t.Errorf("Expected an error for [1].event, got %+v", body.Errors)
+	}
+	if got := len(tracker.GetTrackingData()); got != 0 {
+		t.Errorf("Expected an invalid batch to store nothing, got %d events", got)
+	}
+}
+
+func TestBatchHandlerTenantKeys(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.TenantKeys = map[string]string{"key-acme": "acme", "key-globex": "globex"}
+	tracker.Configure(config)
+
+	tests := []struct {
+		name           string
+		header         string
+		target         string
+		expectedStatus int
+		expectedTenant string
+	}{
+		{"Header key", "key-acme", "/batch", http.StatusAccepted, "acme"},
+		{"Query key", "", "/batch?api_key=key-globex", http.StatusAccepted, "globex"},
+		{"Missing key", "", "/batch", http.StatusUnauthorized, ""},
+		{"Invalid key", "key-initech", "/batch", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(tracker.GetTrackingData())
+			req := httptest.NewRequest("POST", tt.target, strings.NewReader(`{"event":"signup"}`))
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			tracker.BatchHandler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			data := tracker.GetTrackingData()
+			if tt.expectedTenant == "" {
+				if len(data) != before {
+					t.Errorf("Expected nothing stored, got %d new events", len(data)-before)
+				}
+				return
+			}
+			if len(data) != before+1 || data[len(data)-1].Tenant != tt.expectedTenant {
+				t.Errorf("Expected one event for tenant %q, got %+v", tt.expectedTenant, data[before:])
+			}
+		})
+	}
+}
+
+func TestBatchHandlerMaxConcurrent(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxConcurrent = 1
+	config.RejectOverload = true
+	config.IdempotencyWindow = time.Minute
+	tracker.Configure(config)
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"signup"},{"event":"purchase"}]`))
+		req.Header.Set("Idempotency-Key", "batch-1")
+		rr := httptest.NewRecorder()
+		tracker.BatchHandler(rr, req)
+		return rr
+	}
+
+	// Hold the only slot, as a pixel being processed would.
+	slots, ok := tracker.acquireSlot()
+	if !ok {
+		t.Fatal("Expected to take the only slot")
+	}
+	if rr := post(); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with the cap saturated, got %d", rr.Code)
+	}
+	if got := len(tracker.GetTrackingData()); got != 0 {
+		t.Errorf("Expected nothing stored for a rejected batch, got %d", got)
+	}
+	if got := tracker.OverloadedRequests(); got != 1 {
+		t.Errorf("Expected 1 overloaded request, got %d", got)
+	}
+
+	// The rejected batch didn't use up its Idempotency-Key, so the retry
+	// is stored.
+	releaseSlot(slots)
+	if rr := post(); rr.Code != http.StatusAccepted || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the retry to be accepted, got %d", rr.Code)
+	}
+	data := tracker.GetTrackingData()
+	if len(data) != 2 || data[0].Overloaded {
+		t.Errorf("Expected 2 enriched events from the retry, got %+v", data)
+	}
+	// The batch gave its slot back.
+	slots, ok = tracker.acquireSlot()
+	if !ok {
+		t.Fatal("Expected the batch to release its slot")
+	}
+	releaseSlot(slots)
+
+	// Without RejectOverload the events are stored unenriched.
+	config.RejectOverload = false
+	config.IdempotencyWindow = 0
+	tracker.Configure(config)
+	slots, _ = tracker.acquireSlot()
+	defer releaseSlot(slots)
+	if rr := post(); rr.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 when serving overloaded batches, got %d", rr.Code)
+	}
+	data = tracker.GetTrackingData()
+	if len(data) != 4 || !data[2].Overloaded || !data[3].Overloaded {
+		t.Errorf("Expected 2 more events flagged overloaded, got %+v", data[2:])
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// botMarkers are lowercase substrings found in crawler, monitoring and
+// scripted-client user agents.
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "headlesschrome", "lighthouse",
+	"facebookexternalhit", "embedly", "preview", "curl/", "wget/",
+	"python-requests", "go-http-client", "java/", "okhttp",
+}
+
+// enrichBot flags events from clients whose user agent identifies them as a
+// bot. A missing user agent is not enough on its own, since some mail clients
+// strip it when fetching images.
+func enrichBot(data *TrackingData, r *http.Request) {
+	data.IsBot = isBotUserAgent(r.UserAgent())
+}
+
+func isBotUserAgent(userAgent string) bool {
+	lower := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTimeParam carries the milliseconds between navigation start and the
+// pixel firing, as measured by the page.
+const renderTimeParam = "rt"
+
+// enrichSynthetic is a best-effort heuristic on top of user agent checks:
+// a real browser takes a while to render a page before the pixel fires, so
+// a render time under MinRenderTime suggests a script fetching the pixel
+// directly. Clients can send any rt they like, so a missing or normal value
+// proves nothing.
+func (pt *PixelTracker) enrichSynthetic(data *TrackingData, r *http.Request) {
+	threshold := pt.config().MinRenderTime
+	if threshold <= 0 {
+		return
+	}
+	ms, err := strconv.Atoi(r.URL.Query().Get(renderTimeParam))
+	if err != nil || ms < 0 {
+		return
+	}
+	data.RenderTime = ms
+	data.LikelySynthetic = time.Duration(ms)*time.Millisecond < threshold
+}
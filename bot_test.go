@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsBotUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  bool
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", true},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"curl/8.4.0", true},
+		{"python-requests/2.31.0", true},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isBotUserAgent(tt.userAgent); got != tt.expected {
+			t.Errorf("isBotUserAgent(%q) = %v, want %v", tt.userAgent, got, tt.expected)
+		}
+	}
+}
+
+func TestEnrichSynthetic(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MinRenderTime = 200 * time.Millisecond
+	tracker.Configure(config)
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedFlag   bool
+		expectedRender int
+	}{
+		{"Instant load", "/pixel.gif?rt=15", true, 15},
+		{"Human render time", "/pixel.gif?rt=1800", false, 1800},
+		{"No render time", "/pixel.gif", false, 0},
+		{"Invalid render time", "/pixel.gif?rt=fast", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TrackingData{}
+			tracker.enrichSynthetic(data, httptest.NewRequest("GET", tt.target, nil))
+			if data.LikelySynthetic != tt.expectedFlag {
+				t.Errorf("Expected likely_synthetic %v, got %v", tt.expectedFlag, data.LikelySynthetic)
+			}
+			if data.RenderTime != tt.expectedRender {
+				t.Errorf("Expected render time %d, got %d", tt.expectedRender, data.RenderTime)
+			}
+		})
+	}
+}
+
+func TestCacheForBots(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheForBots  time.Duration
+		userAgent     string
+		expectedCache string
+	}{
+		{"Bot gets cacheable pixel", time.Hour, "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "public, max-age=3600"},
+		{"Human gets no-cache", time.Hour, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36", "no-cache, no-store, must-revalidate"},
+		{"Bot without CacheForBots", 0, "curl/8.4.0", "no-cache, no-store, must-revalidate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.CacheForBots = tt.cacheForBots
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+
+			if got := rr.Header().Get("Cache-Control"); got != tt.expectedCache {
+				t.Errorf("Expected Cache-Control %q, got %q", tt.expectedCache, got)
+			}
+			cacheable := tt.expectedCache != "no-cache, no-store, must-revalidate"
+			if cacheable {
+				if rr.Header().Get("Vary") != "User-Agent" || rr.Header().Get("Pragma") != "" {
+					t.Errorf("Expected Vary: User-Agent and no Pragma, got %v", rr.Header())
+				}
+			} else if rr.Header().Get("Pragma") != "no-cache" {
+				t.Errorf("Expected Pragma: no-cache, got %q", rr.Header().Get("Pragma"))
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+	// breakerPoll is how often wait checks back while another caller's
+	// trial call is in flight.
+	breakerPoll = 100 * time.Millisecond
+)
+
+// errBreakerOpen is returned instead of calling a downstream whose breaker
+// is open.
+var errBreakerOpen = errors.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// circuitBreaker stops calling a downstream that keeps failing. After
+// threshold consecutive failures it opens and rejects calls for cooldown,
+// then half-opens and lets one trial call through: success closes it,
+// failure opens it for another cooldown.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	skipped atomic.Int64
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow reports whether a call may go ahead, counting the ones it rejects.
+// Every allowed call must be followed by success or failure.
+func (b *circuitBreaker) allow() bool {
+	if b.tryAllow() {
+		return true
+	}
+	b.skipped.Add(1)
+	return false
+}
+
+// wait blocks until a call may go ahead, for callers such as the Kafka sink
+// that hold on to their work rather than skip it. It returns false if ctx
+// ends first.
+func (b *circuitBreaker) wait(ctx context.Context) bool {
+	for !b.tryAllow() {
+		select {
+		case <-time.After(b.retryIn()):
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (b *circuitBreaker) tryAllow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// A trial call is already in flight.
+		return false
+	}
+	return true
+}
+
+// retryIn is how long until the breaker may let a call through again.
+func (b *circuitBreaker) retryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen {
+		return max(b.openedAt.Add(b.cooldown).Sub(b.now()), breakerPoll)
+	}
+	return breakerPoll
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		log.Printf("Circuit breaker %q closed", b.name)
+	}
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		log.Printf("Circuit breaker %q open after %d consecutive failures, retrying in %v", b.name, b.failures, b.cooldown)
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State reports the breaker's state, moving an open breaker whose cooldown
+// has passed to half-open so it reads the same as the next call would see.
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+// newBreaker creates a breaker from BreakerThreshold and BreakerCooldown
+// and registers it for /metrics and /healthz.
+func (pt *PixelTracker) newBreaker(name string) *circuitBreaker {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	b := newCircuitBreaker(name, pt.config().BreakerThreshold, pt.config().BreakerCooldown)
+	pt.breakers = append(pt.breakers, b)
+	return b
+}
+
+func (pt *PixelTracker) circuitBreakers() []*circuitBreaker {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return append([]*circuitBreaker(nil), pt.breakers...)
+}
+
+// UseWithBreaker registers a named handler that calls a downstream service,
+// such as a webhook, behind a circuit breaker. After BreakerThreshold
+// consecutive errors the handler is skipped for BreakerCooldown, then one
+// event is let through to test whether the service has recovered.
+func (pt *PixelTracker) UseWithBreaker(name string, handler func(data *TrackingData) error) {
+	b := pt.newBreaker(name)
+	pt.UseNamed(name, func(data *TrackingData) {
+		if !b.allow() {
+			return
+		}
+		if err := handler(data); err != nil {
+			log.Printf("Handler %q failed: %v", name, err)
+			b.failure()
+			return
+		}
+		b.success()
+	})
+}
+
+func writeBreakerMetrics(w io.Writer, breakers []*circuitBreaker, openMetrics bool) {
+	fmt.Fprintln(w, "# HELP pixel_tracker_breaker_state Circuit breaker state: 0 closed, 1 half-open, 2 open.")
+	fmt.Fprintln(w, "# TYPE pixel_tracker_breaker_state gauge")
+	for _, b := range breakers {
+		fmt.Fprintf(w, "pixel_tracker_breaker_state{breaker=%q} %d\n", b.name, b.State())
+	}
+	writeCounterHeader(w, "pixel_tracker_breaker_skipped_total", "Calls skipped while a circuit breaker was open.", openMetrics)
+	for _, b := range breakers {
+		fmt.Fprintf(w, "pixel_tracker_breaker_skipped_total{breaker=%q} %d\n", b.name, b.skipped.Load())
+	}
+}
+
+// HealthHandler reports "ok", or "degraded" while any circuit breaker is
+// not closed, along with each breaker's state. It always answers 200: a
+// failing downstream is no reason to take the tracker out of rotation.
+func (pt *PixelTracker) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	status := "ok"
+	states := make(map[string]string)
+	for _, b := range pt.circuitBreakers() {
+		state := b.State()
+		if state != breakerClosed {
+			status = "degraded"
+		}
+		states[b.name] = state.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status   string            `json:"status"`
+		Breakers map[string]string `json:"breakers"`
+	}{status, states})
+}
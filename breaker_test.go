@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUseWithBreaker(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.BreakerThreshold = 3
+	config.BreakerCooldown = time.Minute
+	tracker.Configure(config)
+
+	calls := 0
+	failing := true
+	tracker.UseWithBreaker("webhook", func(data *TrackingData) error {
+		calls++
+		if failing {
+			return errors.New("webhook returned 502")
+		}
+		return nil
+	})
+	breaker := tracker.circuitBreakers()[0]
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+	}
+	if calls != 3 {
+		t.Errorf("Expected the breaker to open after 3 failures, got %d calls", calls)
+	}
+	if got := len(tracker.GetTrackingData()); got != 5 {
+		t.Errorf("Expected events to be stored while the breaker is open, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`pixel_tracker_breaker_state{breaker="webhook"} 2`,
+		`pixel_tracker_breaker_skipped_total{breaker="webhook"} 2`,
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+	if health := getHealth(t, tracker); health.Status != "degraded" || health.Breakers["webhook"] != "open" {
+		t.Errorf("Expected degraded health with the webhook open, got %+v", health)
+	}
+
+	// Once the cooldown has passed, a failing trial call reopens it.
+	now = now.Add(time.Minute)
+	if state := breaker.State(); state != breakerHalfOpen {
+		t.Errorf("Expected half-open after the cooldown, got %v", state)
+	}
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+	if calls != 4 {
+		t.Errorf("Expected one trial call after the cooldown, got %d calls", calls)
+	}
+
+	// A successful trial closes it again.
+	now = now.Add(time.Minute)
+	failing = false
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+	if calls != 6 {
+		t.Errorf("Expected calls to resume once the trial succeeded, got %d calls", calls)
+	}
+	if health := getHealth(t, tracker); health.Status != "ok" || health.Breakers["webhook"] != "closed" {
+		t.Errorf("Expected ok health with the webhook closed, got %+v", health)
+	}
+}
+
+func TestCircuitBreakerResetsOnSuccess(t *testing.T) {
+	breaker := newCircuitBreaker("webhook", 2, time.Minute)
+	for i := 0; i < 3; i++ {
+		breaker.allow()
+		breaker.failure()
+		breaker.allow()
+		breaker.success()
+	}
+	if state := breaker.State(); state != breakerClosed {
+		t.Errorf("Expected failures separated by successes to keep the breaker closed, got %v", state)
+	}
+}
+
+func TestS3ExportBreaker(t *testing.T) {
+	config := Config{S3Bucket: "archive", BreakerThreshold: 1, BreakerCooldown: time.Minute}
+	uploader := &mockUploader{failures: 1}
+	exporter := newS3Exporter(uploader, newCircuitBreaker("s3", config.BreakerThreshold, config.BreakerCooldown), config)
+	now := time.Now()
+	exporter.breaker.now = func() time.Time { return now }
+
+	exporter.add(&TrackingData{Path: "/a"})
+	if err := exporter.flush(context.Background(), now); err == nil {
+		t.Fatal("Expected the first flush to fail")
+	}
+	// The bucket is back, but uploads wait out the cooldown.
+	if err := exporter.flush(context.Background(), now); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("Expected errBreakerOpen while open, got %v", err)
+	}
+	if got := len(uploader.uploaded()); got != 0 {
+		t.Fatalf("Expected no uploads while open, got %d", got)
+	}
+
+	now = now.Add(time.Minute)
+	if err := exporter.flush(context.Background(), now); err != nil {
+		t.Fatalf("Expected the upload to resume after the cooldown, got %v", err)
+	}
+	if got := len(uploader.uploaded()); got != 1 {
+		t.Errorf("Expected the pending object to be uploaded, got %d", got)
+	}
+}
+
+func TestKafkaSinkBreaker(t *testing.T) {
+	producer := &mockProducer{failures: 2}
+	breaker := newCircuitBreaker("kafka", 2, 300*time.Millisecond)
+	sink := newKafkaSink(producer, breaker, "pixel-events", jsonCodec{}, 100)
+
+	// Two failures (100ms and 200ms backoff) open the breaker, which holds
+	// the retry until the cooldown has passed.
+	sink.publish(&TrackingData{Token: "visitor"})
+	time.Sleep(200 * time.Millisecond)
+	if state := breaker.State(); state != breakerOpen {
+		t.Errorf("Expected the breaker to open, got %v", state)
+	}
+	producer.mu.Lock()
+	attempts := len(producer.batches)
+	producer.mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("Expected no writes while open, got %d attempts", attempts)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sink.published.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if published := sink.published.Load(); published != 1 {
+		t.Fatalf("Expected the event to be published after the cooldown, got %d", published)
+	}
+	if state := breaker.State(); state != breakerClosed {
+		t.Errorf("Expected the breaker to close, got %v", state)
+	}
+}
+
+type healthResponse struct {
+	Status   string            `json:"status"`
+	Breakers map[string]string `json:"breakers"`
+}
+
+func getHealth(t *testing.T, tracker *PixelTracker) healthResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != 200 {
+		t.Fatalf("Expected 200 from /healthz, got %d", rr.Code)
+	}
+	var health healthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Failed to decode /healthz: %v", err)
+	}
+	return health
+}
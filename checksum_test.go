@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEventChecksum(t *testing.T) {
+	event := TrackingData{
+		ID:        "evt-1",
+		Path:      "/pixel.gif",
+		Event:     "purchase",
+		Query:     map[string]string{"b": "2", "a": "1"},
+		Payload:   map[string]any{"value": 12.5},
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	first := EventChecksum(event, "secret")
+	if first == "" || first != EventChecksum(event, "secret") {
+		t.Fatalf("Expected a stable checksum, got %q", first)
+	}
+	if first == EventChecksum(event, "other") {
+		t.Error("Expected checksum to depend on the secret")
+	}
+
+	changed := event
+	changed.Path = "/other.gif"
+	if EventChecksum(changed, "secret") == first {
+		t.Error("Expected checksum to change when a field changes")
+	}
+
+	event.Checksum = first
+	if EventChecksum(event, "secret") != first {
+		t.Error("Expected checksum to ignore the Checksum field")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableChecksum = true
+	config.ChecksumSecret = "secret"
+	tracker.Configure(config)
+
+	tracker.storeAndDispatch(&TrackingData{
+		Path:    "/pixel.gif",
+		Event:   "purchase",
+		Query:   map[string]string{"order": "42"},
+		Payload: map[string]any{"value": 12.5},
+	})
+	stored := tracker.GetTrackingData()[0]
+	if stored.Checksum == "" {
+		t.Fatal("Expected stored event to have a checksum")
+	}
+
+	// Events sent to a webhook come back as JSON.
+	encoded, _ := json.Marshal(stored)
+	var replayed TrackingData
+	if err := json.Unmarshal(encoded, &replayed); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if !VerifyChecksum(replayed, "secret") {
+		t.Error("Expected untouched event to verify after a JSON round trip")
+	}
+
+	tampered := replayed
+	tampered.Query = map[string]string{"order": "43"}
+	if VerifyChecksum(tampered, "secret") {
+		t.Error("Expected tampered event to fail verification")
+	}
+	if VerifyChecksum(replayed, "wrong") {
+		t.Error("Expected verification with the wrong secret to fail")
+	}
+
+	replayed.Checksum = ""
+	if VerifyChecksum(replayed, "secret") {
+		t.Error("Expected event without a checksum to fail verification")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var brandPattern = regexp.MustCompile(`"([^"]*)"\s*;\s*v\s*=\s*"([^"]*)"`)
+
+// Known Sec-CH-UA brands in order of preference. Chromium is listed last
+// since every Chromium-based browser also reports it.
+var clientHintBrands = []struct {
+	brand string
+	name  string
+}{
+	{"Microsoft Edge", "Edge"},
+	{"Opera", "Opera"},
+	{"Google Chrome", "Chrome"},
+	{"Chromium", "Chrome"},
+}
+
+func detectBrowser(r *http.Request) BrowserInfo {
+	if info, ok := parseClientHints(r.Header); ok {
+		return info
+	}
+
+	info := parseUserAgent(r.UserAgent())
+	info.Platform, info.Mobile = parsePlatform(r.UserAgent())
+	info.Source = "user-agent"
+	return info
+}
+
+func parseClientHints(header http.Header) (BrowserInfo, bool) {
+	secCHUA := header.Get("Sec-CH-UA")
+	if secCHUA == "" {
+		return BrowserInfo{}, false
+	}
+
+	brands := make(map[string]string)
+	var other []string
+	for _, match := range brandPattern.FindAllStringSubmatch(secCHUA, -1) {
+		brand := strings.TrimSpace(match[1])
+		if isGreaseBrand(brand) {
+			continue
+		}
+		brands[brand] = match[2]
+		other = append(other, brand)
+	}
+
+	info := BrowserInfo{
+		Platform: strings.Trim(header.Get("Sec-CH-UA-Platform"), `"`),
+		Mobile:   header.Get("Sec-CH-UA-Mobile") == "?1",
+		Source:   "client-hints",
+	}
+
+	for _, known := range clientHintBrands {
+		if version, ok := brands[known.brand]; ok {
+			info.Browser = known.name
+			info.Version = version
+			return info, true
+		}
+	}
+
+	if len(other) > 0 {
+		info.Browser = other[0]
+		info.Version = brands[other[0]]
+		return info, true
+	}
+
+	return BrowserInfo{}, false
+}
+
+// GREASE brands like "Not)A;Brand" are randomized noise meant to keep
+// servers from depending on the exact brand list.
+func isGreaseBrand(brand string) bool {
+	return strings.Contains(brand, "Not") && strings.Contains(brand, "Brand")
+}
+
+func parsePlatform(userAgent string) (string, bool) {
+	mobile := strings.Contains(userAgent, "Mobi")
+
+	platformTests := []struct {
+		name     string
+		contains string
+	}{
+		{"Android", "Android"},
+		{"iOS", "iPhone"},
+		{"iOS", "iPad"},
+		{"Windows", "Windows"},
+		{"macOS", "Macintosh"},
+		{"Chrome OS", "CrOS"},
+		{"Linux", "Linux"},
+	}
+
+	for _, test := range platformTests {
+		if strings.Contains(userAgent, test.contains) {
+			return test.name, mobile
+		}
+	}
+
+	return "", mobile
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectBrowserClientHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected BrowserInfo
+	}{
+		{
+			name: "Chrome with hints",
+			headers: map[string]string{
+				"Sec-CH-UA":          `"Chromium";v="116", "Not)A;Brand";v="24", "Google Chrome";v="116"`,
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"Windows"`,
+				"User-Agent":         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/116.0.0.0 Safari/537.36",
+			},
+			expected: BrowserInfo{Browser: "Chrome", Version: "116", Platform: "Windows", Mobile: false, Source: "client-hints"},
+		},
+		{
+			name: "Edge with hints",
+			headers: map[string]string{
+				"Sec-CH-UA":          `"Microsoft Edge";v="117", "Not;A=Brand";v="8", "Chromium";v="117"`,
+				"Sec-CH-UA-Mobile":   "?0",
+				"Sec-CH-UA-Platform": `"macOS"`,
+			},
+			expected: BrowserInfo{Browser: "Edge", Version: "117", Platform: "macOS", Mobile: false, Source: "client-hints"},
+		},
+		{
+			name: "Mobile hints",
+			headers: map[string]string{
+				"Sec-CH-UA":          `"Google Chrome";v="116", "Chromium";v="116", "Not)A;Brand";v="24"`,
+				"Sec-CH-UA-Mobile":   "?1",
+				"Sec-CH-UA-Platform": `"Android"`,
+			},
+			expected: BrowserInfo{Browser: "Chrome", Version: "116", Platform: "Android", Mobile: true, Source: "client-hints"},
+		},
+		{
+			name: "Only GREASE brand falls back to user agent",
+			headers: map[string]string{
+				"Sec-CH-UA":  `"Not)A;Brand";v="24"`,
+				"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/118.0",
+			},
+			expected: BrowserInfo{Browser: "Firefox", Version: "118.0", Platform: "Windows", Mobile: false, Source: "user-agent"},
+		},
+		{
+			name: "User agent only",
+			headers: map[string]string{
+				"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			},
+			expected: BrowserInfo{Browser: "Safari", Version: "16.6", Platform: "iOS", Mobile: true, Source: "user-agent"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			result := detectBrowser(req)
+			if result != tt.expected {
+				t.Errorf("detectBrowser() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cloudflareCountry returns the ISO country code Cloudflare puts in
+// CF-IPCountry, or "" when it's missing or not a real country: "XX" means
+// unknown and "T1" marks Tor exit nodes.
+func cloudflareCountry(r *http.Request) string {
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get("CF-IPCountry")))
+	if len(country) != 2 || !isASCIILetters(country) || country == "XX" {
+		return ""
+	}
+	return country
+}
+
+// applyCloudflareCountry fills the country from CF-IPCountry when
+// CloudflareCountry is on. The GeoIP database wins when it has an answer
+// unless PreferCloudflareCountry is set.
+func (pt *PixelTracker) applyCloudflareCountry(geo *GeoInfo, r *http.Request) {
+	if !pt.config().CloudflareCountry {
+		return
+	}
+	if geo.Country != "" && !pt.config().PreferCloudflareCountry {
+		return
+	}
+	if country := cloudflareCountry(r); country != "" {
+		geo.Country = country
+		geo.CountrySource = "cloudflare"
+	}
+}
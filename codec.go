@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec serializes events for storage backends and sinks.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+func init() {
+	// Payload values decoded from JSON are stored behind interfaces.
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+}
+
+// NewCodec returns the codec registered under name. An empty name selects
+// JSON, which stays the default for readability.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case "", "json":
+		return jsonCodec{}, nil
+	case "gob":
+		return gobCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage codec %q", name)
+	}
+}
+
+func (pt *PixelTracker) storageCodec() (Codec, error) {
+	return NewCodec(pt.config().StorageCodec)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec is more compact than JSON for batches since field names are
+// written once per stream instead of once per event.
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
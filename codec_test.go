@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sampleEvents(n int) []TrackingData {
+	events := make([]TrackingData, n)
+	for i := range events {
+		events[i] = TrackingData{
+			Cookies:   map[string]string{"_tracker": "a3f5b8c912d4e6f8a1b2c3d4e5f6a7b8"},
+			Host:      "localhost:8080",
+			Path:      "/pixel.gif",
+			Referer:   "https://example.com/landing",
+			Params:    map[string]string{},
+			Query:     map[string]string{"campaign": "email", "id": fmt.Sprint(i)},
+			IP:        "203.0.113.1",
+			UserAgent: BrowserInfo{Browser: "Chrome", Version: "116", Platform: "Windows", Source: "client-hints"},
+			Language:  []string{"en-US", "en"},
+			Geo:       GeoInfo{IP: "203.0.113.1", Country: "US"},
+			Domain:    "localhost",
+			Token:     "a3f5b8c912d4e6f8a1b2c3d4e5f6a7b8",
+			Payload:   map[string]any{"event": "signup", "tags": []any{"a", "b"}},
+			Timestamp: time.Date(2023, 8, 26, 10, 30, 0, 0, time.UTC),
+		}
+	}
+	return events
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, name := range []string{"json", "gob"} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := NewCodec(name)
+			if err != nil {
+				t.Fatalf("NewCodec(%q) returned error: %v", name, err)
+			}
+			if codec.Name() != name {
+				t.Errorf("Expected codec name %q, got %q", name, codec.Name())
+			}
+
+			events := sampleEvents(3)
+			encoded, err := codec.Marshal(events)
+			if err != nil {
+				t.Fatalf("Marshal returned error: %v", err)
+			}
+
+			var decoded []TrackingData
+			if err := codec.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("Unmarshal returned error: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, events) {
+				t.Errorf("Round trip mismatch:\n got %+v\nwant %+v", decoded, events)
+			}
+		})
+	}
+}
+
+func TestNewCodecDefaultAndUnknown(t *testing.T) {
+	codec, err := NewCodec("")
+	if err != nil || codec.Name() != "json" {
+		t.Errorf("Expected JSON as the default codec, got %v (err %v)", codec, err)
+	}
+	if _, err := NewCodec("msgpack"); err == nil {
+		t.Error("Expected error for unknown codec")
+	}
+}
+
+func BenchmarkCodecSize(b *testing.B) {
+	events := sampleEvents(1000)
+	sizes := map[string]int{}
+
+	for _, name := range []string{"json", "gob"} {
+		codec, _ := NewCodec(name)
+		b.Run(name, func(b *testing.B) {
+			var encoded []byte
+			for i := 0; i < b.N; i++ {
+				encoded, _ = codec.Marshal(events)
+			}
+			sizes[name] = len(encoded)
+			b.ReportMetric(float64(len(encoded))/float64(len(events)), "bytes/event")
+		})
+	}
+
+	if sizes["gob"] >= sizes["json"] {
+		b.Errorf("Expected gob (%d bytes) to be smaller than JSON (%d bytes)", sizes["gob"], sizes["json"])
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cohortLayout is the cohort date format inside the cookie. Cohorts are
+// always UTC days so visitors near midnight land in the same cohort
+// regardless of server timezone.
+const (
+	cohortLayout  = "20060102"
+	cohortSigSize = 12
+)
+
+// cohortFor returns the cohort a visitor first seen at t belongs to.
+func cohortFor(t time.Time) string {
+	return t.UTC().Format(cohortLayout)
+}
+
+// trackerCookieValue is the cookie value for a new visitor. With cohorts on it
+// carries the first-seen date, signed so clients can't move themselves into
+// another cohort: "<token>.<yyyymmdd>.<signature>".
+func (pt *PixelTracker) trackerCookieValue(token string, now time.Time) string {
+	if !pt.config().EnableCohorts {
+		return token
+	}
+	payload := token + "." + cohortFor(now)
+	return payload + "." + pt.cohortSignature(payload)
+}
+
+// trackerCookie reads the visitor token and, when present and correctly
+// signed, the cohort from the tracking cookie. Plain cookies issued before
+// cohorts were enabled keep working with an empty cohort, and so do cohort
+// cookies that fail verification (e.g. after CookieSecret was rotated), so
+// the visitor keeps their token either way.
+func (pt *PixelTracker) trackerCookie(r *http.Request) (token, cohort string, ok bool) {
+	cookie, err := r.Cookie(pt.config().CookieName)
+	if err != nil {
+		return "", "", false
+	}
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return cookie.Value, "", true
+	}
+	payload := parts[0] + "." + parts[1]
+	expected := pt.cohortSignature(payload)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return parts[0], "", true
+	}
+	if _, err := time.Parse(cohortLayout, parts[1]); err != nil {
+		return parts[0], "", true
+	}
+	return parts[0], parts[1], true
+}
+
+// cohortSignature signs with CookieSecret, which Configure requires with
+// EnableCohorts so cookies verify across restarts and replicas.
+func (pt *PixelTracker) cohortSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(pt.config().CookieSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:cohortSigSize])
+}
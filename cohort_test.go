@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCohorts(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableCohorts = true
+	config.CookieSecret = "cohort-secret"
+	tracker.Configure(config)
+
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	today := time.Now().UTC().Format("20060102")
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("Expected a tracking cookie")
+	}
+	token, cohort, ok := strings.Cut(cookies[0].Value, ".")
+	if !ok || !strings.HasPrefix(cohort, today+".") {
+		t.Fatalf("Expected cookie to embed today's cohort, got %q", cookies[0].Value)
+	}
+
+	first := tracker.GetTrackingData()[0]
+	if first.Cohort != today || !first.NewVisitor {
+		t.Errorf("Expected first visit in cohort %s, got %q (new=%v)", today, first.Cohort, first.NewVisitor)
+	}
+	if first.Token != token {
+		t.Errorf("Expected token %q without the cohort suffix, got %q", token, first.Token)
+	}
+
+	// A returning visitor first seen on an earlier day.
+	earlier := tracker.trackerCookieValue("abc123", time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("PST", -8*3600)))
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: earlier})
+	returning := tracker.buildTrackingData(req, "abc123")
+	if returning.Cohort != "20240302" {
+		t.Errorf("Expected UTC cohort 20240302, got %q", returning.Cohort)
+	}
+	if returning.NewVisitor {
+		t.Error("Expected returning visitor not to be new")
+	}
+
+	// A tampered cohort date is ignored.
+	forged := strings.Replace(earlier, "20240302", "20230101", 1)
+	req = httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: forged})
+	if data := tracker.buildTrackingData(req, forged); data.Cohort != "" {
+		t.Errorf("Expected forged cohort to be rejected, got %q", data.Cohort)
+	}
+	if token, _, _ := tracker.trackerCookie(req); token != "abc123" {
+		t.Errorf("Expected forged cookie to keep token abc123, got %q", token)
+	}
+}
+
+func TestCohortsSecretRotated(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableCohorts = true
+	config.CookieSecret = "old-secret"
+	tracker.Configure(config)
+	issued := tracker.trackerCookieValue("abc123", time.Now())
+
+	config.CookieSecret = "new-secret"
+	tracker.Configure(config)
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: issued})
+
+	token, cohort, ok := tracker.trackerCookie(req)
+	if !ok || token != "abc123" || cohort != "" {
+		t.Errorf("Expected token abc123 without a cohort, got %q %q %v", token, cohort, ok)
+	}
+}
+
+func TestCohortsRequireSecret(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableCohorts = true
+	if err := tracker.Configure(config); err == nil {
+		t.Error("Expected Configure to reject EnableCohorts without CookieSecret")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultConsentCookie is checked when RequireConsent is on without a
+// ConsentCookie name.
+const defaultConsentCookie = "consent"
+
+// consentParam lets pages without the cookie (e.g. emails) pass consent in
+// the pixel URL instead.
+const consentParam = "consent"
+
+// suppressionReason says why a request must not be tracked, or "" if it may
+// be. With RespectDNT a DNT: 1 or Sec-GPC: 1 header opts out; with
+// RequireConsent or ConsentCookie set, the consent cookie or param must be
+// present and not a refusal.
+func (pt *PixelTracker) suppressionReason(r *http.Request) string {
+	if pt.config().RespectDNT {
+		if r.Header.Get("DNT") == "1" {
+			return "dnt"
+		}
+		if r.Header.Get("Sec-GPC") == "1" {
+			return "gpc"
+		}
+	}
+	if pt.config().RequireConsent || pt.config().ConsentCookie != "" {
+		if refusesConsent(pt.consentValue(r)) {
+			return "consent"
+		}
+	}
+	return ""
+}
+
+// consentValue prefers the consent cookie and falls back to the param.
+func (pt *PixelTracker) consentValue(r *http.Request) string {
+	name := pt.config().ConsentCookie
+	if name == "" {
+		name = defaultConsentCookie
+	}
+	if cookie, err := r.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return r.URL.Query().Get(consentParam)
+}
+
+func refusesConsent(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "0", "false", "no", "denied":
+		return true
+	}
+	return false
+}
+
+// suppressPixel answers a pixel request that must not be tracked, recording
+// a consentless event when RecordWithoutConsent allows it, and reports
+// whether it did. Every pixel route goes through it.
+func (pt *PixelTracker) suppressPixel(w http.ResponseWriter, r *http.Request, event string) bool {
+	reason := pt.suppressionReason(r)
+	if reason == "" {
+		return false
+	}
+	if reason == "consent" && pt.config().RecordWithoutConsent {
+		go pt.storeAndDispatch(consentlessEvent(r, event))
+	}
+	pt.writeSuppressed(w, r)
+	return true
+}
+
+// consentlessEvent is what can be kept without consent when
+// RecordWithoutConsent is on: the page and event, with no cookies, token,
+// IP or other enrichment.
+func consentlessEvent(r *http.Request, event string) *TrackingData {
+	now := time.Now()
+	return &TrackingData{
+		Host:        r.Host,
+		Path:        r.URL.Path,
+		Event:       event,
+		Timestamp:   now,
+		ReceivedAt:  now,
+		Consentless: true,
+	}
+}
+
+// writeSuppressed answers a request that won't be tracked: no cookie is set
+// and nothing is stored. It serves the pixel unless SuppressedContentType
+// asks for an acknowledgement body such as {"tracked":false}.
+func (pt *PixelTracker) writeSuppressed(w http.ResponseWriter, r *http.Request) {
+	if pt.config().SuppressedContentType == "" {
+		pixel := pt.setPixelHeaders(w, r)
+		w.Write(pixel.body)
+		return
+	}
+	w.Header().Set("Content-Type", pt.config().SuppressedContentType)
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Write([]byte(pt.config().SuppressedBody))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuppressedResponse(t *testing.T) {
+	reasons := []struct {
+		name    string
+		prepare func(req *http.Request)
+	}{
+		{"Do Not Track", func(req *http.Request) { req.Header.Set("DNT", "1") }},
+		{"Global Privacy Control", func(req *http.Request) { req.Header.Set("Sec-GPC", "1") }},
+		{"Missing consent cookie", func(req *http.Request) {}},
+		{"Refused consent", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "consent", Value: "no"}) }},
+	}
+	modes := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectedType string
+		expectedBody []byte
+	}{
+		{"Pixel", "", "", "image/gif", pixel1x1},
+		{"JSON ack", "application/json", `{"tracked":false}`, "application/json", []byte(`{"tracked":false}`)},
+	}
+
+	for _, mode := range modes {
+		for _, reason := range reasons {
+			t.Run(mode.name+"/"+reason.name, func(t *testing.T) {
+				tracker := NewPixelTracker()
+				config := *tracker.config()
+				config.RespectDNT = true
+				config.ConsentCookie = "consent"
+				config.SuppressedContentType = mode.contentType
+				config.SuppressedBody = mode.body
+				tracker.Configure(config)
+
+				req := httptest.NewRequest("GET", "/pixel.gif", nil)
+				reason.prepare(req)
+				rr := httptest.NewRecorder()
+				tracker.PixelHandler(rr, req)
+				time.Sleep(50 * time.Millisecond)
+
+				if contentType := rr.Header().Get("Content-Type"); contentType != mode.expectedType {
+					t.Errorf("Expected content type %q, got %q", mode.expectedType, contentType)
+				}
+				if !bytes.Equal(rr.Body.Bytes(), mode.expectedBody) {
+					t.Errorf("Expected body %q, got %q", mode.expectedBody, rr.Body.Bytes())
+				}
+				if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+					t.Errorf("Expected no tracking cookie, got %v", cookies)
+				}
+				if data := tracker.GetTrackingData(); len(data) != 0 {
+					t.Errorf("Expected nothing stored, got %d events", len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestConsentGiven(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RespectDNT = true
+	config.ConsentCookie = "consent"
+	config.SuppressedContentType = "application/json"
+	config.SuppressedBody = `{"tracked":false}`
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.AddCookie(&http.Cookie{Name: "consent", Value: "yes"})
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	time.Sleep(100 * time.Millisecond)
+
+	if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+		t.Errorf("Expected the pixel with consent, got %q", rr.Body.Bytes())
+	}
+	if data := tracker.GetTrackingData(); len(data) != 1 {
+		t.Errorf("Expected the consented request to be stored, got %d events", len(data))
+	}
+}
+
+func TestRequireConsent(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		cookie  string
+		tracked bool
+	}{
+		{"cookie present", "/pixel.gif", "granted", true},
+		{"param present", "/pixel.gif?consent=1", "", true},
+		{"absent", "/pixel.gif", "", false},
+		{"declined", "/pixel.gif", "denied", false},
+		{"declined cookie overrides param", "/pixel.gif?consent=1", "no", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.RequireConsent = true
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: defaultConsentCookie, Value: tt.cookie})
+			}
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+			time.Sleep(100 * time.Millisecond)
+
+			if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+				t.Errorf("Expected the pixel, got %q", rr.Body.Bytes())
+			}
+			stored := len(tracker.GetTrackingData()) == 1
+			if stored != tt.tracked {
+				t.Errorf("Expected tracked=%v, got %v", tt.tracked, stored)
+			}
+		})
+	}
+}
+
+func TestRecordWithoutConsent(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RequireConsent = true
+	config.RecordWithoutConsent = true
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "/pixel.gif?event=open", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	time.Sleep(100 * time.Millisecond)
+
+	if cookies := rr.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Expected no tracking cookie, got %v", cookies)
+	}
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected one consentless event, got %d", len(data))
+	}
+	event := data[0]
+	if !event.Consentless || event.Event != "open" || event.Path != "/pixel.gif" {
+		t.Errorf("Unexpected consentless event: %+v", event)
+	}
+	if event.Token != "" || event.IP != "" || event.UserAgent.Browser != "" {
+		t.Errorf("Expected no identifying fields, got %+v", event)
+	}
+}
+
+func TestConsentOnEveryRoute(t *testing.T) {
+	newTracker := func() *PixelTracker {
+		tracker := NewPixelTracker()
+		config := *tracker.config()
+		config.RequireConsent = true
+		config.RespectDNT = true
+		config.TrackNotFound = true
+		tracker.Configure(config)
+		return tracker
+	}
+
+	t.Run("Batch without consent", func(t *testing.T) {
+		tracker := newTracker()
+		req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"a"},{"event":"b"}]`))
+		rr := httptest.NewRecorder()
+		tracker.BatchHandler(rr, req)
+
+		if rr.Code != http.StatusAccepted || strings.TrimSpace(rr.Body.String()) != `{"accepted":0}` {
+			t.Errorf("Expected 202 {\"accepted\":0}, got %d %q", rr.Code, rr.Body.String())
+		}
+		if data := tracker.GetTrackingData(); len(data) != 0 {
+			t.Errorf("Expected nothing stored, got %d events", len(data))
+		}
+	})
+
+	t.Run("Batch with DNT", func(t *testing.T) {
+		tracker := newTracker()
+		req := httptest.NewRequest("POST", "/batch?consent=1", strings.NewReader(`{"event":"a"}`))
+		req.Header.Set("DNT", "1")
+		tracker.BatchHandler(httptest.NewRecorder(), req)
+		if data := tracker.GetTrackingData(); len(data) != 0 {
+			t.Errorf("Expected nothing stored, got %d events", len(data))
+		}
+	})
+
+	t.Run("Batch with consent", func(t *testing.T) {
+		tracker := newTracker()
+		req := httptest.NewRequest("POST", "/batch?consent=1", strings.NewReader(`{"event":"a"}`))
+		tracker.BatchHandler(httptest.NewRecorder(), req)
+		if data := tracker.GetTrackingData(); len(data) != 1 {
+			t.Errorf("Expected the consented event to be stored, got %d events", len(data))
+		}
+	})
+
+	t.Run("Batch recorded without consent", func(t *testing.T) {
+		tracker := newTracker()
+		config := *tracker.config()
+		config.RecordWithoutConsent = true
+		tracker.Configure(config)
+
+		req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"a"},{"event":"b"}]`))
+		tracker.BatchHandler(httptest.NewRecorder(), req)
+		data := tracker.GetTrackingData()
+		if len(data) != 2 {
+			t.Fatalf("Expected two consentless events, got %d", len(data))
+		}
+		for _, event := range data {
+			if !event.Consentless || event.Payload != nil || event.IP != "" {
+				t.Errorf("Expected a bare consentless event, got %+v", event)
+			}
+		}
+	})
+
+	t.Run("Unknown pixel path without consent", func(t *testing.T) {
+		tracker := newTracker()
+		rr := httptest.NewRecorder()
+		tracker.NotFoundHandler(rr, httptest.NewRequest("GET", "/campaigns/pixel.gif", nil))
+		time.Sleep(50 * time.Millisecond)
+
+		if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+			t.Errorf("Expected the pixel, got %q", rr.Body.Bytes())
+		}
+		if data := tracker.GetTrackingData(); len(data) != 0 {
+			t.Errorf("Expected nothing stored, got %d events", len(data))
+		}
+	})
+}
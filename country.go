@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// enrichCountryFallback guesses the country from the region subtag of the
+// primary language when no geo lookup produced one.
+func enrichCountryFallback(data *TrackingData, r *http.Request) {
+	if data.Geo.Country != "" {
+		return
+	}
+	if country := countryFromLanguage(data.Language); country != "" {
+		data.Geo.Country = country
+		data.Geo.CountryInferred = true
+		data.Geo.CountrySource = "language"
+	}
+}
+
+// enrichLanguageFallback fills in a language from LanguageByCountry when the
+// request sent no Accept-Language but the country is known, marking it
+// inferred. It only runs after the country fallback, so the two never feed
+// each other.
+func (pt *PixelTracker) enrichLanguageFallback(data *TrackingData, r *http.Request) {
+	if len(data.Language) > 0 || data.Geo.Country == "" {
+		return
+	}
+	if language := pt.config().LanguageByCountry[data.Geo.Country]; language != "" {
+		data.Language = []string{language}
+		data.LanguageInferred = true
+	}
+}
+
+func countryFromLanguage(languages []string) string {
+	if len(languages) == 0 {
+		return ""
+	}
+
+	subtags := strings.FieldsFunc(languages[0], func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	// Skip the language itself; script subtags are four letters and
+	// UN M.49 regions like "419" are numeric, neither is a country.
+	for _, subtag := range subtags[1:] {
+		if len(subtag) == 2 && isASCIILetters(subtag) {
+			return strings.ToUpper(subtag)
+		}
+	}
+	return ""
+}
+
+func isASCIILetters(s string) bool {
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCountryFromLanguage(t *testing.T) {
+	tests := []struct {
+		languages []string
+		expected  string
+	}{
+		{[]string{"en-GB", "en"}, "GB"},
+		{[]string{"pt-BR"}, "BR"},
+		{[]string{"fr"}, ""},
+		{[]string{"zh-Hant-TW"}, "TW"},
+		{[]string{"es-419"}, ""},
+		{[]string{"de_at"}, "AT"},
+		{[]string{}, ""},
+	}
+
+	for _, tt := range tests {
+		result := countryFromLanguage(tt.languages)
+		if result != tt.expected {
+			t.Errorf("countryFromLanguage(%v) = %q, want %q", tt.languages, result, tt.expected)
+		}
+	}
+}
+
+func TestEnrichCountryFallback(t *testing.T) {
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+
+	tests := []struct {
+		name             string
+		geo              GeoInfo
+		languages        []string
+		expectedCountry  string
+		expectedInferred bool
+	}{
+		{"Inferred from region", GeoInfo{}, []string{"en-GB"}, "GB", true},
+		{"No region", GeoInfo{}, []string{"fr"}, "", false},
+		{"Geo result wins", GeoInfo{Country: "US"}, []string{"en-GB"}, "US", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TrackingData{Geo: tt.geo, Language: tt.languages}
+			enrichCountryFallback(data, req)
+
+			if data.Geo.Country != tt.expectedCountry {
+				t.Errorf("Expected country %q, got %q", tt.expectedCountry, data.Geo.Country)
+			}
+			if data.Geo.CountryInferred != tt.expectedInferred {
+				t.Errorf("Expected inferred %v, got %v", tt.expectedInferred, data.Geo.CountryInferred)
+			}
+		})
+	}
+}
+
+func TestEnrichLanguageFallback(t *testing.T) {
+	tests := []struct {
+		name             string
+		acceptLanguage   string
+		country          string
+		expectedLanguage []string
+		expectedInferred bool
+	}{
+		{"Inferred from country", "", "JP", []string{"ja"}, true},
+		{"Accept-Language wins", "en-US,en;q=0.9", "JP", []string{"en-US", "en"}, false},
+		{"Country not mapped", "", "BR", []string{}, false},
+		{"No country", "", "", []string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.LanguageByCountry = map[string]string{"JP": "ja", "DE": "de"}
+			tracker.Configure(config)
+			tracker.SetGeoResolver(fixedGeoResolver(GeoRecord{Country: tt.country}))
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = "81.2.69.142:12345"
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			data := tracker.buildTrackingData(req, "")
+			if !slices.Equal(data.Language, tt.expectedLanguage) {
+				t.Errorf("Expected language %v, got %v", tt.expectedLanguage, data.Language)
+			}
+			if data.LanguageInferred != tt.expectedInferred {
+				t.Errorf("Expected inferred %v, got %v", tt.expectedInferred, data.LanguageInferred)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+	cursorMACSize    = 16
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type statsPage struct {
+	Data       []TrackingData `json:"data"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is where the next page starts: after the event with ID, which
+// was at Position (counting from 1) in insertion order when the page was
+// served.
+type pageCursor struct {
+	Position   int
+	ID         string
+	ReceivedAt time.Time
+}
+
+// encodeCursor packs c, signed so clients can't forge positions.
+func encodeCursor(key []byte, c pageCursor) string {
+	buf := make([]byte, 16, 16+len(c.ID)+cursorMACSize)
+	binary.BigEndian.PutUint64(buf[:8], uint64(c.Position))
+	binary.BigEndian.PutUint64(buf[8:], uint64(c.ReceivedAt.UnixNano()))
+	buf = append(buf, c.ID...)
+	buf = append(buf, cursorMAC(key, buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(key []byte, cursor string) (pageCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) < 16+cursorMACSize {
+		return pageCursor{}, errInvalidCursor
+	}
+	payload, mac := buf[:len(buf)-cursorMACSize], buf[len(buf)-cursorMACSize:]
+	if !hmac.Equal(mac, cursorMAC(key, payload)) {
+		return pageCursor{}, errInvalidCursor
+	}
+	return pageCursor{
+		Position:   int(binary.BigEndian.Uint64(payload[:8])),
+		ReceivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(payload[8:16]))),
+		ID:         string(payload[16:]),
+	}, nil
+}
+
+func cursorMAC(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:cursorMACSize]
+}
+
+func parsePageLimit(value string) (int, error) {
+	if value == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("invalid limit")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
+
+// errPageFull stops the scan once a page and the event after it are found.
+var errPageFull = errors.New("page full")
+
+// page returns up to limit events at or after since, resuming after the
+// event cursor was issued for. It streams the store rather than copying it.
+// Cursors for events without an ID resume at their insertion position. If
+// the cursor's event has since been removed, e.g. by retention, the page
+// starts at the first event received after it.
+func (pt *PixelTracker) page(cursor string, limit int, since time.Time) (statsPage, error) {
+	var after pageCursor
+	if cursor != "" {
+		var err error
+		if after, err = decodeCursor(pt.cursorSigningKey(), cursor); err != nil {
+			return statsPage{}, err
+		}
+	}
+
+	type positioned struct {
+		event    TrackingData
+		position int
+	}
+	var (
+		data     []positioned
+		fallback []positioned
+		resumed  = cursor == ""
+		position int
+		more     bool
+	)
+	err := pt.scan(func(event TrackingData) error {
+		position++
+		switch {
+		case resumed:
+		case after.ID != "":
+			if event.ID == after.ID {
+				resumed = true
+				fallback = nil
+				return nil
+			}
+			if event.ReceivedAt.After(after.ReceivedAt) && !event.Timestamp.Before(since) && len(fallback) <= limit {
+				fallback = append(fallback, positioned{event, position})
+			}
+			return nil
+		case position > after.Position:
+			resumed = true
+		default:
+			return nil
+		}
+
+		if event.Timestamp.Before(since) {
+			return nil
+		}
+		if len(data) == limit {
+			more = true
+			return errPageFull
+		}
+		data = append(data, positioned{event, position})
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return statsPage{}, err
+	}
+	if !resumed {
+		data = fallback
+		if more = len(data) > limit; more {
+			data = data[:limit]
+		}
+	}
+
+	page := statsPage{Data: make([]TrackingData, len(data))}
+	for i, p := range data {
+		page.Data[i] = p.event
+	}
+	if more {
+		last := data[len(data)-1]
+		page.NextCursor = encodeCursor(pt.cursorSigningKey(), pageCursor{last.position, last.event.ID, last.event.ReceivedAt})
+	}
+	return page, nil
+}
+
+// cursorSigningKey is CursorSecret, or a random per-process key when it is
+// unset, which invalidates cursors on restart and across replicas.
+func (pt *PixelTracker) cursorSigningKey() []byte {
+	if pt.config().CursorSecret != "" {
+		return []byte(pt.config().CursorSecret)
+	}
+	return pt.cursorKey
+}
+
+func (pt *PixelTracker) writePage(w http.ResponseWriter, r *http.Request, since time.Time) {
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := pt.page(r.URL.Query().Get("cursor"), limit, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(struct {
+		Data       any    `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}{pt.outputEvents(page.Data), page.NextCursor})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStatsCursorPagination(t *testing.T) {
+	tracker := NewPixelTracker()
+	start := time.Now().Add(-time.Hour)
+	addEvents := func(from, to int) {
+		for i := from; i < to; i++ {
+			tracker.dataStore.data = append(tracker.dataStore.data, TrackingData{
+				Query:     map[string]string{"id": fmt.Sprint(i)},
+				Timestamp: start.Add(time.Duration(i) * time.Second),
+			})
+		}
+	}
+	addEvents(0, 25)
+
+	seen := map[string]bool{}
+	order := []string{}
+	cursor := ""
+	pages := 0
+	for {
+		target := "/stats?limit=10"
+		if cursor != "" {
+			target += "&cursor=" + url.QueryEscape(cursor)
+		}
+		rr := httptest.NewRecorder()
+		tracker.StatsHandler(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var page statsPage
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Failed to unmarshal page: %v", err)
+		}
+		pages++
+
+		for _, event := range page.Data {
+			id := event.Query["id"]
+			if seen[id] {
+				t.Errorf("Event %s returned twice", id)
+			}
+			seen[id] = true
+			order = append(order, id)
+		}
+
+		// New data arriving mid-iteration must not disturb the walk.
+		if pages == 1 {
+			addEvents(25, 30)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+		if pages > 10 {
+			t.Fatal("Pagination did not terminate")
+		}
+	}
+
+	if len(order) != 30 {
+		t.Errorf("Expected 30 events across pages, got %d", len(order))
+	}
+	for i, id := range order {
+		if id != fmt.Sprint(i) {
+			t.Errorf("Expected event %d at position %d, got %s", i, i, id)
+			break
+		}
+	}
+	if pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", pages)
+	}
+}
+
+func TestDecodeCursorTampered(t *testing.T) {
+	key := []byte("secret")
+	cursor := encodeCursor(key, pageCursor{Position: 10, ID: "evt-10", ReceivedAt: time.Now()})
+
+	if c, err := decodeCursor(key, cursor); err != nil || c.Position != 10 || c.ID != "evt-10" {
+		t.Errorf("Expected valid cursor to decode to position 10 and ID evt-10, got %+v (err %v)", c, err)
+	}
+
+	forged := encodeCursor([]byte("other"), pageCursor{Position: 1000, ReceivedAt: time.Now()})
+	if _, err := decodeCursor(key, forged); err == nil {
+		t.Error("Expected cursor signed with another key to be rejected")
+	}
+	if _, err := decodeCursor(key, "garbage"); err == nil {
+		t.Error("Expected malformed cursor to be rejected")
+	}
+
+	tracker := NewPixelTracker()
+	rr := httptest.NewRecorder()
+	tracker.StatsHandler(rr, httptest.NewRequest("GET", "/stats?cursor="+url.QueryEscape(forged), nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for tampered cursor, got %d", rr.Code)
+	}
+}
+
+// statsPageAt fetches one /stats page of two events.
+func statsPageAt(t *testing.T, tracker *PixelTracker, cursor string) statsPage {
+	t.Helper()
+	target := "/stats?limit=2"
+	if cursor != "" {
+		target += "&cursor=" + url.QueryEscape(cursor)
+	}
+	rr := httptest.NewRecorder()
+	tracker.StatsHandler(rr, httptest.NewRequest("GET", target, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page statsPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to unmarshal page: %v", err)
+	}
+	return page
+}
+
+func pagePaths(page statsPage) []string {
+	paths := make([]string, len(page.Data))
+	for i, event := range page.Data {
+		paths[i] = event.Path
+	}
+	return paths
+}
+
+func TestStatsCursorResumesAfterExpiry(t *testing.T) {
+	tracker := NewPixelTracker()
+	now := time.Now()
+	// Client timestamps arrive out of order; insertion order is what pages
+	// follow.
+	offsets := []time.Duration{5, 1, 4, 2, 3, 0}
+	for i, offset := range offsets {
+		tracker.storeAndDispatch(&TrackingData{
+			Path:       fmt.Sprintf("/%d", i),
+			Timestamp:  now.Add(-offset * time.Minute),
+			ReceivedAt: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	first := statsPageAt(t, tracker, "")
+	if got := fmt.Sprint(pagePaths(first)); got != "[/0 /1]" {
+		t.Fatalf("Expected the first two events, got %s", got)
+	}
+
+	// Retention removes the oldest event, shifting every position.
+	tracker.dataStore.ExpireEvents(func(event TrackingData) bool { return event.Path == "/0" })
+	second := statsPageAt(t, tracker, first.NextCursor)
+	if got := fmt.Sprint(pagePaths(second)); got != "[/2 /3]" {
+		t.Fatalf("Expected to resume after /1, got %s", got)
+	}
+
+	// The cursor's own event is gone too: resume after its receive time.
+	tracker.dataStore.ExpireEvents(func(event TrackingData) bool { return event.Path == "/3" })
+	third := statsPageAt(t, tracker, second.NextCursor)
+	if got := fmt.Sprint(pagePaths(third)); got != "[/4 /5]" {
+		t.Errorf("Expected to resume at /4, got %s", got)
+	}
+	if third.NextCursor != "" {
+		t.Errorf("Expected no cursor on the last page, got %q", third.NextCursor)
+	}
+}
+
+func TestCursorSecret(t *testing.T) {
+	replica := func(secret string) *PixelTracker {
+		tracker := NewPixelTracker()
+		config := *tracker.config()
+		config.CursorSecret = secret
+		tracker.Configure(config)
+		for i := 0; i < 3; i++ {
+			tracker.dataStore.Append(TrackingData{ID: fmt.Sprintf("evt-%d", i), Path: fmt.Sprintf("/%d", i), Timestamp: time.Now()})
+		}
+		return tracker
+	}
+
+	cursor := statsPageAt(t, replica("shared"), "").NextCursor
+	if got := fmt.Sprint(pagePaths(statsPageAt(t, replica("shared"), cursor))); got != "[/2]" {
+		t.Errorf("Expected a replica with the same CursorSecret to accept the cursor, got %s", got)
+	}
+
+	rr := httptest.NewRecorder()
+	replica("").StatsHandler(rr, httptest.NewRequest("GET", "/stats?cursor="+url.QueryEscape(cursor), nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 from a tracker with its own key, got %d", rr.Code)
+	}
+}
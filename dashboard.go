@@ -0,0 +1,100 @@
+package main
+
+import "net/http"
+
+// serveDashboard renders summary charts client-side from /stats/summary so
+// the page needs no template data and refreshes without a reload.
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	html := `<!DOCTYPE html>
+<html>
+<head>
+    <title>Pixel Tracker Dashboard</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 40px; }
+        .container { max-width: 1000px; margin: 0 auto; }
+        h1 { color: #333; }
+        .totals { display: flex; gap: 20px; margin: 20px 0; }
+        .total { background: #f0f0f0; padding: 15px 20px; border-radius: 8px; }
+        .total span { display: block; font-size: 28px; font-weight: bold; }
+        .grid { display: grid; grid-template-columns: 1fr 1fr; gap: 30px; }
+        .bar { display: flex; align-items: center; margin: 4px 0; font-size: 13px; }
+        .bar .label { width: 160px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+        .bar .fill { background: #007bff; height: 14px; margin-right: 8px; }
+        #hours { display: flex; align-items: flex-end; height: 120px; gap: 2px; border-bottom: 1px solid #ddd; }
+        #hours div { background: #007bff; flex: 1; min-width: 3px; }
+        .error { color: red; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Pixel Tracker Dashboard</h1>
+        <div id="error" class="error"></div>
+
+        <div class="totals">
+            <div class="total">Total hits<span id="total">-</span></div>
+            <div class="total">Unique opens<span id="unique">-</span></div>
+            <div class="total">Bot hits<span id="bots">-</span></div>
+        </div>
+
+        <h2>Hits over time</h2>
+        <div id="hours"></div>
+
+        <div class="grid">
+            <div><h2>Top paths</h2><div id="paths"></div></div>
+            <div><h2>Browsers</h2><div id="browsers"></div></div>
+            <div><h2>Countries</h2><div id="countries"></div></div>
+        </div>
+    </div>
+
+    <script>
+    var refreshInterval = 10000;
+
+    function escapeHTML(s) {
+        var div = document.createElement('div');
+        div.textContent = s;
+        return div.innerHTML;
+    }
+
+    function renderBars(id, counts, limit) {
+        var entries = Object.entries(counts || {}).sort((a, b) => b[1] - a[1]).slice(0, limit);
+        var max = entries.length ? entries[0][1] : 1;
+        document.getElementById(id).innerHTML = entries.map(([label, count]) =>
+            '<div class="bar"><div class="label">' + escapeHTML(label) + '</div>' +
+            '<div class="fill" style="width:' + Math.round(200 * count / max) + 'px"></div>' + count + '</div>'
+        ).join('') || '<p>No data</p>';
+    }
+
+    function renderHours(counts) {
+        var entries = Object.entries(counts || {}).sort((a, b) => a[0].localeCompare(b[0]));
+        var max = Math.max(1, ...entries.map(e => e[1]));
+        document.getElementById('hours').innerHTML = entries.map(([hour, count]) =>
+            '<div title="' + escapeHTML(hour) + ': ' + count + '" style="height:' + (100 * count / max) + '%"></div>'
+        ).join('');
+    }
+
+    function refresh() {
+        fetch('/stats/summary')
+            .then(response => response.json())
+            .then(summary => {
+                document.getElementById('error').textContent = '';
+                document.getElementById('total').textContent = summary.total_opens;
+                document.getElementById('unique').textContent = summary.unique_opens;
+                document.getElementById('bots').textContent = summary.bot_hits;
+                renderHours(summary.hits_per_hour);
+                renderBars('paths', summary.paths, 10);
+                renderBars('browsers', summary.browsers, 10);
+                renderBars('countries', summary.countries, 20);
+            })
+            .catch(error => {
+                document.getElementById('error').textContent = 'Error loading summary: ' + error;
+            });
+    }
+
+    refresh();
+    setInterval(refresh, refreshInterval);
+    </script>
+</body>
+</html>`
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(html))
+}
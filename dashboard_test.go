@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	tracker.Configure(config)
+
+	handler := tracker.requireAdmin(serveDashboard)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/dashboard", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without admin token, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/dashboard?admin_token=secret", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d with admin token, got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/html" {
+		t.Errorf("Expected Content-Type text/html, got %q", ct)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "/stats/summary") {
+		t.Error("Expected dashboard to fetch /stats/summary")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxDedupKeys bounds how many distinct dedup keys are remembered
+// when MaxDedupKeys is unset.
+const defaultMaxDedupKeys = 100000
+
+// defaultDedupKeyFields treats repeat hits from the same visitor on the same
+// URL as duplicates.
+var defaultDedupKeyFields = []string{"token", "path", "query"}
+
+// dedupCache remembers when each key was last stored. Once maxKeys is
+// reached the least recently seen key is evicted, which at worst lets one
+// duplicate through.
+type dedupCache struct {
+	mu       sync.Mutex
+	window   time.Duration
+	seen     *lruCache[time.Time]
+	restored bool
+}
+
+func newDedupCache(window time.Duration, maxKeys int) *dedupCache {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxDedupKeys
+	}
+	return &dedupCache{
+		window: window,
+		seen:   newLRUCache[time.Time](maxKeys),
+	}
+}
+
+// duplicate reports whether key was already recorded within the window, and
+// records it if not. A duplicate does not extend the window.
+func (d *dedupCache) duplicate(key string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.seen.get(key); ok && now.Sub(last) < d.window {
+		return true
+	}
+	d.seen.set(key, now)
+	return false
+}
+
+// restore seeds the cache from events received since then, the first time
+// it is called, so keys recorded before a restart still count as seen.
+// Events are dated by ReceivedAt, as duplicate dates them, since Timestamp
+// may come from the client. The key is the one stamped at ingest: fields
+// such as query may have been dropped by MaxEventBytes since.
+func (d *dedupCache) restore(scan func(fn func(TrackingData) error) error, since time.Time, fields []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.restored {
+		return
+	}
+	d.restored = true
+	// Events come back in insertion order, so a later event's time wins.
+	err := scan(func(event TrackingData) error {
+		received := event.ReceivedAt
+		if received.IsZero() {
+			received = event.Timestamp
+		}
+		if received.Before(since) {
+			return nil
+		}
+		key := event.DedupKey
+		if key == "" {
+			key = hashDedupKey(dedupKey(&event, fields))
+		}
+		d.seen.set(key, received)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to restore dedup keys: %v", err)
+	}
+}
+
+func (d *dedupCache) cardinality() (keys int, evictions int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.seen.len(), d.seen.evictions
+}
+
+// dedupKey joins the named fields of an event. Supported fields are token
+// (alias cookie), ip, host, path, referer, event, browser, query (all query
+// params) and query.<name> for a single param such as query.message_id.
+// Unknown field names contribute nothing to the key.
+func dedupKey(data *TrackingData, fields []string) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+"="+dedupField(data, field))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// hashDedupKey shortens a key to what is kept in the cache and stamped on
+// events for PersistDedup.
+func hashDedupKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+func dedupField(data *TrackingData, field string) string {
+	if name, ok := strings.CutPrefix(field, "query."); ok {
+		return data.Query[name]
+	}
+
+	switch field {
+	case "token", "cookie":
+		return data.Token
+	case "ip":
+		if data.IP != "" {
+			return data.IP
+		}
+		return data.Geo.IP
+	case "host":
+		return data.Host
+	case "path":
+		return data.Path
+	case "referer":
+		return data.Referer
+	case "event":
+		return data.Event
+	case "browser":
+		return data.UserAgent.Browser
+	case "query":
+		keys := make([]string, 0, len(data.Query))
+		for key := range data.Query {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + "=" + data.Query[key]
+		}
+		return strings.Join(pairs, "&")
+	default:
+		return ""
+	}
+}
+
+// isDuplicate reports whether the event repeats one already stored within
+// DedupWindow.
+func (pt *PixelTracker) isDuplicate(data *TrackingData) bool {
+	pt.mu.RLock()
+	cache := pt.dedup
+	pt.mu.RUnlock()
+	if cache == nil {
+		return false
+	}
+
+	fields := pt.config().DedupKeyFields
+	if len(fields) == 0 {
+		fields = defaultDedupKeyFields
+	}
+	now := time.Now()
+	key := hashDedupKey(dedupKey(data, fields))
+	if pt.config().PersistDedup {
+		cache.restore(pt.scan, now.Add(-pt.config().DedupWindow), fields)
+		data.DedupKey = key
+	}
+	return cache.duplicate(key, now)
+}
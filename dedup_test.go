@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupKeyFields(t *testing.T) {
+	stream := []TrackingData{
+		{Token: "a", IP: "203.0.113.1", Path: "/pixel.gif", Query: map[string]string{"message_id": "m1", "campaign": "spring"}},
+		{Token: "b", IP: "203.0.113.1", Path: "/pixel.gif", Query: map[string]string{"message_id": "m1", "campaign": "spring"}},
+		{Token: "a", IP: "198.51.100.7", Path: "/pixel.gif", Query: map[string]string{"message_id": "m2", "campaign": "spring"}},
+		{Token: "c", IP: "203.0.113.1", Path: "/pixel.gif", Query: map[string]string{"message_id": "m3", "campaign": "spring"}},
+	}
+
+	tests := []struct {
+		name     string
+		fields   []string
+		expected int
+	}{
+		{
+			name:     "Email opens by message ID",
+			fields:   []string{"query.message_id"},
+			expected: 3,
+		},
+		{
+			name:     "Ad impressions by IP and campaign",
+			fields:   []string{"ip", "query.campaign"},
+			expected: 2,
+		},
+		{
+			name:     "Default cookie, path and query",
+			expected: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.DedupWindow = time.Minute
+			config.DedupKeyFields = tt.fields
+			tracker.Configure(config)
+
+			for _, event := range stream {
+				tracker.storeAndDispatch(&event)
+			}
+
+			if got := len(tracker.GetTrackingData()); got != tt.expected {
+				t.Errorf("Expected %d stored events, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDedupCacheWindow(t *testing.T) {
+	cache := newDedupCache(time.Minute, 0)
+	start := time.Now()
+
+	if cache.duplicate("k", start) {
+		t.Error("Expected first hit not to be a duplicate")
+	}
+	if !cache.duplicate("k", start.Add(30*time.Second)) {
+		t.Error("Expected repeat inside the window to be a duplicate")
+	}
+	if cache.duplicate("k", start.Add(time.Minute)) {
+		t.Error("Expected repeat after the window not to be a duplicate")
+	}
+}
+
+func TestPersistDedupAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	start := func(persist bool) *PixelTracker {
+		store, err := OpenFileStore(dir, PartitionNone, nil)
+		if err != nil {
+			t.Fatalf("OpenFileStore() returned error: %v", err)
+		}
+		tracker := NewPixelTracker()
+		config := *tracker.config()
+		config.DedupWindow = time.Minute
+		config.PersistDedup = persist
+		tracker.Configure(config)
+		tracker.SetStorage(store)
+		return tracker
+	}
+	hit := func() *TrackingData {
+		return &TrackingData{Token: "visitor", Path: "/pixel.gif", Query: map[string]string{"message_id": "m1"}, Timestamp: time.Now()}
+	}
+
+	first := start(true)
+	first.storeAndDispatch(hit())
+
+	restarted := start(true)
+	restarted.storeAndDispatch(hit())
+	if data := restarted.GetTrackingData(); len(data) != 1 {
+		t.Errorf("Expected the duplicate to be dropped after a restart, got %d events", len(data))
+	}
+
+	forgetful := start(false)
+	forgetful.storeAndDispatch(hit())
+	if data := forgetful.GetTrackingData(); len(data) != 2 {
+		t.Errorf("Expected the duplicate to slip through without PersistDedup, got %d events", len(data))
+	}
+}
+
+func TestPersistDedupRestoreByReceiveTime(t *testing.T) {
+	dir := t.TempDir()
+	start := func() *PixelTracker {
+		store, err := OpenFileStore(dir, PartitionNone, nil)
+		if err != nil {
+			t.Fatalf("OpenFileStore() returned error: %v", err)
+		}
+		tracker := NewPixelTracker()
+		config := *tracker.config()
+		config.DedupWindow = time.Minute
+		config.PersistDedup = true
+		tracker.Configure(config)
+		tracker.SetStorage(store)
+		return tracker
+	}
+	now := time.Now()
+
+	first := start()
+	// A client clock an hour slow, received just now.
+	first.storeAndDispatch(&TrackingData{Token: "slow-clock", Path: "/pixel.gif", Timestamp: now.Add(-time.Hour), ReceivedAt: now})
+	// A client clock an hour fast, received well outside the window.
+	first.storeAndDispatch(&TrackingData{Token: "fast-clock", Path: "/pixel.gif", Timestamp: now.Add(time.Hour), ReceivedAt: now.Add(-time.Hour)})
+
+	restarted := start()
+	restarted.storeAndDispatch(&TrackingData{Token: "slow-clock", Path: "/pixel.gif", Timestamp: now, ReceivedAt: now})
+	restarted.storeAndDispatch(&TrackingData{Token: "fast-clock", Path: "/pixel.gif", Timestamp: now, ReceivedAt: now})
+
+	counts := map[string]int{}
+	for _, event := range restarted.GetTrackingData() {
+		counts[event.Token]++
+	}
+	if counts["slow-clock"] != 1 {
+		t.Errorf("Expected the repeat of a recently received event to be dropped, got %d events", counts["slow-clock"])
+	}
+	if counts["fast-clock"] != 2 {
+		t.Errorf("Expected an event received outside the window not to be restored, got %d events", counts["fast-clock"])
+	}
+}
+
+func TestPersistDedupRestoreTruncatedEvent(t *testing.T) {
+	dir := t.TempDir()
+	start := func() *PixelTracker {
+		store, err := OpenFileStore(dir, PartitionNone, nil)
+		if err != nil {
+			t.Fatalf("OpenFileStore() returned error: %v", err)
+		}
+		tracker := NewPixelTracker()
+		config := *tracker.config()
+		config.DedupWindow = time.Minute
+		config.PersistDedup = true
+		config.MaxEventBytes = 600
+		tracker.Configure(config)
+		tracker.SetStorage(store)
+		return tracker
+	}
+	hit := func() *TrackingData {
+		return &TrackingData{Token: "visitor", Path: "/pixel.gif", Query: map[string]string{"message_id": "m1", "blob": strings.Repeat("x", 1000)}, Timestamp: time.Now(), ReceivedAt: time.Now()}
+	}
+
+	first := start()
+	first.storeAndDispatch(hit())
+	if stored := first.GetTrackingData(); len(stored) != 1 || stored[0].Query != nil {
+		t.Fatalf("Expected the stored event to lose its query, got %+v", stored)
+	}
+
+	restarted := start()
+	restarted.storeAndDispatch(hit())
+	if data := restarted.GetTrackingData(); len(data) != 1 {
+		t.Errorf("Expected the duplicate of a truncated event to be dropped after a restart, got %d events", len(data))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+// maxPixelSize caps requested dimensions so a single request can't make the
+// server encode an arbitrarily large image.
+const maxPixelSize = 256
+
+type PixelSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// requestedSize reads the w and h params. Missing or invalid values fall back
+// to 1 and larger values are clamped to maxPixelSize. It reports false when
+// neither param is present, in which case the static pixel is served.
+func requestedSize(r *http.Request) (PixelSize, bool) {
+	query := r.URL.Query()
+	if !query.Has("w") && !query.Has("h") {
+		return PixelSize{}, false
+	}
+	return PixelSize{
+		Width:  pixelDimension(query.Get("w")),
+		Height: pixelDimension(query.Get("h")),
+	}, true
+}
+
+func pixelDimension(raw string) int {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return min(n, maxPixelSize)
+}
+
+// sizedPixel renders a fully transparent PNG of the given size.
+func sizedPixel(size PixelSize) pixelImage {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, size.Width, size.Height)))
+	return pixelImage{"image/png", buf.Bytes()}
+}
+
+func enrichDimensions(data *TrackingData, r *http.Request) {
+	if size, ok := requestedSize(r); ok {
+		data.PixelSize = &size
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPixelDimensions(t *testing.T) {
+	tests := []struct {
+		name                string
+		query               string
+		expectedContentType string
+		expectedSize        *PixelSize
+	}{
+		{"Default 1x1", "", "image/gif", nil},
+		{"Custom size", "?w=120&h=60", "image/png", &PixelSize{Width: 120, Height: 60}},
+		{"Over cap is clamped", "?w=5000&h=300", "image/png", &PixelSize{Width: 256, Height: 256}},
+		{"Invalid falls back to 1", "?w=wide", "image/png", &PixelSize{Width: 1, Height: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif"+tt.query, nil))
+
+			if ct := rr.Header().Get("Content-Type"); ct != tt.expectedContentType {
+				t.Errorf("Expected content type %q, got %q", tt.expectedContentType, ct)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			data := tracker.GetTrackingData()
+			if len(data) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(data))
+			}
+
+			if tt.expectedSize == nil {
+				if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+					t.Error("Expected the static 1x1 GIF")
+				}
+				if data[0].PixelSize != nil {
+					t.Errorf("Expected no recorded size, got %+v", *data[0].PixelSize)
+				}
+				return
+			}
+
+			img, err := png.Decode(rr.Body)
+			if err != nil {
+				t.Fatalf("Failed to decode PNG: %v", err)
+			}
+			bounds := img.Bounds()
+			if bounds.Dx() != tt.expectedSize.Width || bounds.Dy() != tt.expectedSize.Height {
+				t.Errorf("Expected %dx%d image, got %dx%d", tt.expectedSize.Width, tt.expectedSize.Height, bounds.Dx(), bounds.Dy())
+			}
+			if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+				t.Errorf("Expected transparent pixel, got alpha %d", a)
+			}
+			if data[0].PixelSize == nil || *data[0].PixelSize != *tt.expectedSize {
+				t.Errorf("Expected recorded size %+v, got %+v", *tt.expectedSize, data[0].PixelSize)
+			}
+		})
+	}
+}
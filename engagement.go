@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type Engagement struct {
+	ScrollDepth int `json:"scroll_depth"`
+	TimeOnPage  int `json:"time_on_page"`
+}
+
+// enrichEngagement captures the scroll (percent) and time_on_page (seconds)
+// params sent by engagement beacons. Missing or invalid values count as zero.
+func enrichEngagement(data *TrackingData, r *http.Request) {
+	query := r.URL.Query()
+	if !query.Has("scroll") && !query.Has("time_on_page") {
+		return
+	}
+	data.Engagement = &Engagement{
+		ScrollDepth: min(engagementValue(query.Get("scroll")), 100),
+		TimeOnPage:  engagementValue(query.Get("time_on_page")),
+	}
+}
+
+func engagementValue(raw string) int {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+type PathEngagement struct {
+	Beacons        int     `json:"beacons"`
+	AvgScrollDepth float64 `json:"avg_scroll_depth"`
+	AvgTimeOnPage  float64 `json:"avg_time_on_page"`
+}
+
+// SummarizeEngagement averages engagement per path over the events that
+// carried engagement params.
+func SummarizeEngagement(data []TrackingData) map[string]PathEngagement {
+	type totals struct{ beacons, scroll, time int }
+	byPath := make(map[string]*totals)
+	for _, event := range data {
+		if event.Engagement == nil {
+			continue
+		}
+		t, ok := byPath[event.Path]
+		if !ok {
+			t = &totals{}
+			byPath[event.Path] = t
+		}
+		t.beacons++
+		t.scroll += event.Engagement.ScrollDepth
+		t.time += event.Engagement.TimeOnPage
+	}
+
+	rollup := make(map[string]PathEngagement, len(byPath))
+	for path, t := range byPath {
+		rollup[path] = PathEngagement{
+			Beacons:        t.beacons,
+			AvgScrollDepth: float64(t.scroll) / float64(t.beacons),
+			AvgTimeOnPage:  float64(t.time) / float64(t.beacons),
+		}
+	}
+	return rollup
+}
+
+func (pt *PixelTracker) EngagementHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SummarizeEngagement(pt.GetTrackingData()))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnrichEngagement(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected *Engagement
+	}{
+		{"Both params", "scroll=75&time_on_page=45", &Engagement{ScrollDepth: 75, TimeOnPage: 45}},
+		{"Scroll only", "scroll=50", &Engagement{ScrollDepth: 50}},
+		{"Invalid values", "scroll=lots&time_on_page=-3", &Engagement{}},
+		{"Scroll over 100 is clamped", "scroll=140&time_on_page=5", &Engagement{ScrollDepth: 100, TimeOnPage: 5}},
+		{"No engagement params", "campaign=email", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TrackingData{}
+			enrichEngagement(data, httptest.NewRequest("GET", "/pixel.gif?"+tt.query, nil))
+
+			if tt.expected == nil {
+				if data.Engagement != nil {
+					t.Errorf("Expected no engagement, got %+v", *data.Engagement)
+				}
+				return
+			}
+			if data.Engagement == nil || *data.Engagement != *tt.expected {
+				t.Errorf("Expected engagement %+v, got %+v", *tt.expected, data.Engagement)
+			}
+		})
+	}
+}
+
+func TestEngagementHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+	events := []TrackingData{
+		{Path: "/blog/a", Engagement: &Engagement{ScrollDepth: 50, TimeOnPage: 30}},
+		{Path: "/blog/a", Engagement: &Engagement{ScrollDepth: 100, TimeOnPage: 90}},
+		{Path: "/blog/b", Engagement: &Engagement{ScrollDepth: 25, TimeOnPage: 10}},
+		{Path: "/blog/a"},
+	}
+	for _, event := range events {
+		tracker.storeAndDispatch(&event)
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.EngagementHandler(rr, httptest.NewRequest("GET", "/stats/engagement", nil))
+
+	var rollup map[string]PathEngagement
+	if err := json.Unmarshal(rr.Body.Bytes(), &rollup); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	expected := map[string]PathEngagement{
+		"/blog/a": {Beacons: 2, AvgScrollDepth: 75, AvgTimeOnPage: 60},
+		"/blog/b": {Beacons: 1, AvgScrollDepth: 25, AvgTimeOnPage: 10},
+	}
+	if len(rollup) != len(expected) {
+		t.Fatalf("Expected %d paths, got %d", len(expected), len(rollup))
+	}
+	for path, want := range expected {
+		if got := rollup[path]; got != want {
+			t.Errorf("Path %s: expected %+v, got %+v", path, want, got)
+		}
+	}
+}
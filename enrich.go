@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Enricher fills in part of a TrackingData from the incoming request.
+type Enricher func(data *TrackingData, r *http.Request)
+
+type namedEnricher struct {
+	name string
+	fn   Enricher
+}
+
+func (pt *PixelTracker) defaultEnrichers() []namedEnricher {
+	return []namedEnricher{
+		{"referer", pt.enrichReferer},
+		{"ip", pt.enrichIP},
+		{"decay", enrichDecay},
+		{"useragent", enrichUserAgent},
+		{"bot", enrichBot},
+		{"synthetic", pt.enrichSynthetic},
+		{"language", enrichLanguage},
+		{"geo", pt.enrichGeo},
+		{"asn", pt.enrichASN},
+		{"timezone", pt.enrichTimezone},
+		{"country_fallback", enrichCountryFallback},
+		{"language_fallback", pt.enrichLanguageFallback},
+		{"domain", enrichDomain},
+		{"tls", enrichTLS},
+		{"proto", enrichProto},
+		{"network", pt.enrichNetwork},
+		{"fetch_meta", pt.enrichFetchMeta},
+		{"save_data", enrichSaveData},
+		{"cookie_blocked", pt.enrichCookieBlocked},
+		{"payload", pt.enrichPayload},
+		{"engagement", enrichEngagement},
+		{"dimensions", enrichDimensions},
+		{"timestamp", pt.enrichTimestamp},
+		{"headers", pt.enrichHeaders},
+	}
+}
+
+// AddEnricher appends an enricher to the pipeline, or replaces the one
+// already registered under the same name while keeping its position.
+func (pt *PixelTracker) AddEnricher(name string, fn Enricher) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	enrichers := make([]namedEnricher, 0, len(pt.enrichers)+1)
+	replaced := false
+	for _, e := range pt.enrichers {
+		if e.name == name {
+			e.fn = fn
+			replaced = true
+		}
+		enrichers = append(enrichers, e)
+	}
+	if !replaced {
+		enrichers = append(enrichers, namedEnricher{name, fn})
+	}
+	pt.enrichers = enrichers
+}
+
+func (pt *PixelTracker) RemoveEnricher(name string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	enrichers := make([]namedEnricher, 0, len(pt.enrichers))
+	for _, e := range pt.enrichers {
+		if e.name != name {
+			enrichers = append(enrichers, e)
+		}
+	}
+	pt.enrichers = enrichers
+}
+
+// SetEnricherOrder rebuilds the pipeline from the given names in order.
+// Registered enrichers that are not listed are dropped.
+func (pt *PixelTracker) SetEnricherOrder(names ...string) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	byName := make(map[string]namedEnricher, len(pt.enrichers))
+	for _, e := range pt.enrichers {
+		byName[e.name] = e
+	}
+
+	enrichers := make([]namedEnricher, 0, len(names))
+	for _, name := range names {
+		e, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown enricher %q", name)
+		}
+		enrichers = append(enrichers, e)
+	}
+	pt.enrichers = enrichers
+	return nil
+}
+
+func (pt *PixelTracker) Enrichers() []string {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	names := make([]string, len(pt.enrichers))
+	for i, e := range pt.enrichers {
+		names[i] = e.name
+	}
+	return names
+}
+
+func (pt *PixelTracker) enrich(data *TrackingData, r *http.Request) {
+	pt.mu.RLock()
+	enrichers := pt.enrichers
+	pt.mu.RUnlock()
+
+	if pt.config().RecordTimings {
+		data.Timings = make(map[string]time.Duration, len(enrichers))
+	}
+	features := pt.requestFeatures(r)
+	for _, e := range enrichers {
+		if features[featureSkipPrefix+e.name] {
+			continue
+		}
+		pt.runEnricher(e, data, r)
+	}
+}
+
+func (pt *PixelTracker) runEnricher(e namedEnricher, data *TrackingData, r *http.Request) {
+	_, span := pt.startSpan(r.Context(), "enrich."+e.name)
+	defer span.End()
+
+	if !pt.config().RecordTimings {
+		e.fn(data, r)
+		return
+	}
+
+	start := time.Now()
+	e.fn(data, r)
+	elapsed := time.Since(start)
+	data.Timings[e.name] = elapsed
+	pt.timings.observe(e.name, elapsed)
+}
+
+func (pt *PixelTracker) enrichReferer(data *TrackingData, r *http.Request) {
+	data.Origin = getOrigin(r)
+	data.Referer, data.RefererSource = resolveReferer(r, pt.config().RefererParam)
+	// A cross-site request without a Referer header usually means the
+	// embedding page's Referrer-Policy stripped it, not a direct visit. The
+	// Origin and query param fallbacks may still have filled in Referer.
+	data.RefererStripped = r.Header.Get("Referer") == "" && r.Header.Get("Sec-Fetch-Site") == "cross-site"
+	if pt.config().ParseReferer {
+		data.RefererInfo = parseRefererInfo(data.Referer)
+	}
+}
+
+func (pt *PixelTracker) enrichIP(data *TrackingData, r *http.Request) {
+	if pt.config().TrackIP {
+		data.IP = pt.storedIP(getClientIP(r))
+	}
+}
+
+func (pt *PixelTracker) enrichHeaders(data *TrackingData, r *http.Request) {
+	if len(pt.config().CaptureHeaders) > 0 {
+		data.Headers = extractHeaders(r, pt.config().CaptureHeaders)
+	}
+}
+
+func enrichDecay(data *TrackingData, r *http.Request) {
+	data.Decay = getDecay(r.URL.Query().Get("decay"))
+}
+
+func enrichUserAgent(data *TrackingData, r *http.Request) {
+	data.UserAgent = detectBrowser(r)
+}
+
+func enrichLanguage(data *TrackingData, r *http.Request) {
+	data.Language = parseLanguage(r.Header.Get("Accept-Language"))
+}
+
+func enrichDomain(data *TrackingData, r *http.Request) {
+	data.Domain = extractDomain(r.Host)
+}
+
+func enrichTLS(data *TrackingData, r *http.Request) {
+	data.TLS = extractTLSInfo(r)
+}
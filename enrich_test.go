@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultEnrichers(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	expected := []string{"referer", "ip", "decay", "useragent", "bot", "synthetic", "language", "geo", "asn", "timezone", "country_fallback", "language_fallback", "domain", "tls", "proto", "network", "fetch_meta", "save_data", "cookie_blocked", "payload", "engagement", "dimensions", "timestamp", "headers"}
+	if names := tracker.Enrichers(); !slicesEqual(names, expected) {
+		t.Errorf("Enrichers() = %v, want %v", names, expected)
+	}
+}
+
+func TestEnricherPipeline(t *testing.T) {
+	tracker := NewPixelTracker()
+	tracker.RemoveEnricher("geo")
+
+	var sawBrowser string
+	tracker.AddEnricher("internal_user", func(data *TrackingData, r *http.Request) {
+		sawBrowser = data.UserAgent.Browser
+		data.Query["internal_user"] = "user-" + r.URL.Query().Get("uid")
+	})
+
+	req := httptest.NewRequest("GET", "/pixel.gif?uid=42", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0")
+	req.Header.Set("Accept-Language", "en-US")
+
+	data := &TrackingData{Query: extractQueryParams(req)}
+	tracker.enrich(data, req)
+
+	if data.Geo.IP != "" {
+		t.Errorf("Expected geo enricher to be disabled, got geo IP %q", data.Geo.IP)
+	}
+	if data.Query["internal_user"] != "user-42" {
+		t.Errorf("Expected custom enricher to set internal_user, got %q", data.Query["internal_user"])
+	}
+	if sawBrowser != "Firefox" {
+		t.Errorf("Expected custom enricher to run after useragent, saw browser %q", sawBrowser)
+	}
+	if !slicesEqual(data.Language, []string{"en-US"}) {
+		t.Errorf("Expected language enricher to run, got %v", data.Language)
+	}
+}
+
+func TestSetEnricherOrder(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	var sawBrowser string
+	tracker.AddEnricher("probe", func(data *TrackingData, r *http.Request) {
+		sawBrowser = data.UserAgent.Browser
+	})
+
+	if err := tracker.SetEnricherOrder("probe", "useragent"); err != nil {
+		t.Fatalf("SetEnricherOrder() returned error: %v", err)
+	}
+	if names := tracker.Enrichers(); !slicesEqual(names, []string{"probe", "useragent"}) {
+		t.Errorf("Enrichers() = %v, want [probe useragent]", names)
+	}
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0")
+	req.Header.Set("Referer", "https://example.com")
+
+	data := &TrackingData{}
+	tracker.enrich(data, req)
+
+	if sawBrowser != "" {
+		t.Errorf("Expected probe to run before useragent, saw browser %q", sawBrowser)
+	}
+	if data.UserAgent.Browser != "Firefox" {
+		t.Errorf("Expected useragent enricher to run, got %q", data.UserAgent.Browser)
+	}
+	if data.Referer != "" {
+		t.Errorf("Expected unlisted referer enricher to be dropped, got %q", data.Referer)
+	}
+
+	if err := tracker.SetEnricherOrder("missing"); err == nil {
+		t.Error("Expected error for unknown enricher")
+	}
+}
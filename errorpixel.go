@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// httpError writes an error response. On paths listed in ErrorPixelRoutes the
+// body is the pixel instead of text, so an <img> pointing there still
+// renders as a blank image while the status reports the failure.
+func (pt *PixelTracker) httpError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !pt.isErrorPixelRoute(r) {
+		http.Error(w, message, status)
+		return
+	}
+	pixel := pt.setPixelHeaders(w, r)
+	w.WriteHeader(status)
+	w.Write(pixel.body)
+}
+
+func (pt *PixelTracker) isErrorPixelRoute(r *http.Request) bool {
+	return slices.Contains(pt.config().ErrorPixelRoutes, r.URL.Path)
+}
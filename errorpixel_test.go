@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorPixel(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	config.ErrorPixelRoutes = []string{"/private.gif"}
+	tracker.Configure(config)
+
+	guarded := tracker.requireAdmin(tracker.PixelHandler)
+	gif := pixelFor("gif")
+
+	tests := []struct {
+		name          string
+		target        string
+		expectedType  string
+		expectedPixel bool
+	}{
+		{"Listed route gets the pixel", "/private.gif", gif.contentType, true},
+		{"Other routes get text", "/other.gif", "text/plain; charset=utf-8", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			guarded(rr, httptest.NewRequest("GET", tt.target, nil))
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("Expected status %d, got %d", http.StatusForbidden, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedType {
+				t.Errorf("Expected content type %q, got %q", tt.expectedType, contentType)
+			}
+			if isPixel := bytes.Equal(rr.Body.Bytes(), gif.body); isPixel != tt.expectedPixel {
+				t.Errorf("Expected pixel body %v, got %q", tt.expectedPixel, rr.Body.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "encoding/json"
+
+// optionalField is a captured field that can be dropped to fit an event
+// under MaxEventBytes.
+type optionalField struct {
+	value func(*TrackingData) any
+	clear func(*TrackingData)
+}
+
+// optionalFields are the fields whose size depends on what the client sent.
+// The rest of an event is bounded by parsing and enrichment.
+var optionalFields = []optionalField{
+	{func(d *TrackingData) any { return d.Cookies }, func(d *TrackingData) { d.Cookies = nil }},
+	{func(d *TrackingData) any { return d.Query }, func(d *TrackingData) { d.Query = nil }},
+	{func(d *TrackingData) any { return d.Params }, func(d *TrackingData) { d.Params = nil }},
+	{func(d *TrackingData) any { return d.Headers }, func(d *TrackingData) { d.Headers = nil }},
+	{func(d *TrackingData) any { return d.Payload }, func(d *TrackingData) { d.Payload = nil }},
+	{func(d *TrackingData) any { return d.RawQuery }, func(d *TrackingData) { d.RawQuery = "" }},
+	{func(d *TrackingData) any { return d.RefererInfo }, func(d *TrackingData) { d.RefererInfo = nil }},
+}
+
+// jsonSize is the encoded size of v, or 0 if it can't be encoded.
+func jsonSize(v any) int {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(encoded)
+}
+
+// capEventSize drops the largest optional fields from data until its JSON
+// encoding fits in MaxEventBytes, setting Truncated if any were dropped.
+func (pt *PixelTracker) capEventSize(data *TrackingData) {
+	limit := pt.config().MaxEventBytes
+	if limit <= 0 {
+		return
+	}
+	size := jsonSize(data)
+	remaining := append([]optionalField(nil), optionalFields...)
+	for len(remaining) > 0 && size > limit {
+		largest, largestSize := 0, 0
+		for i, field := range remaining {
+			if fieldSize := jsonSize(field.value(data)); fieldSize > largestSize {
+				largest, largestSize = i, fieldSize
+			}
+		}
+		remaining[largest].clear(data)
+		remaining = append(remaining[:largest], remaining[largest+1:]...)
+		// Clearing an already empty field changes nothing worth flagging.
+		if cleared := jsonSize(data); cleared < size {
+			size = cleared
+			data.Truncated = true
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMaxEventBytes(t *testing.T) {
+	const limit = 1024
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxEventBytes = limit
+	tracker.Configure(config)
+
+	small := &TrackingData{Path: "/", Query: map[string]string{"event": "view"}}
+	tracker.storeAndDispatch(small)
+
+	big := &TrackingData{
+		Path:    "/",
+		Query:   map[string]string{"event": "view"},
+		Cookies: map[string]string{"session": strings.Repeat("c", 600)},
+		Headers: map[string]string{"X-Debug": strings.Repeat("h", 800)},
+	}
+	tracker.storeAndDispatch(big)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(data))
+	}
+	if data[0].Truncated || data[0].Query["event"] != "view" {
+		t.Errorf("Expected the small event untouched, got %+v", data[0])
+	}
+
+	truncated := data[1]
+	if !truncated.Truncated {
+		t.Error("Expected the oversized event to be flagged truncated")
+	}
+	if encoded, _ := json.Marshal(truncated); len(encoded) > limit {
+		t.Errorf("Expected at most %d bytes, got %d", limit, len(encoded))
+	}
+	// Dropping the headers, the largest field, is enough; smaller ones stay.
+	if truncated.Headers != nil {
+		t.Errorf("Expected the headers dropped, got %v", truncated.Headers)
+	}
+	if truncated.Cookies["session"] == "" || truncated.Query["event"] != "view" {
+		t.Errorf("Expected cookies and query kept, got %+v", truncated)
+	}
+}
+
+func TestMaxEventBytesDropsSeveralFields(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	// Room for the bare event plus less than any one of the fields below.
+	config.MaxEventBytes = jsonSize(&TrackingData{Path: "/"}) + 200
+	tracker.Configure(config)
+
+	data := &TrackingData{
+		Path:    "/",
+		Query:   map[string]string{"q": strings.Repeat("q", 300)},
+		Cookies: map[string]string{"a": strings.Repeat("c", 400)},
+		Headers: map[string]string{"b": strings.Repeat("h", 500)},
+	}
+	tracker.capEventSize(data)
+
+	if encoded, _ := json.Marshal(data); len(encoded) > config.MaxEventBytes {
+		t.Errorf("Expected at most %d bytes, got %d", config.MaxEventBytes, len(encoded))
+	}
+	if !data.Truncated || data.Headers != nil || data.Cookies != nil || data.Query != nil {
+		t.Errorf("Expected cookies, query and headers all dropped, got %+v", data)
+	}
+}
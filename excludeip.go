@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// loopbackPrefixes are where health checks from the tracker's own host come
+// from.
+var loopbackPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+}
+
+// parseExcludeIPs turns ExcludeIPs entries, single addresses or CIDR ranges,
+// into prefixes once at Configure time so a typo fails loudly. With
+// ExcludeSelf the loopback ranges and the host's own interface addresses are
+// added.
+func parseExcludeIPs(specs []string, self bool) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if strings.Contains(spec, "/") {
+			prefix, err := netip.ParsePrefix(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ExcludeIPs range %q: %w", spec, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ExcludeIPs address %q: %w", spec, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	if self {
+		prefixes = append(prefixes, loopbackPrefixes...)
+		addrs, _ := net.InterfaceAddrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok {
+				if addr, ok := netip.AddrFromSlice(ipnet.IP); ok {
+					addr = addr.Unmap()
+					prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+				}
+			}
+		}
+	}
+	return prefixes, nil
+}
+
+// excludedIP reports whether the client IP falls in ExcludeIPs. Excluded
+// requests still get the pixel.
+func (pt *PixelTracker) excludedIP(r *http.Request) bool {
+	pt.mu.RLock()
+	excluded := pt.excludedIPs
+	pt.mu.RUnlock()
+	if len(excluded) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(getClientIP(r))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range excluded {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
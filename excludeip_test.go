@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExcludeIPs(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		stored     bool
+	}{
+		{"Excluded IP", "198.51.100.7:1234", "", false},
+		{"Excluded CIDR", "203.0.113.42:1234", "", false},
+		{"Excluded IPv6 CIDR", "[2001:db8::1]:1234", "", false},
+		{"Excluded forwarded IP", "10.0.0.1:1234", "203.0.113.9", false},
+		{"Normal IP", "81.2.69.142:1234", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.ExcludeIPs = []string{"198.51.100.7", "203.0.113.0/24", "2001:db8::/32"}
+			config.FeatureAllowlist = []string{featureSync}
+			if err := tracker.Configure(config); err != nil {
+				t.Fatalf("Configure() error: %v", err)
+			}
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			req.Header.Set(featuresHeader, featureSync)
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/gif" {
+				t.Errorf("Expected the pixel, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+			}
+			if stored := len(tracker.GetTrackingData()) == 1; stored != tt.stored {
+				t.Errorf("Expected stored=%v, got %v", tt.stored, stored)
+			}
+		})
+	}
+}
+
+func TestExcludeIPsBatch(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ExcludeIPs = []string{"203.0.113.0/24"}
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"a"}]`))
+	req.RemoteAddr = "203.0.113.5:1234"
+	rr := httptest.NewRecorder()
+	tracker.BatchHandler(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected excluded batch to be accepted, got %d", rr.Code)
+	}
+	if n := len(tracker.GetTrackingData()); n != 0 {
+		t.Errorf("Expected excluded batch not to be stored, got %d events", n)
+	}
+}
+
+func TestExcludeSelf(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ExcludeSelf = true
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	if !tracker.excludedIP(req) {
+		t.Error("Expected loopback health check to be excluded")
+	}
+	req.RemoteAddr = "81.2.69.142:1234"
+	if tracker.excludedIP(req) {
+		t.Error("Expected external IP not to be excluded")
+	}
+}
+
+func TestParseExcludeIPsInvalid(t *testing.T) {
+	for _, spec := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := parseExcludeIPs([]string{spec}, false); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ExcludeIPs = []string{"bogus"}
+	if err := tracker.Configure(config); err == nil {
+		t.Error("Expected Configure to reject invalid ExcludeIPs")
+	}
+}
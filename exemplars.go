@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+var requestBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// requestHistogram tracks pixel request latency. Each bucket keeps the most
+// recent traced observation that landed in it as an exemplar.
+type requestHistogram struct {
+	mu        sync.Mutex
+	counts    []uint64 // per bucket, plus +Inf at the end
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+func newRequestHistogram() *requestHistogram {
+	return &requestHistogram{
+		counts:    make([]uint64, len(requestBuckets)+1),
+		exemplars: make([]*exemplar, len(requestBuckets)+1),
+	}
+}
+
+func (h *requestHistogram) observe(d time.Duration, span trace.SpanContext) {
+	seconds := d.Seconds()
+	bucket := len(requestBuckets)
+	for i, upper := range requestBuckets {
+		if seconds <= upper {
+			bucket = i
+			break
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+	if span.IsValid() {
+		h.exemplars[bucket] = &exemplar{span.TraceID().String(), seconds, time.Now()}
+	}
+}
+
+// write emits the histogram. Exemplars are only valid in OpenMetrics, so
+// they are left out of the classic Prometheus text format.
+func (h *requestHistogram) write(w io.Writer, openMetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	const name = "pixel_tracker_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Time to serve a pixel request.\n", name)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	var cumulative uint64
+	for i, n := range h.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(requestBuckets) {
+			le = fmt.Sprintf("%g", requestBuckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d", name, le, cumulative)
+		if ex := h.exemplars[i]; openMetrics && ex != nil {
+			fmt.Fprintf(w, " # {trace_id=%q} %g %.3f", ex.traceID, ex.value, float64(ex.at.UnixMilli())/1000)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// observeRequest records a pixel request when RecordTimings is on. The trace
+// ID is attached as an exemplar only when tracing is enabled too.
+func (pt *PixelTracker) observeRequest(start time.Time, span trace.Span) {
+	if !pt.config().RecordTimings {
+		return
+	}
+	var sc trace.SpanContext
+	if pt.config().EnableTracing {
+		sc = span.SpanContext()
+	}
+	pt.requests.observe(time.Since(start), sc)
+}
+
+func acceptsOpenMetrics(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestMetricsExemplars(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableTracing = true
+	config.RecordTimings = true
+	tracker.Configure(config)
+	tracker.SetTracerProvider(provider)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	tracker.PixelHandler(httptest.NewRecorder(), req)
+
+	scrape := httptest.NewRequest("GET", "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, scrape)
+	body := rr.Body.String()
+
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Expected OpenMetrics content type, got %q", ct)
+	}
+	if !strings.Contains(body, `# {trace_id="`+traceID+`"}`) {
+		t.Errorf("Expected an exemplar with trace ID %s, got:\n%s", traceID, body)
+	}
+	if !strings.Contains(body, "pixel_tracker_request_duration_seconds_count 1") {
+		t.Errorf("Expected one observed request, got:\n%s", body)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("Expected OpenMetrics output to end with # EOF")
+	}
+
+	rr = httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rr.Body.String(), "trace_id") {
+		t.Error("Expected no exemplars in the classic text format")
+	}
+}
+
+func TestMetricsExemplarsRequireTracing(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RecordTimings = true
+	tracker.Configure(config)
+	tracker.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tracker.PixelHandler(httptest.NewRecorder(), req)
+
+	scrape := httptest.NewRequest("GET", "/metrics", nil)
+	scrape.Header.Set("Accept", "application/openmetrics-text")
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, scrape)
+
+	if strings.Contains(rr.Body.String(), "trace_id") {
+		t.Errorf("Expected no exemplars with tracing disabled, got:\n%s", rr.Body.String())
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// featuresHeader carries per-request toggles, e.g. "sync, skip-geo".
+const featuresHeader = "X-Tracker-Features"
+
+// Feature toggles. Any enricher can be skipped with "skip-<name>".
+const (
+	featureSync       = "sync"
+	featureSkipPrefix = "skip-"
+)
+
+// requestFeatures returns the toggles named in X-Tracker-Features that are
+// also in FeatureAllowlist. Anything else is ignored, so clients can't
+// change server behavior that wasn't opted into.
+func (pt *PixelTracker) requestFeatures(r *http.Request) map[string]bool {
+	header := r.Header.Get(featuresHeader)
+	if header == "" || len(pt.config().FeatureAllowlist) == 0 {
+		return nil
+	}
+	var features map[string]bool
+	for _, name := range strings.Split(header, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, allowed := range pt.config().FeatureAllowlist {
+			if name == allowed {
+				if features == nil {
+					features = make(map[string]bool)
+				}
+				features[name] = true
+			}
+		}
+	}
+	return features
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeatureToggles(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		expectSync  bool
+		expectNoGeo bool
+	}{
+		{"No header", "", false, false},
+		{"Allowed sync", "sync", true, false},
+		{"Allowed skip", "Sync, skip-geo", true, true},
+		{"Disallowed toggle ignored", "sync, skip-ip", true, false},
+		{"Unknown toggle ignored", "sync, turbo", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.FeatureAllowlist = []string{"sync", "skip-geo"}
+			tracker.Configure(config)
+			tracker.SetGeoResolver(fixedGeoResolver(GeoRecord{Country: "US"}))
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = "81.2.69.142:12345"
+			if tt.header != "" {
+				req.Header.Set(featuresHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+
+			// Without sync the event is stored after the response, so an
+			// immediate read may miss it; with sync it is always there.
+			data := tracker.GetTrackingData()
+			if tt.expectSync && len(data) != 1 {
+				t.Fatalf("Expected the event stored before the response, got %d events", len(data))
+			}
+			if !tt.expectSync {
+				time.Sleep(100 * time.Millisecond)
+				data = tracker.GetTrackingData()
+			}
+			if noGeo := data[0].Geo.Country == ""; noGeo != tt.expectNoGeo {
+				t.Errorf("Expected geo skipped=%v, got country %q", tt.expectNoGeo, data[0].Geo.Country)
+			}
+			if data[0].IP == "" {
+				t.Error("Expected other enrichers to still run")
+			}
+		})
+	}
+}
+
+func TestFeatureTogglesWithoutAllowlist(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set(featuresHeader, "sync, skip-geo")
+	if features := tracker.requestFeatures(req); len(features) != 0 {
+		t.Errorf("Expected no toggles without FeatureAllowlist, got %v", features)
+	}
+}
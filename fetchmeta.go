@@ -0,0 +1,31 @@
+package main
+
+import "net/http"
+
+// FetchMeta holds the Fetch Metadata request headers, which say how the
+// pixel was requested: Dest "image" with Site "cross-site" is a third-party
+// embed, Mode "navigate" a direct visit, and Mode "no-cors" or "cors" a
+// beacon or fetch from a script.
+type FetchMeta struct {
+	Site string `json:"site,omitempty"`
+	Mode string `json:"mode,omitempty"`
+	Dest string `json:"dest,omitempty"`
+}
+
+// enrichFetchMeta records the Sec-Fetch-Site, Sec-Fetch-Mode and
+// Sec-Fetch-Dest headers when CaptureFetchMetadata is on. Browsers that
+// don't send them leave FetchMeta nil.
+func (pt *PixelTracker) enrichFetchMeta(data *TrackingData, r *http.Request) {
+	if !pt.config().CaptureFetchMetadata {
+		return
+	}
+	meta := FetchMeta{
+		Site: r.Header.Get("Sec-Fetch-Site"),
+		Mode: r.Header.Get("Sec-Fetch-Mode"),
+		Dest: r.Header.Get("Sec-Fetch-Dest"),
+	}
+	if meta == (FetchMeta{}) {
+		return
+	}
+	data.FetchMeta = &meta
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnrichFetchMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected *FetchMeta
+	}{
+		{
+			name:     "Cross-site image embed",
+			headers:  map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "no-cors", "Sec-Fetch-Dest": "image"},
+			expected: &FetchMeta{Site: "cross-site", Mode: "no-cors", Dest: "image"},
+		},
+		{
+			name:     "Same-origin image",
+			headers:  map[string]string{"Sec-Fetch-Site": "same-origin", "Sec-Fetch-Mode": "no-cors", "Sec-Fetch-Dest": "image"},
+			expected: &FetchMeta{Site: "same-origin", Mode: "no-cors", Dest: "image"},
+		},
+		{
+			name:     "Direct navigation",
+			headers:  map[string]string{"Sec-Fetch-Site": "none", "Sec-Fetch-Mode": "navigate", "Sec-Fetch-Dest": "document"},
+			expected: &FetchMeta{Site: "none", Mode: "navigate", Dest: "document"},
+		},
+		{
+			name:     "Cross-site fetch",
+			headers:  map[string]string{"Sec-Fetch-Site": "cross-site", "Sec-Fetch-Mode": "cors", "Sec-Fetch-Dest": "empty"},
+			expected: &FetchMeta{Site: "cross-site", Mode: "cors", Dest: "empty"},
+		},
+		{
+			name:     "Partial headers",
+			headers:  map[string]string{"Sec-Fetch-Site": "same-site"},
+			expected: &FetchMeta{Site: "same-site"},
+		},
+		{
+			name:     "Older browser",
+			headers:  map[string]string{},
+			expected: nil,
+		},
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.CaptureFetchMetadata = true
+	tracker.Configure(config)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			data := &TrackingData{}
+			tracker.enrichFetchMeta(data, req)
+			if tt.expected == nil {
+				if data.FetchMeta != nil {
+					t.Errorf("Expected no fetch metadata, got %+v", data.FetchMeta)
+				}
+				return
+			}
+			if data.FetchMeta == nil || *data.FetchMeta != *tt.expected {
+				t.Errorf("enrichFetchMeta() = %+v, want %+v", data.FetchMeta, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEnrichFetchMetaDisabled(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+
+	data := &TrackingData{}
+	tracker.enrichFetchMeta(data, req)
+	if data.FetchMeta != nil {
+		t.Errorf("Expected no fetch metadata when disabled, got %+v", data.FetchMeta)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// mappedEvent marshals an event with its JSON fields renamed by FieldMapping.
+// Keys are dotted paths into the default JSON form, so "geo.country" can be
+// lifted to a top-level "country". Unmapped fields keep their default names.
+type mappedEvent struct {
+	event   TrackingData
+	mapping map[string]string
+}
+
+func (m mappedEvent) MarshalJSON() ([]byte, error) {
+	encoded, err := json.Marshal(m.event)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	// Take every mapped value out before placing any, so that swapping two
+	// names doesn't overwrite one with the other.
+	moved := make(map[string]any, len(m.mapping))
+	for from := range m.mapping {
+		if value, ok := takePath(fields, from); ok {
+			moved[from] = value
+		}
+	}
+	for from, value := range moved {
+		putPath(fields, m.mapping[from], value)
+	}
+	return json.Marshal(fields)
+}
+
+func takePath(fields map[string]any, path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := fields[part].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		fields = next
+	}
+	last := parts[len(parts)-1]
+	value, ok := fields[last]
+	if ok {
+		delete(fields, last)
+	}
+	return value, ok
+}
+
+func putPath(fields map[string]any, path string, value any) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := fields[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			fields[part] = next
+		}
+		fields = next
+	}
+	fields[parts[len(parts)-1]] = value
+}
+
+// outputEvents prepares events for JSON output, applying FieldMapping when
+// one is configured.
+// outputEvent is the form a single event takes in /stats output.
+func (pt *PixelTracker) outputEvent(event TrackingData) any {
+	if len(pt.config().FieldMapping) == 0 {
+		return event
+	}
+	return mappedEvent{event, pt.config().FieldMapping}
+}
+
+func (pt *PixelTracker) outputEvents(data []TrackingData) any {
+	if len(pt.config().FieldMapping) == 0 {
+		return data
+	}
+	mapped := make([]mappedEvent, len(data))
+	for i, event := range data {
+		mapped[i] = mappedEvent{event, pt.config().FieldMapping}
+	}
+	return mapped
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFieldMapping(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.FieldMapping = map[string]string{
+		"useragent":   "ua",
+		"geo.country": "country",
+		"path":        "page.path",
+	}
+	tracker.Configure(config)
+
+	tracker.storeAndDispatch(&TrackingData{
+		Host:      "localhost:8080",
+		Path:      "/pixel.gif",
+		Referer:   "https://example.com",
+		UserAgent: BrowserInfo{Browser: "Firefox", Version: "118.0"},
+		Geo:       GeoInfo{IP: "203.0.113.1", Country: "DE"},
+	})
+
+	for _, target := range []string{"/stats", "/stats?limit=10"} {
+		t.Run(target, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tracker.StatsHandler(rr, httptest.NewRequest("GET", target, nil))
+
+			var events []map[string]any
+			if target == "/stats" {
+				if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+			} else {
+				var page struct {
+					Data []map[string]any `json:"data"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				events = page.Data
+			}
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			event := events[0]
+
+			if _, ok := event["useragent"]; ok {
+				t.Error("Expected useragent to be renamed")
+			}
+			if ua, _ := event["ua"].(map[string]any); ua["browser"] != "Firefox" {
+				t.Errorf("Expected ua.browser Firefox, got %v", event["ua"])
+			}
+			if event["country"] != "DE" {
+				t.Errorf("Expected top-level country DE, got %v", event["country"])
+			}
+			if geo, _ := event["geo"].(map[string]any); geo["ip"] != "203.0.113.1" || geo["country"] != nil {
+				t.Errorf("Expected geo to keep ip and lose country, got %v", event["geo"])
+			}
+			if page, _ := event["page"].(map[string]any); page["path"] != "/pixel.gif" {
+				t.Errorf("Expected page.path /pixel.gif, got %v", event["page"])
+			}
+			if event["referer"] != "https://example.com" || event["host"] != "localhost:8080" {
+				t.Errorf("Expected unmapped fields to keep their names, got %v", event)
+			}
+		})
+	}
+}
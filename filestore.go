@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Partition schemes for FileStore.
+const (
+	PartitionNone  = ""
+	PartitionDaily = "day"
+)
+
+const partitionDateLayout = "2006-01-02"
+
+// maxRecordBytes bounds a length-prefixed record, the same as the longest
+// line the JSON format reads back.
+const maxRecordBytes = 16 * 1024 * 1024
+
+// FileStore appends events under a directory, encoded with its codec. With
+// PartitionDaily each UTC day goes to its own events-YYYY-MM-DD.jsonl, so
+// queries with a Since skip older days and retention deletes whole files;
+// otherwise everything goes to events.jsonl. JSON is stored a line per
+// event; other codecs write binary, so each event is prefixed with its
+// length instead and the files are named after the codec, e.g. events.gob.
+type FileStore struct {
+	mu        sync.Mutex
+	dir       string
+	partition string
+	codec     Codec
+	ext       string
+}
+
+// OpenFileStore creates dir if needed and stores events there using the
+// given partition scheme and codec. A nil codec stores JSON.
+func OpenFileStore(dir, partition string, codec Codec) (*FileStore, error) {
+	if partition != PartitionNone && partition != PartitionDaily {
+		return nil, fmt.Errorf("unknown storage partition %q", partition)
+	}
+	if codec == nil {
+		codec = jsonCodec{}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	ext := ".jsonl"
+	if codec.Name() != "json" {
+		ext = "." + codec.Name()
+	}
+	return &FileStore{dir: dir, partition: partition, codec: codec, ext: ext}, nil
+}
+
+// lineDelimited reports whether events are stored a line each, which only
+// JSON, never containing a raw newline, allows.
+func (fs *FileStore) lineDelimited() bool {
+	return fs.codec.Name() == "json"
+}
+
+// receivedAt is the server time an event arrived, which partitions go by so
+// a client-supplied Timestamp can't place an event outside retention.
+// Events stored before ReceivedAt existed fall back to Timestamp.
+func receivedAt(event TrackingData) time.Time {
+	if event.ReceivedAt.IsZero() {
+		return event.Timestamp
+	}
+	return event.ReceivedAt
+}
+
+// partitionFile is the file an event received at ts is written to.
+func (fs *FileStore) partitionFile(ts time.Time) string {
+	if fs.partition == PartitionDaily {
+		return filepath.Join(fs.dir, "events-"+ts.UTC().Format(partitionDateLayout)+fs.ext)
+	}
+	return filepath.Join(fs.dir, "events"+fs.ext)
+}
+
+// partitionDay parses the day out of a daily partition file name.
+func partitionDay(path string) (time.Time, bool) {
+	name := strings.TrimPrefix(filepath.Base(path), "events-")
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	day, err := time.Parse(partitionDateLayout, name)
+	return day, err == nil
+}
+
+// encode returns event as it is written to a partition: a JSON line, or a
+// big-endian uint32 length followed by the encoded event.
+func (fs *FileStore) encode(event TrackingData) ([]byte, error) {
+	data, err := fs.codec.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if fs.lineDelimited() {
+		return append(data, '\n'), nil
+	}
+	if len(data) > maxRecordBytes {
+		return nil, fmt.Errorf("encoded event is %d bytes, over the %d byte limit", len(data), maxRecordBytes)
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), data...), nil
+}
+
+func (fs *FileStore) Append(event TrackingData) error {
+	record, err := fs.encode(event)
+	if err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, err := os.OpenFile(fs.partitionFile(receivedAt(event)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(record); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// partitions lists the store's files oldest first.
+func (fs *FileStore) partitions() ([]string, error) {
+	pattern := "events" + fs.ext
+	if fs.partition == PartitionDaily {
+		pattern = "events-*" + fs.ext
+	}
+	files, err := filepath.Glob(filepath.Join(fs.dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Query reads the matching events, skipping daily partitions that end
+// before filter.Since.
+func (fs *FileStore) Query(filter QueryFilter) ([]TrackingData, error) {
+	matched := []TrackingData{}
+	err := fs.Scan(filter, func(event TrackingData) error {
+		matched = append(matched, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matched, nil
+}
+
+// Scan streams the matching events one at a time, skipping daily
+// partitions that end before filter.Since. Partitions go by receive time
+// and Since by Timestamp, which can be up to maxClockSkew ahead, so pruning
+// leaves that much slack. Files are only listed under the lock: appends
+// write whole records and retention replaces or removes files, so reading
+// without it sees at worst a trailing partial record, which is skipped.
+func (fs *FileStore) Scan(filter QueryFilter, fn func(TrackingData) error) error {
+	fs.mu.Lock()
+	files, err := fs.partitions()
+	fs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if day, ok := partitionDay(file); ok && !filter.Since.IsZero() && !day.AddDate(0, 0, 1).Add(maxClockSkew).After(filter.Since) {
+			continue
+		}
+		err := fs.scanFile(file, func(event TrackingData) error {
+			if filter.Tenant != "" && event.Tenant != filter.Tenant {
+				return nil
+			}
+			if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+				return nil
+			}
+			return fn(event)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFile decodes each complete record of path in turn.
+func (fs *FileStore) scanFile(path string, fn func(TrackingData) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		data, err := fs.readRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		var event TrackingData
+		if err := fs.codec.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
+
+// readRecord returns the next encoded event, or io.EOF or
+// io.ErrUnexpectedEOF at the end of the file or a trailing partial record.
+func (fs *FileStore) readRecord(reader *bufio.Reader) ([]byte, error) {
+	if fs.lineDelimited() {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return line, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(reader, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxRecordBytes {
+		return nil, fmt.Errorf("record of %d bytes is over the %d byte limit", n, maxRecordBytes)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (fs *FileStore) readFile(path string) ([]TrackingData, error) {
+	var events []TrackingData
+	err := fs.scanFile(path, func(event TrackingData) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// DropBefore deletes the daily partitions that end at or before cutoff and
+// reports how many were removed. Unpartitioned stores keep everything.
+func (fs *FileStore) DropBefore(cutoff time.Time) (int, error) {
+	if fs.partition != PartitionDaily {
+		return 0, nil
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	files, err := fs.partitions()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for _, file := range files {
+		day, ok := partitionDay(file)
+		if !ok || day.AddDate(0, 0, 1).After(cutoff) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+	return dropped, nil
+}
+
+// ExpireEvents removes the events expired reports true for, rewriting only
+// the partitions that change, and reports how many were removed.
+func (fs *FileStore) ExpireEvents(expired func(TrackingData) bool) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	files, err := fs.partitions()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		events, err := fs.readFile(file)
+		if err != nil {
+			return removed, err
+		}
+		kept := events[:0]
+		for _, event := range events {
+			if !expired(event) {
+				kept = append(kept, event)
+			}
+		}
+		if len(kept) == len(events) {
+			continue
+		}
+		if err := fs.rewriteFile(file, kept); err != nil {
+			return removed, err
+		}
+		removed += len(events) - len(kept)
+	}
+	return removed, nil
+}
+
+// rewriteFile replaces path with events through a temporary file, so a
+// failed write leaves the old partition intact. An empty partition is
+// removed.
+func (fs *FileStore) rewriteFile(path string, events []TrackingData) error {
+	if len(events) == 0 {
+		return os.Remove(path)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".expire-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, event := range events {
+		record, err := fs.encode(event)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(record)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// PartitionDropper is implemented by storage backends that can expire old
+// events a partition at a time.
+type PartitionDropper interface {
+	DropBefore(cutoff time.Time) (int, error)
+}
+
+// EventExpirer is implemented by storage backends that can remove
+// individual events, which per-event retention needs.
+type EventExpirer interface {
+	ExpireEvents(expired func(TrackingData) bool) (int, error)
+}
+
+// eventRetention is how long events of the given type are kept: their
+// RetentionByEvent entry, else Retention. Zero keeps them forever.
+func (config Config) eventRetention(event string) time.Duration {
+	if ttl, ok := config.RetentionByEvent[event]; ok {
+		return ttl
+	}
+	return config.Retention
+}
+
+// parseRetentionByEvent parses "event=duration" pairs separated by commas,
+// e.g. "purchase=8760h,pageview=168h".
+func parseRetentionByEvent(spec string) (map[string]time.Duration, error) {
+	byEvent := make(map[string]time.Duration)
+	for _, pair := range strings.Split(spec, ",") {
+		event, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || event == "" {
+			return nil, fmt.Errorf("expected event=duration, got %q", pair)
+		}
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", event, err)
+		}
+		byEvent[event] = ttl
+	}
+	return byEvent, nil
+}
+
+// partitionRetention is the age after which whole partitions can go: the
+// longest retention any event type has, or zero if some type is kept
+// forever.
+func (config Config) partitionRetention() time.Duration {
+	longest := config.Retention
+	if longest <= 0 {
+		return 0
+	}
+	for _, ttl := range config.RetentionByEvent {
+		if ttl <= 0 {
+			return 0
+		}
+		longest = max(longest, ttl)
+	}
+	return longest
+}
+
+// applyRetention drops partitions older than Retention from storage that
+// supports it, and otherwise expires old events one by one. With
+// RetentionByEvent it also removes the events whose type has a shorter
+// retention.
+func (pt *PixelTracker) applyRetention(now time.Time) {
+	pt.mu.RLock()
+	config := *pt.config()
+	storage := pt.storage
+	pt.mu.RUnlock()
+
+	dropped := 0
+	if retention := config.partitionRetention(); retention > 0 {
+		if dropper, ok := storage.(PartitionDropper); ok {
+			n, err := dropper.DropBefore(now.Add(-retention))
+			if err != nil {
+				log.Printf("Retention failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Retention dropped %d partitions", n)
+			}
+			dropped += n
+		}
+	}
+	// Storage that can't drop partitions, such as the in-memory default,
+	// expires Retention event by event too.
+	if expirer, ok := storage.(EventExpirer); ok && (len(config.RetentionByEvent) > 0 || (!dropsPartitions(storage) && config.Retention > 0)) {
+		n, err := expirer.ExpireEvents(func(event TrackingData) bool {
+			ttl := config.eventRetention(event.Event)
+			return ttl > 0 && receivedAt(event).Before(now.Add(-ttl))
+		})
+		if err != nil {
+			log.Printf("Retention failed: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Retention expired %d events", n)
+		}
+		dropped += n
+	}
+	if dropped == 0 {
+		return
+	}
+	// Cached results and aggregates may still hold the dropped events.
+	pt.mu.Lock()
+	pt.rebuildQueryCache()
+	if pt.aggregates != nil {
+		pt.aggregates.invalidate()
+	}
+	pt.mu.Unlock()
+}
+
+// dropsPartitions reports whether storage deletes old events a partition at
+// a time. An unpartitioned FileStore has nothing to drop.
+func dropsPartitions(storage Storage) bool {
+	if fs, ok := storage.(*FileStore); ok {
+		return fs.partition == PartitionDaily
+	}
+	_, ok := storage.(PartitionDropper)
+	return ok
+}
+
+// runRetention applies Retention and RetentionByEvent every interval in the
+// background.
+func (pt *PixelTracker) runRetention(interval time.Duration) {
+	go func() {
+		for now := range time.Tick(interval) {
+			pt.applyRetention(now)
+		}
+	}()
+}
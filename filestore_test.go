@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreDailyPartitions(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionDaily, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+
+	events := []TrackingData{
+		{Path: "/a", Timestamp: time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)},
+		{Path: "/b", Timestamp: time.Date(2024, 3, 2, 0, 1, 0, 0, time.UTC)},
+		// 01:30 in UTC+2 is still 1 March in UTC.
+		{Path: "/c", Timestamp: time.Date(2024, 3, 2, 1, 30, 0, 0, time.FixedZone("EET", 2*3600))},
+	}
+	for _, event := range events {
+		if err := store.Append(event); err != nil {
+			t.Fatalf("Append() returned error: %v", err)
+		}
+	}
+
+	expected := map[string]int{"events-2024-03-01.jsonl": 2, "events-2024-03-02.jsonl": 1}
+	for name, count := range expected {
+		got, err := store.readFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read partition %s: %v", name, err)
+		}
+		if len(got) != count {
+			t.Errorf("Expected %d events in %s, got %d", count, name, len(got))
+		}
+	}
+
+	data, err := store.Query(QueryFilter{Since: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(data) != 1 || data[0].Path != "/b" {
+		t.Errorf("Expected only /b since 2 March, got %+v", data)
+	}
+	if all, _ := store.Query(QueryFilter{}); len(all) != 3 {
+		t.Errorf("Expected 3 events in total, got %d", len(all))
+	}
+}
+
+func TestFileStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionDaily, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, day := range []int{1, 1, 8, 9, 10} {
+		store.Append(TrackingData{Path: "/", Timestamp: time.Date(2024, 3, day, 12, 0, 0, 0, time.UTC)})
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Retention = 2 * 24 * time.Hour
+	tracker.Configure(config)
+	tracker.SetStorage(store)
+	tracker.applyRetention(now)
+
+	// The cutoff falls on 8 March, so only partitions ending by then go.
+	if _, err := os.Stat(filepath.Join(dir, "events-2024-03-01.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("Expected the 1 March partition to be dropped, got %v", err)
+	}
+	for _, name := range []string{"events-2024-03-08.jsonl", "events-2024-03-09.jsonl", "events-2024-03-10.jsonl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept, got %v", name, err)
+		}
+	}
+	if data := tracker.GetTrackingData(); len(data) != 3 {
+		t.Errorf("Expected 3 events after retention, got %d", len(data))
+	}
+}
+
+func TestFileStoreUnpartitioned(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionNone, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+	store.Append(TrackingData{Path: "/old", Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+
+	if _, err := os.Stat(filepath.Join(dir, "events.jsonl")); err != nil {
+		t.Errorf("Expected events.jsonl, got %v", err)
+	}
+	if dropped, err := store.DropBefore(time.Now()); err != nil || dropped != 0 {
+		t.Errorf("Expected nothing dropped without partitions, got %d (%v)", dropped, err)
+	}
+
+	if _, err := OpenFileStore(dir, "hour", nil); err == nil {
+		t.Error("Expected error for unknown partition scheme")
+	}
+}
+
+func TestFileStoreRetentionUsesReceiveTime(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionDaily, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	received := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.Append(TrackingData{Path: "/future", Timestamp: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), ReceivedAt: received})
+
+	if _, err := os.Stat(filepath.Join(dir, "events-2024-03-01.jsonl")); err != nil {
+		t.Fatalf("Expected the event in its receive-day partition, got %v", err)
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Retention = 2 * 24 * time.Hour
+	tracker.Configure(config)
+	tracker.SetStorage(store)
+	tracker.applyRetention(now)
+
+	if data := tracker.GetTrackingData(); len(data) != 0 {
+		t.Errorf("Expected the far-future event to expire by receive time, got %d events", len(data))
+	}
+}
+
+func TestRetentionByEvent(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionDaily, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, daysAgo := range []int{2, 10, 40} {
+		ts := now.AddDate(0, 0, -daysAgo)
+		store.Append(TrackingData{Event: "pageview", Timestamp: ts})
+		store.Append(TrackingData{Event: "purchase", Timestamp: ts})
+		store.Append(TrackingData{Event: "click", Timestamp: ts})
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Retention = 30 * 24 * time.Hour
+	config.RetentionByEvent = map[string]time.Duration{
+		"pageview": 7 * 24 * time.Hour,
+		"purchase": 365 * 24 * time.Hour,
+	}
+	tracker.Configure(config)
+	tracker.SetStorage(store)
+	tracker.applyRetention(now)
+
+	kept := map[string]int{}
+	for _, event := range tracker.GetTrackingData() {
+		kept[event.Event]++
+	}
+	// Pageviews last a week, clicks the global 30 days, purchases a year.
+	want := map[string]int{"pageview": 1, "click": 2, "purchase": 3}
+	for event, n := range want {
+		if kept[event] != n {
+			t.Errorf("Expected %d %s events kept, got %d", n, event, kept[event])
+		}
+	}
+	// The 40-day-old partition still holds a purchase, so it must stay.
+	if _, err := os.Stat(filepath.Join(dir, "events-2024-01-30.jsonl")); err != nil {
+		t.Errorf("Expected the partition with a purchase to be kept, got %v", err)
+	}
+}
+
+func TestParseRetentionByEvent(t *testing.T) {
+	byEvent, err := parseRetentionByEvent("purchase=8760h, pageview=168h")
+	if err != nil {
+		t.Fatalf("parseRetentionByEvent() returned error: %v", err)
+	}
+	if byEvent["purchase"] != 8760*time.Hour || byEvent["pageview"] != 168*time.Hour {
+		t.Errorf("Unexpected retention map: %v", byEvent)
+	}
+	for _, spec := range []string{"purchase", "=1h", "purchase=soon"} {
+		if _, err := parseRetentionByEvent(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestRetentionInMemory(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Retention = 30 * 24 * time.Hour
+	config.RetentionByEvent = map[string]time.Duration{"pageview": 7 * 24 * time.Hour}
+	tracker.Configure(config)
+
+	for _, daysAgo := range []int{2, 10, 40} {
+		received := now.AddDate(0, 0, -daysAgo)
+		for _, event := range []string{"pageview", "click"} {
+			tracker.storeAndDispatch(&TrackingData{Event: event, Timestamp: received, ReceivedAt: received})
+		}
+	}
+	tracker.applyRetention(now)
+
+	kept := map[string]int{}
+	for _, event := range tracker.GetTrackingData() {
+		kept[event.Event]++
+	}
+	if kept["pageview"] != 1 || kept["click"] != 2 {
+		t.Errorf("Expected 1 pageview and 2 clicks kept, got %v", kept)
+	}
+
+	// Lookups by ID still work after the store is compacted.
+	for _, event := range tracker.GetTrackingData() {
+		if _, ok, _ := tracker.dataStore.Get(event.ID); !ok {
+			t.Errorf("Expected event %s to be found by ID", event.ID)
+		}
+	}
+}
+
+func TestRetentionUnpartitionedFileStore(t *testing.T) {
+	store, err := OpenFileStore(t.TempDir(), PartitionNone, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	store.Append(TrackingData{Path: "/old", ReceivedAt: now.AddDate(0, 0, -40)})
+	store.Append(TrackingData{Path: "/new", ReceivedAt: now.AddDate(0, 0, -2)})
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Retention = 30 * 24 * time.Hour
+	tracker.Configure(config)
+	tracker.SetStorage(store)
+	tracker.applyRetention(now)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 1 || data[0].Path != "/new" {
+		t.Errorf("Expected only /new to remain, got %+v", data)
+	}
+}
+
+func TestFileStoreCodec(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileStore(dir, PartitionDaily, gobCodec{})
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		event := TrackingData{Path: path, Timestamp: day, Payload: map[string]any{"line": "one\ntwo"}}
+		if err := store.Append(event); err != nil {
+			t.Fatalf("Append() returned error: %v", err)
+		}
+	}
+
+	file := filepath.Join(dir, "events-2024-03-01.gob")
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Expected the partition to be named after the codec: %v", err)
+	}
+	var event TrackingData
+	if json.Unmarshal(raw, &event) == nil {
+		t.Error("Expected the partition to be gob, not JSON")
+	}
+
+	// A write cut short leaves a partial record, which reads skip.
+	f, _ := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+
+	data, err := store.Query(QueryFilter{})
+	if err != nil {
+		t.Fatalf("Query() returned error: %v", err)
+	}
+	if len(data) != 3 || data[2].Path != "/c" || data[2].Payload["line"] != "one\ntwo" {
+		t.Fatalf("Expected the events to round-trip through gob, got %+v", data)
+	}
+
+	removed, err := store.ExpireEvents(func(event TrackingData) bool { return event.Path == "/b" })
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected one event expired, got %d (%v)", removed, err)
+	}
+	if data, _ := store.Query(QueryFilter{}); len(data) != 2 || data[0].Path != "/a" || data[1].Path != "/c" {
+		t.Errorf("Expected /a and /c after rewriting the partition, got %+v", data)
+	}
+}
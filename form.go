@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// parseFormBody reads an application/x-www-form-urlencoded body posted to the
+// pixel into r.PostForm, under the same MaxBodyBytes and Content-Encoding
+// handling as /batch. Other content types are left unread.
+func (pt *PixelTracker) parseFormBody(r *http.Request) (int, error) {
+	if r.Method != http.MethodPost || !pt.config().CaptureFormBody {
+		return 0, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return 0, nil
+	}
+
+	body, err := readBody(r, pt.maxBodyBytes())
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType, err
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge, err
+	case err != nil:
+		return http.StatusBadRequest, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	r.PostForm = form
+	return 0, nil
+}
+
+// requestParams merges the query string with any captured form body. Query
+// values win on conflicts. With MaxParams set, only that many params are
+// kept, query params first and each source in key order. DefaultParams then
+// fill in keys the request left out and don't count towards the limit.
+func (pt *PixelTracker) requestParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	pt.mergeParams(params, r.URL.Query(), r.PostForm)
+	for key, value := range pt.config().DefaultParams {
+		if _, ok := params[key]; !ok {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+func (pt *PixelTracker) mergeParams(params map[string]string, sources ...url.Values) {
+	limit := pt.config().MaxParams
+	for _, values := range sources {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := params[key]; ok || len(values[key]) == 0 {
+				continue
+			}
+			if limit > 0 && len(params) >= limit {
+				return
+			}
+			params[key] = values[key][0]
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPixelFormBody(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.CaptureFormBody = true
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("POST", "/pixel.gif?campaign=spring&source=url", strings.NewReader("event=signup&plan=pro&source=form"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(data))
+	}
+	expected := map[string]string{"campaign": "spring", "source": "url", "event": "signup", "plan": "pro"}
+	for key, value := range expected {
+		if data[0].Query[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, data[0].Query[key])
+		}
+	}
+	if data[0].Event != "signup" {
+		t.Errorf("Expected event signup from the form body, got %q", data[0].Event)
+	}
+}
+
+func TestPixelFormBodyLimits(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.CaptureFormBody = true
+	config.MaxParams = 2
+	config.MaxBodyBytes = 32
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("POST", "/pixel.gif?a=1", strings.NewReader("c=3&b=2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tracker.parseFormBody(req)
+	params := tracker.requestParams(req)
+	if len(params) != 2 || params["a"] != "1" || params["b"] != "2" {
+		t.Errorf("Expected query params first then form keys in order up to 2, got %v", params)
+	}
+
+	req = httptest.NewRequest("POST", "/pixel.gif", strings.NewReader("note="+strings.Repeat("x", 64)))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	config.CaptureFormBody = false
+	tracker.Configure(config)
+	req = httptest.NewRequest("POST", "/pixel.gif", strings.NewReader("plan=pro"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tracker.parseFormBody(req)
+	if params := tracker.requestParams(req); len(params) != 0 {
+		t.Errorf("Expected the body to be ignored when disabled, got %v", params)
+	}
+}
+
+func TestDefaultParams(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.DefaultParams = map[string]string{"source": "unknown", "medium": "email"}
+	tracker.Configure(config)
+
+	tests := []struct {
+		name     string
+		target   string
+		expected map[string]string
+	}{
+		{"Defaults fill missing keys", "/pixel.gif", map[string]string{"source": "unknown", "medium": "email"}},
+		{"Request values win", "/pixel.gif?source=newsletter", map[string]string{"source": "newsletter", "medium": "email"}},
+		{"Empty request value still wins", "/pixel.gif?medium=", map[string]string{"source": "unknown", "medium": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tracker.buildTrackingData(httptest.NewRequest("GET", tt.target, nil), "")
+			for key, value := range tt.expected {
+				if got, ok := data.Query[key]; !ok || got != value {
+					t.Errorf("Expected %s=%q, got %q (present: %v)", key, value, got, ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxFunnelSteps bounds the steps param so a request can't make each
+// visitor's scan arbitrarily long.
+const maxFunnelSteps = 20
+
+type FunnelStep struct {
+	Event    string `json:"event"`
+	Visitors int    `json:"visitors"`
+	// DropOff is the share of visitors from the previous step who didn't
+	// reach this one; 0 for the first step.
+	DropOff float64 `json:"drop_off"`
+	// Conversion is the share of visitors from the first step who reached
+	// this one.
+	Conversion float64 `json:"conversion"`
+}
+
+type FunnelReport struct {
+	Steps []FunnelStep `json:"steps"`
+}
+
+// ComputeFunnel counts, per visitor token, how far through steps their
+// events went in order. A visitor reaches a step with an event of that name
+// at or after the one that reached the previous step; other events in
+// between don't matter. Events without a token are ignored.
+func ComputeFunnel(events []TrackingData, steps []string) FunnelReport {
+	byToken := make(map[string][]TrackingData)
+	for _, event := range events {
+		if event.Token != "" {
+			byToken[event.Token] = append(byToken[event.Token], event)
+		}
+	}
+
+	reached := make([]int, len(steps))
+	for _, journey := range byToken {
+		sort.SliceStable(journey, func(i, j int) bool {
+			return journey[i].Timestamp.Before(journey[j].Timestamp)
+		})
+		depth := 0
+		for _, event := range journey {
+			if depth < len(steps) && event.Event == steps[depth] {
+				reached[depth]++
+				depth++
+			}
+		}
+	}
+
+	report := FunnelReport{Steps: make([]FunnelStep, len(steps))}
+	for i, name := range steps {
+		step := FunnelStep{Event: name, Visitors: reached[i]}
+		if i > 0 && reached[i-1] > 0 {
+			step.DropOff = 1 - float64(reached[i])/float64(reached[i-1])
+		}
+		if reached[0] > 0 {
+			step.Conversion = float64(reached[i]) / float64(reached[0])
+		}
+		report.Steps[i] = step
+	}
+	return report
+}
+
+// FunnelHandler serves ComputeFunnel for ?steps=view,cart,purchase.
+func (pt *PixelTracker) FunnelHandler(w http.ResponseWriter, r *http.Request) {
+	var steps []string
+	for _, step := range strings.Split(r.URL.Query().Get("steps"), ",") {
+		if step = strings.TrimSpace(step); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		http.Error(w, "missing steps", http.StatusBadRequest)
+		return
+	}
+	if len(steps) > maxFunnelSteps {
+		http.Error(w, "too many steps", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ComputeFunnel(pt.GetTrackingData(), steps))
+}
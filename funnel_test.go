@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestComputeFunnel(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	journeys := map[string][]string{
+		"complete":     {"view", "cart", "purchase"},
+		"complete-too": {"view", "search", "cart", "view", "purchase"},
+		"abandoned":    {"view", "cart"},
+		"browsed":      {"view", "view"},
+		"browsed-too":  {"view"},
+		"out-of-order": {"cart", "view", "purchase"},
+		"no-view":      {"cart", "purchase"},
+	}
+	var events []TrackingData
+	for token, names := range journeys {
+		for i, name := range names {
+			events = append(events, TrackingData{Token: token, Event: name, Timestamp: start.Add(time.Duration(i) * time.Minute)})
+		}
+	}
+	// Tokenless events can't be followed through the funnel.
+	events = append(events, TrackingData{Event: "view"}, TrackingData{Event: "purchase"})
+
+	report := ComputeFunnel(events, []string{"view", "cart", "purchase"})
+	expected := []FunnelStep{
+		{Event: "view", Visitors: 6, DropOff: 0, Conversion: 1},
+		{Event: "cart", Visitors: 3, DropOff: 0.5, Conversion: 0.5},
+		{Event: "purchase", Visitors: 2, DropOff: 1.0 / 3, Conversion: 2.0 / 6},
+	}
+	if len(report.Steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d", len(expected), len(report.Steps))
+	}
+	for i, want := range expected {
+		got := report.Steps[i]
+		if got.Event != want.Event || got.Visitors != want.Visitors ||
+			math.Abs(got.DropOff-want.DropOff) > 1e-9 || math.Abs(got.Conversion-want.Conversion) > 1e-9 {
+			t.Errorf("Step %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestComputeFunnelEmpty(t *testing.T) {
+	report := ComputeFunnel(nil, []string{"view", "purchase"})
+	for _, step := range report.Steps {
+		if step.Visitors != 0 || step.DropOff != 0 || step.Conversion != 0 {
+			t.Errorf("Expected an empty step, got %+v", step)
+		}
+	}
+}
+
+func TestFunnelHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Event: "view", Timestamp: time.Now()})
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Event: "purchase", Timestamp: time.Now().Add(time.Second)})
+
+	rr := httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/stats/funnel?steps=view,%20purchase", nil))
+	var report FunnelReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(report.Steps) != 2 || report.Steps[1].Event != "purchase" || report.Steps[1].Visitors != 1 {
+		t.Errorf("Unexpected funnel: %+v", report)
+	}
+
+	rr = httptest.NewRecorder()
+	tracker.Router().ServeHTTP(rr, httptest.NewRequest("GET", "/stats/funnel", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without steps, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
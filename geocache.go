@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultGeoCacheSize = 10000
+
+type cachedGeo struct {
+	record  GeoRecord
+	ok      bool
+	expires time.Time
+}
+
+// geoCache remembers recent lookups keyed by the address passed to the
+// resolver, so repeat hits from one IP skip the database. Misses are cached
+// too since unroutable addresses repeat just as often.
+type geoCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries *lruCache[cachedGeo]
+}
+
+func newGeoCache(ttl time.Duration, size int) *geoCache {
+	if size <= 0 {
+		size = defaultGeoCacheSize
+	}
+	return &geoCache{ttl: ttl, entries: newLRUCache[cachedGeo](size)}
+}
+
+func (c *geoCache) get(key string, now time.Time) (GeoRecord, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries.get(key)
+	if !found || !now.Before(entry.expires) {
+		return GeoRecord{}, false, false
+	}
+	return entry.record, entry.ok, true
+}
+
+func (c *geoCache) set(key string, record GeoRecord, ok bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.set(key, cachedGeo{record, ok, now.Add(c.ttl)})
+}
+
+// configureCache enables lookup caching with the given TTL, or disables it
+// when ttl is zero. Any cached results are dropped.
+func (g *geoDB) configureCache(ttl time.Duration, size int) {
+	if ttl <= 0 {
+		g.cache.Store(nil)
+		return
+	}
+	g.cache.Store(newGeoCache(ttl, size))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingGeoResolver counts lookups that reach the database.
+type countingGeoResolver struct {
+	lookups int
+}
+
+func (c *countingGeoResolver) LookupGeo(ip net.IP) (GeoRecord, error) {
+	c.lookups++
+	return GeoRecord{Country: "GB", City: "London"}, nil
+}
+
+func TestGeoCache(t *testing.T) {
+	tracker := NewPixelTracker()
+	resolver := &countingGeoResolver{}
+	tracker.SetGeoResolver(resolver)
+	config := *tracker.config()
+	config.GeoCacheTTL = 50 * time.Millisecond
+	tracker.Configure(config)
+
+	ip := net.ParseIP("81.2.69.142")
+	for i := 0; i < 3; i++ {
+		if record, ok := tracker.geo.lookup(ip, ip.String()); !ok || record.Country != "GB" {
+			t.Fatalf("Expected GB lookup, got %+v (ok=%v)", record, ok)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("Expected repeat lookups to be served from cache, resolver saw %d", resolver.lookups)
+	}
+
+	tracker.geo.lookup(net.ParseIP("203.0.113.1"), "203.0.113.1")
+	if resolver.lookups != 2 {
+		t.Errorf("Expected a different IP to miss the cache, resolver saw %d", resolver.lookups)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	tracker.geo.lookup(ip, ip.String())
+	if resolver.lookups != 3 {
+		t.Errorf("Expected an expired entry to be looked up again, resolver saw %d", resolver.lookups)
+	}
+
+	tracker.SetGeoResolver(resolver)
+	tracker.geo.lookup(ip, ip.String())
+	if resolver.lookups != 4 {
+		t.Errorf("Expected swapping the database to drop the cache, resolver saw %d", resolver.lookups)
+	}
+}
+
+func TestGeoCacheKeyedByStoredIP(t *testing.T) {
+	tracker := NewPixelTracker()
+	resolver := &countingGeoResolver{}
+	tracker.SetGeoResolver(resolver)
+	config := *tracker.config()
+	config.GeoCacheTTL = time.Minute
+	config.AnonymizeIP = true
+	config.HashIP = true
+	tracker.Configure(config)
+
+	var stored []string
+	for _, ip := range []string{"203.0.113.1", "203.0.113.77"} {
+		req := httptest.NewRequest("GET", "/pixel.gif", nil)
+		req.RemoteAddr = ip + ":1234"
+		data := tracker.buildTrackingData(req, "")
+		if data.Geo.Country != "GB" {
+			t.Errorf("Expected a GB lookup for %s, got %+v", ip, data.Geo)
+		}
+		stored = append(stored, data.Geo.IP)
+	}
+
+	if stored[0] != stored[1] {
+		t.Fatalf("Expected both IPs to anonymize to one stored value, got %v", stored)
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("Expected IPs in one /24 to share a cache entry, resolver saw %d", resolver.lookups)
+	}
+	cache := tracker.geo.cache.Load()
+	if n := cache.entries.len(); n != 1 {
+		t.Errorf("Expected 1 cache entry, got %d", n)
+	}
+	for _, key := range []string{"203.0.113.1", "203.0.113.77", "203.0.113.0"} {
+		if _, _, found := cache.get(key, time.Now()); found {
+			t.Errorf("Expected no cache entry under the address %s", key)
+		}
+	}
+	if _, _, found := cache.get(stored[0], time.Now()); !found {
+		t.Error("Expected the entry under the stored (hashed) IP")
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.77":                  "203.0.113.0",
+		"::ffff:203.0.113.77":           "203.0.113.0",
+		"2001:db8:abcd:12:34::1":        "2001:db8:abcd::",
+		"not-an-ip":                     "not-an-ip",
+		"2001:db8:abcd:ffff:ffff::ffff": "2001:db8:abcd::",
+	}
+	for ip, expected := range tests {
+		if got := anonymizeIP(ip); got != expected {
+			t.Errorf("anonymizeIP(%q) = %q, want %q", ip, got, expected)
+		}
+	}
+}
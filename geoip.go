@@ -0,0 +1,180 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoRecord is what a resolver knows about an IP. Region and Metro are
+// left empty when the database has no subdivision or metro data.
+type GeoRecord struct {
+	Country  string
+	City     string
+	Region   string
+	Metro    uint
+	TimeZone string
+}
+
+type GeoResolver interface {
+	LookupGeo(ip net.IP) (GeoRecord, error)
+}
+
+type maxMindCity struct {
+	reader *geoip2.Reader
+}
+
+// OpenGeoDatabase opens a MaxMind GeoLite2-City or GeoIP2-City database.
+func OpenGeoDatabase(path string) (GeoResolver, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &maxMindCity{reader: reader}, nil
+}
+
+func (m *maxMindCity) LookupGeo(ip net.IP) (GeoRecord, error) {
+	record, err := m.reader.City(ip)
+	if err != nil {
+		return GeoRecord{}, err
+	}
+	return cityRecord(record), nil
+}
+
+// cityRecord takes the most general subdivision (state or region) and the
+// metro code, which MaxMind only fills in for the US.
+func cityRecord(record *geoip2.City) GeoRecord {
+	geo := GeoRecord{
+		Country:  record.Country.IsoCode,
+		City:     record.City.Names["en"],
+		Metro:    record.Location.MetroCode,
+		TimeZone: record.Location.TimeZone,
+	}
+	if len(record.Subdivisions) > 0 {
+		geo.Region = record.Subdivisions[0].IsoCode
+	}
+	return geo
+}
+
+func (m *maxMindCity) Close() error {
+	return m.reader.Close()
+}
+
+// geoHandle guards one loaded resolver. Lookups hold the read lock so a
+// replaced database is only closed once in-flight lookups have finished.
+type geoHandle struct {
+	mu       sync.RWMutex
+	resolver GeoResolver
+	closed   bool
+}
+
+// geoDB double-buffers the geo resolver: ReloadGeoIP opens the new database
+// fully before swapping it in, so lookups always see a usable resolver.
+type geoDB struct {
+	current atomic.Pointer[geoHandle]
+	cache   atomic.Pointer[geoCache]
+	open    func(path string) (GeoResolver, error)
+}
+
+func newGeoDB() *geoDB {
+	return &geoDB{open: OpenGeoDatabase}
+}
+
+func (g *geoDB) swap(resolver GeoResolver) {
+	old := g.current.Swap(&geoHandle{resolver: resolver})
+	// Cached results came from the old database.
+	if cache := g.cache.Load(); cache != nil {
+		g.cache.Store(newGeoCache(cache.ttl, cache.entries.capacity))
+	}
+	if old == nil {
+		return
+	}
+	go func() {
+		old.mu.Lock()
+		defer old.mu.Unlock()
+		old.closed = true
+		if closer, ok := old.resolver.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+}
+
+// lookup resolves ip, caching the result under key: the form the IP is
+// stored in, so the cache never holds more of the address than the events
+// do.
+func (g *geoDB) lookup(ip net.IP, key string) (GeoRecord, bool) {
+	cache := g.cache.Load()
+	if cache == nil {
+		return g.resolve(ip)
+	}
+
+	now := time.Now()
+	if record, ok, found := cache.get(key, now); found {
+		return record, ok
+	}
+	record, ok := g.resolve(ip)
+	cache.set(key, record, ok, now)
+	return record, ok
+}
+
+func (g *geoDB) resolve(ip net.IP) (GeoRecord, bool) {
+	for {
+		handle := g.current.Load()
+		if handle == nil {
+			return GeoRecord{}, false
+		}
+
+		handle.mu.RLock()
+		if handle.closed {
+			// Swapped out between Load and RLock; retry on the new one.
+			handle.mu.RUnlock()
+			continue
+		}
+		record, err := handle.resolver.LookupGeo(ip)
+		handle.mu.RUnlock()
+		return record, err == nil
+	}
+}
+
+// ReloadGeoIP opens the database at path and atomically swaps it in. The
+// previous database keeps serving until the swap and is closed afterwards.
+func (pt *PixelTracker) ReloadGeoIP(path string) error {
+	resolver, err := pt.geo.open(path)
+	if err != nil {
+		return err
+	}
+	pt.geo.swap(resolver)
+	return nil
+}
+
+func (pt *PixelTracker) SetGeoResolver(resolver GeoResolver) {
+	pt.geo.swap(resolver)
+}
+
+func (pt *PixelTracker) enrichGeo(data *TrackingData, r *http.Request) {
+	ip := getClientIP(r)
+	data.Geo = GeoInfo{IP: pt.storedIP(ip)}
+
+	// With AnonymizeIP only the truncated address is looked up.
+	if pt.config().AnonymizeIP {
+		ip = anonymizeIP(ip)
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if record, ok := pt.geo.lookup(parsed, data.Geo.IP); ok {
+			data.Geo.Country = record.Country
+			data.Geo.City = record.City
+			data.Geo.Region = record.Region
+			data.Geo.Metro = record.Metro
+			data.Geo.TimeZone = record.TimeZone
+			if record.Country != "" {
+				data.Geo.CountrySource = "geoip"
+			}
+		}
+	}
+	pt.applyCloudflareCountry(&data.Geo, r)
+}
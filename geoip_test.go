@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+type stubGeoResolver struct {
+	country string
+	closed  atomic.Bool
+}
+
+func (s *stubGeoResolver) LookupGeo(ip net.IP) (GeoRecord, error) {
+	if s.closed.Load() {
+		return GeoRecord{}, errors.New("lookup on closed database")
+	}
+	return GeoRecord{Country: s.country, City: "Testville"}, nil
+}
+
+func (s *stubGeoResolver) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestEnrichGeo(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.RemoteAddr = "81.2.69.142:12345"
+
+	data := &TrackingData{}
+	tracker.enrichGeo(data, req)
+	if data.Geo.IP != "81.2.69.142" || data.Geo.Country != "" {
+		t.Errorf("Expected only the IP without a resolver, got %+v", data.Geo)
+	}
+
+	tracker.SetGeoResolver(&stubGeoResolver{country: "GB"})
+	data = &TrackingData{}
+	tracker.enrichGeo(data, req)
+	if data.Geo.Country != "GB" || data.Geo.City != "Testville" {
+		t.Errorf("Expected resolver result, got %+v", data.Geo)
+	}
+}
+
+// fixedGeoResolver returns the same record for every IP.
+type fixedGeoResolver GeoRecord
+
+func (f fixedGeoResolver) LookupGeo(ip net.IP) (GeoRecord, error) {
+	return GeoRecord(f), nil
+}
+
+func TestEnrichGeoRegionMetro(t *testing.T) {
+	tests := []struct {
+		name           string
+		record         GeoRecord
+		expectedRegion string
+		expectedMetro  uint
+	}{
+		{"Region and metro", GeoRecord{Country: "US", City: "Green Bay", Region: "WI", Metro: 658}, "WI", 658},
+		{"No metro data", GeoRecord{Country: "GB", City: "London", Region: "ENG"}, "ENG", 0},
+		{"Country only", GeoRecord{Country: "DE"}, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			tracker.SetGeoResolver(fixedGeoResolver(tt.record))
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = "81.2.69.142:12345"
+
+			data := &TrackingData{}
+			tracker.enrichGeo(data, req)
+			if data.Geo.Region != tt.expectedRegion {
+				t.Errorf("Expected region %q, got %q", tt.expectedRegion, data.Geo.Region)
+			}
+			if data.Geo.Metro != tt.expectedMetro {
+				t.Errorf("Expected metro %d, got %d", tt.expectedMetro, data.Geo.Metro)
+			}
+		})
+	}
+}
+
+func TestCityRecord(t *testing.T) {
+	var full geoip2.City
+	if err := json.Unmarshal([]byte(`{"Country":{"IsoCode":"US"},"Subdivisions":[{"IsoCode":"WI"}],"Location":{"MetroCode":658}}`), &full); err != nil {
+		t.Fatalf("Failed to build city record: %v", err)
+	}
+	if record := cityRecord(&full); record.Region != "WI" || record.Metro != 658 {
+		t.Errorf("Expected region WI and metro 658, got %+v", record)
+	}
+
+	// GeoLite2 outside the US has no metro code and some IPs no subdivision.
+	var sparse geoip2.City
+	if err := json.Unmarshal([]byte(`{"Country":{"IsoCode":"SG"}}`), &sparse); err != nil {
+		t.Fatalf("Failed to build city record: %v", err)
+	}
+	if record := cityRecord(&sparse); record.Country != "SG" || record.Region != "" || record.Metro != 0 {
+		t.Errorf("Expected country only, got %+v", record)
+	}
+}
+
+func TestReloadGeoIPConcurrent(t *testing.T) {
+	tracker := NewPixelTracker()
+	tracker.geo.open = func(path string) (GeoResolver, error) {
+		if path == "missing.mmdb" {
+			return nil, errors.New("no such file")
+		}
+		return &stubGeoResolver{country: path}, nil
+	}
+	if err := tracker.ReloadGeoIP("v0"); err != nil {
+		t.Fatalf("Initial ReloadGeoIP failed: %v", err)
+	}
+
+	var failures int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = "81.2.69.142:12345"
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				data := &TrackingData{}
+				tracker.enrichGeo(data, req)
+				if data.Geo.Country == "" {
+					atomic.AddInt64(&failures, 1)
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 200; i++ {
+		if err := tracker.ReloadGeoIP(fmt.Sprintf("v%d", i)); err != nil {
+			t.Fatalf("ReloadGeoIP failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if failures != 0 {
+		t.Errorf("Expected no failed lookups during reload, got %d", failures)
+	}
+
+	if err := tracker.ReloadGeoIP("missing.mmdb"); err == nil {
+		t.Error("Expected error reloading a missing database")
+	}
+	if record, ok := tracker.geo.lookup(net.ParseIP("81.2.69.142"), "81.2.69.142"); !ok || record.Country != "v200" {
+		t.Errorf("Expected failed reload to keep the previous database, got %+v (ok %v)", record, ok)
+	}
+}
+
+func TestCloudflareCountry(t *testing.T) {
+	tests := []struct {
+		name            string
+		header          string
+		resolver        GeoResolver
+		preferHeader    bool
+		expectedCountry string
+		expectedSource  string
+	}{
+		{"Header present", "de", nil, false, "DE", "cloudflare"},
+		{"Header absent", "", nil, false, "", ""},
+		{"Unknown country", "XX", nil, false, "", ""},
+		{"Tor exit", "T1", nil, false, "", ""},
+		{"Database preferred", "DE", fixedGeoResolver(GeoRecord{Country: "FR"}), false, "FR", "geoip"},
+		{"Header preferred", "DE", fixedGeoResolver(GeoRecord{Country: "FR"}), true, "DE", "cloudflare"},
+		{"Header fills database gap", "DE", fixedGeoResolver(GeoRecord{}), false, "DE", "cloudflare"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.CloudflareCountry = true
+			config.PreferCloudflareCountry = tt.preferHeader
+			tracker.Configure(config)
+			if tt.resolver != nil {
+				tracker.SetGeoResolver(tt.resolver)
+			}
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.RemoteAddr = "81.2.69.142:12345"
+			if tt.header != "" {
+				req.Header.Set("CF-IPCountry", tt.header)
+			}
+			data := &TrackingData{}
+			tracker.enrichGeo(data, req)
+			if data.Geo.Country != tt.expectedCountry || data.Geo.CountrySource != tt.expectedSource {
+				t.Errorf("Expected country %q from %q, got %q from %q",
+					tt.expectedCountry, tt.expectedSource, data.Geo.Country, data.Geo.CountrySource)
+			}
+		})
+	}
+}
+
+func TestCloudflareCountryOff(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("CF-IPCountry", "DE")
+	data := &TrackingData{}
+	tracker.enrichGeo(data, req)
+	if data.Geo.Country != "" {
+		t.Errorf("Expected CF-IPCountry ignored without CloudflareCountry, got %q", data.Geo.Country)
+	}
+}
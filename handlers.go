@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// namedHandler holds either fn or, for handlers registered with
+// UseWithRequest, withRequest.
+type namedHandler struct {
+	name        string
+	fn          func(data *TrackingData)
+	withRequest func(data *TrackingData, rc *RequestContext)
+}
+
+// UseNamed registers a handler under a name that shows up in slow-handler
+// warnings and metrics.
+func (pt *PixelTracker) UseNamed(name string, handler func(data *TrackingData)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.handlers = append(pt.handlers, namedHandler{name: name, fn: handler})
+}
+
+// runHandler calls h and, when it takes longer than SlowHandlerThreshold,
+// logs a warning and counts it.
+func (pt *PixelTracker) runHandler(h namedHandler, data *TrackingData, rc *RequestContext) {
+	threshold := pt.config().SlowHandlerThreshold
+	if threshold <= 0 {
+		h.call(data, rc)
+		return
+	}
+
+	start := time.Now()
+	h.call(data, rc)
+	if elapsed := time.Since(start); elapsed > threshold {
+		log.Printf("Slow handler %q took %v (threshold %v)", h.name, elapsed, threshold)
+		pt.slowHandlers.inc(h.name)
+	}
+}
+
+func (h namedHandler) call(data *TrackingData, rc *RequestContext) {
+	if h.withRequest == nil {
+		h.fn(data)
+		return
+	}
+	if rc == nil {
+		rc = &RequestContext{header: http.Header{}}
+	}
+	h.withRequest(data, rc)
+}
+
+type slowHandlerCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newSlowHandlerCounter() *slowHandlerCounter {
+	return &slowHandlerCounter{counts: make(map[string]int64)}
+}
+
+func (c *slowHandlerCounter) inc(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name]++
+}
+
+func (c *slowHandlerCounter) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for name, n := range c.counts {
+		counts[name] = n
+	}
+	return counts
+}
+
+// defaultHandlerName names handlers registered through Use by position.
+func defaultHandlerName(i int) string {
+	return fmt.Sprintf("handler-%d", i+1)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowHandlerWarning(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.SlowHandlerThreshold = 10 * time.Millisecond
+	tracker.Configure(config)
+
+	tracker.UseNamed("warehouse_export", func(data *TrackingData) {
+		time.Sleep(30 * time.Millisecond)
+	})
+	tracker.UseNamed("fast", func(data *TrackingData) {})
+
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+
+	output := logs.String()
+	if !strings.Contains(output, `Slow handler "warehouse_export"`) {
+		t.Errorf("Expected slow-handler warning naming warehouse_export, got %q", output)
+	}
+	if strings.Contains(output, `"fast"`) {
+		t.Errorf("Expected no warning for the fast handler, got %q", output)
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `pixel_tracker_slow_handlers_total{handler="warehouse_export"} 1`) {
+		t.Errorf("Expected slow handler metric, got:\n%s", rr.Body.String())
+	}
+}
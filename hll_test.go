@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, distinct := range []int{100, 10000, 200000} {
+		t.Run(fmt.Sprint(distinct), func(t *testing.T) {
+			h := newHyperLogLog()
+			for i := 0; i < distinct; i++ {
+				token := fmt.Sprintf("visitor-%d", i)
+				// Repeats must not inflate the estimate.
+				h.add(token)
+				h.add(token)
+			}
+
+			estimate := float64(h.estimate())
+			// Three standard errors for 2^14 registers.
+			margin := 3 * 1.04 / math.Sqrt(1<<hllPrecision)
+			if relErr := math.Abs(estimate-float64(distinct)) / float64(distinct); relErr > margin {
+				t.Errorf("Estimate %v for %d distinct values is off by %.2f%%, want within %.2f%%", estimate, distinct, relErr*100, margin*100)
+			}
+		})
+	}
+}
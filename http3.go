@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// HTTP3Server builds an HTTP/3 server on the configured port (over UDP),
+// serving the same routes and storage as Server.
+func (pt *PixelTracker) HTTP3Server() *http3.Server {
+	return &http3.Server{
+		Addr:      ":" + pt.config().Port,
+		Handler:   pt.Router(),
+		TLSConfig: http3.ConfigureTLSConfig(pt.tlsConfig()),
+	}
+}
+
+// serveWithHTTP3 runs the HTTPS and HTTP/3 servers side by side. HTTPS
+// responses advertise HTTP/3 in Alt-Svc so browsers switch over. It returns
+// when either server stops.
+func (pt *PixelTracker) serveWithHTTP3(certFile, keyFile string) error {
+	h3 := pt.HTTP3Server()
+	server := pt.Server()
+	next := server.Handler
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+
+	errs := make(chan error, 2)
+	go func() { errs <- h3.ListenAndServeTLS(certFile, keyFile) }()
+	go func() { errs <- server.ListenAndServeTLS(certFile, keyFile) }()
+	return <-errs
+}
+
+// requestProto names the negotiated HTTP version the way ALPN does: "h3",
+// "h2" or "http/1.1".
+func requestProto(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 3:
+		return "h3"
+	case 2:
+		return "h2"
+	}
+	return strings.ToLower(r.Proto)
+}
+
+func enrichProto(data *TrackingData, r *http.Request) {
+	data.Proto = requestProto(r)
+}
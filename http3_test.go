@@ -0,0 +1,89 @@
+//go:build http3
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// selfSignedCert issues a certificate for 127.0.0.1 and a pool trusting it.
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pixel-tracker test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestHTTP3Pixel(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableHTTP3 = true
+	tracker.Configure(config)
+
+	cert, pool := selfSignedCert(t)
+	server := tracker.HTTP3Server()
+	server.TLSConfig.Certificates = []tls.Certificate{cert}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	transport := &http3.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	defer transport.Close()
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+
+	resp, err := client.Get("https://" + conn.LocalAddr().String() + "/pixel.gif?event=h3")
+	if err != nil {
+		t.Fatalf("HTTP/3 request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 3 {
+		t.Fatalf("Expected 200 over HTTP/3, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "image/gif" {
+		t.Errorf("Expected the pixel, got %q", contentType)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(data))
+	}
+	if data[0].Proto != "h3" || data[0].Event != "h3" {
+		t.Errorf("Expected an h3 event, got proto %q and event %q", data[0].Proto, data[0].Event)
+	}
+}
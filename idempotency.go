@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"time"
+)
+
+// idempotencyKeyHeader lets clients retrying a POST mark it as a repeat.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKey hashes the request's Idempotency-Key with its tenant and
+// path, so keys from different clients and endpoints don't collide and
+// long keys cost no more memory than short ones. It returns "" for requests
+// without a key.
+func idempotencyKey(r *http.Request, tenant string) string {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || r.Method != http.MethodPost {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(tenant + "\x00" + r.URL.Path + "\x00" + key))
+	return string(sum[:16])
+}
+
+// replayedRequest reports whether the request's Idempotency-Key was already
+// seen within IdempotencyWindow, recording it if not. Replays are
+// acknowledged as if stored, with an Idempotent-Replayed header.
+func (pt *PixelTracker) replayedRequest(w http.ResponseWriter, r *http.Request, tenant string) bool {
+	pt.mu.RLock()
+	seen := pt.idempotency
+	pt.mu.RUnlock()
+	if seen == nil {
+		return false
+	}
+	key := idempotencyKey(r, tenant)
+	if key == "" || !seen.duplicate(key, time.Now()) {
+		return false
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	return true
+}
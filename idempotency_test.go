@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name           string
+		keys           []string
+		expectedStored int
+	}{
+		{"Same key twice", []string{"retry-1", "retry-1"}, 1},
+		{"Different keys", []string{"retry-1", "retry-2"}, 2},
+		{"No key", []string{"", ""}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.IdempotencyWindow = time.Minute
+			tracker.Configure(config)
+
+			for i, key := range tt.keys {
+				req := httptest.NewRequest("POST", "/batch", strings.NewReader(`{"event":"view"}`))
+				req.Header.Set("Content-Type", "application/json")
+				if key != "" {
+					req.Header.Set(idempotencyKeyHeader, key)
+				}
+				rr := httptest.NewRecorder()
+				tracker.BatchHandler(rr, req)
+
+				if rr.Code != http.StatusAccepted {
+					t.Errorf("Request %d: expected status %d, got %d", i, http.StatusAccepted, rr.Code)
+				}
+			}
+			if data := tracker.GetTrackingData(); len(data) != tt.expectedStored {
+				t.Errorf("Expected %d stored events, got %d", tt.expectedStored, len(data))
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyPixel(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.IdempotencyWindow = time.Minute
+	tracker.Configure(config)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/pixel.gif", strings.NewReader("event=view"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(idempotencyKeyHeader, "retry-1")
+		rr := httptest.NewRecorder()
+		tracker.PixelHandler(rr, req)
+
+		replayed := rr.Header().Get("Idempotent-Replayed") == "true"
+		if replayed != (i == 1) {
+			t.Errorf("Request %d: expected replayed=%v, got %v", i, i == 1, replayed)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if data := tracker.GetTrackingData(); len(data) != 1 {
+		t.Errorf("Expected the retried beacon stored once, got %d events", len(data))
+	}
+}
+
+func TestIdempotencyWindowExpires(t *testing.T) {
+	cache := newDedupCache(time.Minute, 2)
+	req := httptest.NewRequest("POST", "/batch", nil)
+	req.Header.Set(idempotencyKeyHeader, "retry-1")
+	key := idempotencyKey(req, "")
+
+	now := time.Now()
+	if cache.duplicate(key, now) {
+		t.Error("Expected the first request to be new")
+	}
+	if !cache.duplicate(key, now.Add(30*time.Second)) {
+		t.Error("Expected a repeat within the window to be a replay")
+	}
+	if cache.duplicate(key, now.Add(2*time.Minute)) {
+		t.Error("Expected a repeat after the window to be stored again")
+	}
+	pixelReq := httptest.NewRequest("POST", "/pixel.gif", nil)
+	pixelReq.Header.Set(idempotencyKeyHeader, "retry-1")
+	if key == idempotencyKey(pixelReq, "") {
+		t.Error("Expected keys to differ by path")
+	}
+}
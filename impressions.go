@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"strings"
+)
+
+// eventsParam lists several event identifiers for one pixel request, e.g.
+// /pixel.gif?events=hero,sidebar,footer.
+const eventsParam = "events"
+
+// defaultMaxEventsPerRequest caps how many events one events param records.
+const defaultMaxEventsPerRequest = 20
+
+func (pt *PixelTracker) maxEventsPerRequest() int {
+	if pt.config().MaxEventsPerRequest > 0 {
+		return pt.config().MaxEventsPerRequest
+	}
+	return defaultMaxEventsPerRequest
+}
+
+// impressionEvents splits the events param, dropping blanks and anything
+// past the cap.
+func (pt *PixelTracker) impressionEvents(raw string) []string {
+	var events []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			events = append(events, name)
+		}
+	}
+	if limit := pt.maxEventsPerRequest(); len(events) > limit {
+		log.Printf("Dropping %d events past the limit of %d per request", len(events)-limit, limit)
+		events = events[:limit]
+	}
+	return events
+}
+
+// storeImpressions records one event per identifier in the events param,
+// each a copy of the enriched data with Event (and the event query param,
+// so the default dedup key tells them apart) set. Requests without the
+// param are stored as they are.
+func (pt *PixelTracker) storeImpressions(ctx context.Context, data *TrackingData) {
+	events := pt.impressionEvents(data.Query[eventsParam])
+	if len(events) == 0 {
+		pt.storeAndDispatchContext(ctx, data)
+		return
+	}
+	for _, name := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		event := *data
+		event.Event = name
+		event.Query = maps.Clone(data.Query)
+		event.Query["event"] = name
+		pt.storeAndDispatchContext(ctx, &event)
+	}
+}
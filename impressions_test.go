@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPixelMultipleEvents(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.DedupWindow = time.Minute
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "/pixel.gif?events=hero,sidebar,,footer&page=home", nil)
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: "visitor"})
+	tracker.PixelHandler(httptest.NewRecorder(), req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 3 {
+		t.Fatalf("Expected 3 events from one request, got %d", len(data))
+	}
+	for i, expected := range []string{"hero", "sidebar", "footer"} {
+		if data[i].Event != expected {
+			t.Errorf("Expected event %d to be %q, got %q", i, expected, data[i].Event)
+		}
+		if data[i].Token != "visitor" || data[i].Query["page"] != "home" {
+			t.Errorf("Expected shared enrichment on %q, got token %q and page %q", expected, data[i].Token, data[i].Query["page"])
+		}
+	}
+	if data[0].ID == data[1].ID {
+		t.Errorf("Expected each event to get its own ID, both got %q", data[0].ID)
+	}
+}
+
+func TestPixelMultipleEventsCap(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxEventsPerRequest = 2
+	tracker.Configure(config)
+
+	tracker.PixelHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/pixel.gif?events=a,b,c,d", nil))
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 2 {
+		t.Fatalf("Expected events past the cap to be dropped, got %d events", len(data))
+	}
+	if data[0].Event != "a" || data[1].Event != "b" {
+		t.Errorf("Expected the first 2 events to be kept, got %q and %q", data[0].Event, data[1].Event)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"time"
+)
+
+// storedIP is the form of a client IP that ends up in TrackingData. With
+// AnonymizeIP the address is truncated first. With HashIP it is an
+// HMAC-SHA256 of the address keyed by IPHashSalt, so equal IPs still count as
+// one without the address being recoverable. Changing the salt starts a new
+// set of hashes; events hashed under the old salt stay valid but no longer
+// match new ones.
+func (pt *PixelTracker) storedIP(ip string) string {
+	if pt.config().AnonymizeIP {
+		ip = anonymizeIP(ip)
+	}
+	return pt.hashIPAt(ip, time.Now())
+}
+
+// anonymizeIP zeroes the host part of an address: the last octet of IPv4 and
+// all but the first 48 bits of IPv6. Anything unparseable is returned as is.
+func anonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.Addr().String()
+}
+
+func (pt *PixelTracker) hashIPAt(ip string, now time.Time) string {
+	if !pt.config().HashIP || ip == "" {
+		return ip
+	}
+
+	mac := hmac.New(sha256.New, pt.ipHashKey(now))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ipHashKey appends the start of the current IPHashRotation period to the
+// salt, so hashes of the same IP only match within one period.
+func (pt *PixelTracker) ipHashKey(now time.Time) []byte {
+	salt := []byte(pt.config().IPHashSalt)
+	if len(salt) == 0 {
+		salt = pt.ipHashSalt
+	}
+	rotation := pt.config().IPHashRotation
+	if rotation <= 0 {
+		return salt
+	}
+
+	period := now.UTC().Truncate(rotation).Format(time.RFC3339)
+	key := make([]byte, 0, len(salt)+len(period))
+	return append(append(key, salt...), period...)
+}
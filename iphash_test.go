@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashIP(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.HashIP = true
+	config.IPHashSalt = "pepper"
+	tracker.Configure(config)
+
+	build := func(ip string) *TrackingData {
+		req := httptest.NewRequest("GET", "/pixel.gif", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		return tracker.buildTrackingData(req, "")
+	}
+
+	first := build("203.0.113.1")
+	second := build("203.0.113.1")
+	other := build("198.51.100.7")
+
+	if first.IP != second.IP {
+		t.Errorf("Expected identical IPs to hash equally, got %q and %q", first.IP, second.IP)
+	}
+	if first.IP == other.IP {
+		t.Errorf("Expected different IPs to hash differently, both got %q", first.IP)
+	}
+	if len(first.IP) != 64 || !isHexString(first.IP) {
+		t.Errorf("Expected a hex SHA-256 hash, got %q", first.IP)
+	}
+
+	tracker.storeAndDispatch(first)
+	stored, err := json.Marshal(tracker.GetTrackingData())
+	if err != nil {
+		t.Fatalf("Failed to marshal stored data: %v", err)
+	}
+	if strings.Contains(string(stored), "203.0.113.1") {
+		t.Errorf("Expected raw IP to be absent from storage, got %s", stored)
+	}
+
+	config.IPHashSalt = "rotated"
+	tracker.Configure(config)
+	if rotated := build("203.0.113.1"); rotated.IP == first.IP {
+		t.Error("Expected a different salt to produce a different hash")
+	}
+}
+
+func TestHashIPRotation(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.HashIP = true
+	config.IPHashSalt = "pepper"
+	config.IPHashRotation = 24 * time.Hour
+	tracker.Configure(config)
+
+	morning := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 3, 2, 0, 1, 0, 0, time.UTC)
+
+	first := tracker.hashIPAt("203.0.113.1", morning)
+	if same := tracker.hashIPAt("203.0.113.1", evening); same != first {
+		t.Errorf("Expected the same hash within a day, got %q and %q", first, same)
+	}
+	if rotated := tracker.hashIPAt("203.0.113.1", nextDay); rotated == first {
+		t.Error("Expected a different hash after the salt rotates")
+	}
+
+	config.IPHashRotation = time.Hour
+	tracker.Configure(config)
+	if hourly := tracker.hashIPAt("203.0.113.1", morning.Add(time.Hour)); hourly == tracker.hashIPAt("203.0.113.1", morning) {
+		t.Error("Expected an hourly rotation to change the hash after an hour")
+	}
+
+	config.IPHashRotation = 0
+	tracker.Configure(config)
+	if tracker.hashIPAt("203.0.113.1", morning) != tracker.hashIPAt("203.0.113.1", nextDay) {
+		t.Error("Expected a static salt without rotation")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// VisitorJourney returns the events recorded for a visitor token, oldest
+// first.
+func (pt *PixelTracker) VisitorJourney(token string) []TrackingData {
+	var journey []TrackingData
+	for _, event := range pt.GetTrackingData() {
+		if event.Token == token {
+			journey = append(journey, event)
+		}
+	}
+	sort.SliceStable(journey, func(i, j int) bool {
+		return journey[i].Timestamp.Before(journey[j].Timestamp)
+	})
+	return journey
+}
+
+func (pt *PixelTracker) JourneyHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+
+	journey := pt.VisitorJourney(token)
+	if journey == nil {
+		journey = []TrackingData{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(journey)
+}
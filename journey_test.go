@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVisitorJourney(t *testing.T) {
+	tracker := NewPixelTracker()
+	start := time.Now()
+
+	// Stored out of order and interleaved with another visitor.
+	events := []TrackingData{
+		{Token: "alice", Path: "/checkout", Event: "purchase", Timestamp: start.Add(3 * time.Second)},
+		{Token: "bob", Path: "/home", Timestamp: start.Add(time.Second)},
+		{Token: "alice", Path: "/home", Referer: "https://search.example", Timestamp: start},
+		{Token: "bob", Path: "/pricing", Timestamp: start.Add(2 * time.Second)},
+		{Token: "alice", Path: "/pricing", Referer: "https://example.com/home", Timestamp: start.Add(2 * time.Second)},
+	}
+	for _, event := range events {
+		tracker.storeAndDispatch(&event)
+	}
+
+	journey := tracker.VisitorJourney("alice")
+	var paths []string
+	for _, event := range journey {
+		if event.Token != "alice" {
+			t.Errorf("Expected only alice's events, got token %q", event.Token)
+		}
+		paths = append(paths, event.Path)
+	}
+
+	expected := []string{"/home", "/pricing", "/checkout"}
+	if !slicesEqual(paths, expected) {
+		t.Errorf("Expected journey %v, got %v", expected, paths)
+	}
+	if journey[2].Event != "purchase" {
+		t.Errorf("Expected last event to be purchase, got %q", journey[2].Event)
+	}
+}
+
+func TestJourneyHandlerRequiresAdmin(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	tracker.Configure(config)
+	tracker.storeAndDispatch(&TrackingData{Token: "alice", Path: "/home", Timestamp: time.Now()})
+
+	handler := tracker.requireAdmin(tracker.JourneyHandler)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/stats/journey?token=alice", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without admin token, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/stats/journey?token=alice", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d with admin token, got %d", http.StatusOK, rr.Code)
+	}
+
+	var journey []TrackingData
+	if err := json.Unmarshal(rr.Body.Bytes(), &journey); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(journey) != 1 || journey[0].Path != "/home" {
+		t.Errorf("Expected alice's single event, got %+v", journey)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultKafkaBufferSize is how many events wait for the broker before new
+// ones are dropped.
+const defaultKafkaBufferSize = 10000
+
+const (
+	kafkaRetryMin = 100 * time.Millisecond
+	kafkaRetryMax = 5 * time.Second
+	// kafkaBatchSize caps how many queued events go out in one write.
+	kafkaBatchSize = 500
+	// kafkaBatchTimeout is how long the writer waits to fill a batch. The
+	// sink already hands it everything that is queued, so keep it short.
+	kafkaBatchTimeout = 10 * time.Millisecond
+	// kafkaMaxAttempts bounds retries of messages the broker rejects for
+	// good, such as ones over its size limit.
+	kafkaMaxAttempts = 5
+)
+
+// KafkaProducer publishes a batch of messages. It is satisfied by a kafka-go
+// Writer through kafkaWriter and can be swapped for tests. When only some
+// messages fail it returns kafka.WriteErrors, one entry per message.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, messages []kafka.Message) error
+}
+
+type kafkaWriter struct {
+	writer *kafka.Writer
+}
+
+func (k kafkaWriter) Produce(ctx context.Context, topic string, messages []kafka.Message) error {
+	for i := range messages {
+		messages[i].Topic = topic
+	}
+	return k.writer.WriteMessages(ctx, messages...)
+}
+
+// kafkaSink queues encoded events and publishes them from one goroutine, so
+// handlers never wait on the broker. While the broker is down the queue
+// absorbs events and the sink retries with backoff; once the queue is full,
+// new events are dropped and counted. While the breaker is open the sink
+// stops writing and waits out its cooldown. close publishes what is still
+// queued before the sink stops.
+type kafkaSink struct {
+	producer KafkaProducer
+	breaker  *circuitBreaker
+	topic    string
+	codec    Codec
+	queue    chan kafka.Message
+
+	// ctx is cancelled when close gives up on flushing, which aborts the
+	// write in flight and any retries.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	// flushes asks run to publish everything queued and then close the
+	// channel it was sent.
+	flushes chan chan struct{}
+
+	published atomic.Int64
+	failures  atomic.Int64
+	dropped   atomic.Int64
+}
+
+func newKafkaSink(producer KafkaProducer, breaker *circuitBreaker, topic string, codec Codec, bufferSize int) *kafkaSink {
+	if bufferSize <= 0 {
+		bufferSize = defaultKafkaBufferSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &kafkaSink{
+		producer: producer,
+		breaker:  breaker,
+		topic:    topic,
+		codec:    codec,
+		queue:    make(chan kafka.Message, bufferSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		flushes:  make(chan chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// publish encodes the event keyed by visitor token, which keeps each
+// visitor's events on one partition.
+func (s *kafkaSink) publish(data *TrackingData) {
+	value, err := s.codec.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode event for Kafka: %v", err)
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case <-s.stop:
+		s.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case s.queue <- kafka.Message{Key: []byte(data.Token), Value: value}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run publishes whatever is queued, up to kafkaBatchSize messages per write,
+// until close is called; then it publishes what is left and returns.
+func (s *kafkaSink) run() {
+	defer close(s.done)
+	batch := make([]kafka.Message, 0, kafkaBatchSize)
+	drain := func() {
+		for {
+			select {
+			case msg := <-s.queue:
+				s.send(s.fill(append(batch[:0], msg)))
+			default:
+				return
+			}
+		}
+	}
+	for {
+		select {
+		case msg := <-s.queue:
+			s.send(s.fill(append(batch[:0], msg)))
+		case flushed := <-s.flushes:
+			drain()
+			close(flushed)
+		case <-s.stop:
+			drain()
+			return
+		}
+	}
+}
+
+// flush waits until everything queued so far has been published, or ctx
+// ends. Unlike close, the sink keeps running.
+func (s *kafkaSink) flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case s.flushes <- flushed:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fill adds queued messages to batch without waiting, up to kafkaBatchSize.
+func (s *kafkaSink) fill(batch []kafka.Message) []kafka.Message {
+	for len(batch) < kafkaBatchSize {
+		select {
+		case msg := <-s.queue:
+			batch = append(batch, msg)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// close stops taking new events and publishes the queued ones. If ctx ends
+// first, the rest are dropped and ctx's error is returned.
+func (s *kafkaSink) close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		return ctx.Err()
+	}
+}
+
+// send writes batch, retrying failed messages with backoff. Temporary
+// failures such as an unreachable broker are retried until they succeed, so
+// the queue absorbs outages; messages rejected for good are dropped after
+// kafkaMaxAttempts so they don't hold up everything behind them. Once the
+// sink is aborted the batch is dropped.
+func (s *kafkaSink) send(batch []kafka.Message) {
+	backoff := kafkaRetryMin
+	for attempt := 1; len(batch) > 0; attempt++ {
+		if !s.breaker.wait(s.ctx) {
+			s.dropped.Add(int64(len(batch)))
+			return
+		}
+		err := s.producer.Produce(s.ctx, s.topic, batch)
+		if err == nil {
+			s.breaker.success()
+			s.published.Add(int64(len(batch)))
+			return
+		}
+		s.failures.Add(1)
+
+		errs := messageErrors(err, len(batch))
+		if brokerUnavailable(errs) {
+			s.breaker.failure()
+		} else {
+			s.breaker.success()
+		}
+		var retry []kafka.Message
+		for i, msgErr := range errs {
+			switch {
+			case msgErr == nil:
+				s.published.Add(1)
+			case attempt >= kafkaMaxAttempts && !retryableKafkaError(msgErr):
+				log.Printf("Dropping Kafka message after %d attempts: %v", attempt, msgErr)
+				s.dropped.Add(1)
+			default:
+				retry = append(retry, batch[i])
+			}
+		}
+		batch = retry
+		if len(batch) == 0 {
+			return
+		}
+		log.Printf("Kafka publish failed for %d of %d events, retrying in %v: %v", len(batch), len(errs), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			s.dropped.Add(int64(len(batch)))
+			return
+		}
+		backoff = min(backoff*2, kafkaRetryMax)
+	}
+}
+
+// messageErrors spreads a write error over the n messages of the batch.
+func messageErrors(err error, n int) []error {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == n {
+		return writeErrs
+	}
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// brokerUnavailable reports whether every message failed with a temporary
+// error. Messages rejected for good don't say anything about the broker.
+func brokerUnavailable(errs []error) bool {
+	for _, err := range errs {
+		if err == nil || !retryableKafkaError(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// retryableKafkaError reports whether err may go away on its own. Broker
+// errors say so themselves; network errors and anything unrecognised are
+// assumed temporary.
+func retryableKafkaError(err error) bool {
+	var tooLarge kafka.MessageTooLargeError
+	if errors.As(err, &tooLarge) {
+		return false
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	return true
+}
+
+func (s *kafkaSink) writeMetrics(w io.Writer, openMetrics bool) {
+	fmt.Fprintln(w, "# HELP pixel_tracker_kafka_queued_events Events waiting to be published to Kafka.")
+	fmt.Fprintln(w, "# TYPE pixel_tracker_kafka_queued_events gauge")
+	fmt.Fprintf(w, "pixel_tracker_kafka_queued_events %d\n", len(s.queue))
+	writeCounterHeader(w, "pixel_tracker_kafka_published_total", "Events published to Kafka.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_kafka_published_total %d\n", s.published.Load())
+	writeCounterHeader(w, "pixel_tracker_kafka_failures_total", "Failed Kafka publish attempts.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_kafka_failures_total %d\n", s.failures.Load())
+	writeCounterHeader(w, "pixel_tracker_kafka_dropped_total", "Events dropped because the Kafka queue was full or the broker rejected them.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_kafka_dropped_total %d\n", s.dropped.Load())
+}
+
+// StartKafka publishes every stored event to KafkaTopic on KafkaBrokers,
+// encoded with StorageCodec.
+func (pt *PixelTracker) StartKafka() error {
+	if len(pt.config().KafkaBrokers) == 0 || pt.config().KafkaTopic == "" {
+		return errors.New("KafkaBrokers and KafkaTopic are required")
+	}
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(pt.config().KafkaBrokers...),
+		Balancer:     &kafka.Hash{},
+		BatchSize:    kafkaBatchSize,
+		BatchTimeout: kafkaBatchTimeout,
+	}
+	return pt.startKafkaSink(kafkaWriter{writer})
+}
+
+func (pt *PixelTracker) startKafkaSink(producer KafkaProducer) error {
+	codec, err := pt.storageCodec()
+	if err != nil {
+		return err
+	}
+	sink := newKafkaSink(producer, pt.newBreaker("kafka"), pt.config().KafkaTopic, codec, pt.config().KafkaBufferSize)
+
+	pt.mu.Lock()
+	pt.kafka = sink
+	pt.mu.Unlock()
+	pt.UseNamed("kafka", sink.publish)
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type publishedMessage struct {
+	topic string
+	key   string
+	value []byte
+}
+
+type mockProducer struct {
+	mu       sync.Mutex
+	failures int
+	messages []publishedMessage
+	batches  []int
+	block    chan struct{}
+	// reject fails individual messages, as the broker does for ones over
+	// its size limit.
+	reject func(kafka.Message) error
+}
+
+func (m *mockProducer) Produce(ctx context.Context, topic string, messages []kafka.Message) error {
+	if m.block != nil {
+		select {
+		case <-m.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, len(messages))
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("broker unavailable")
+	}
+
+	errs := make(kafka.WriteErrors, len(messages))
+	failed := false
+	for i, msg := range messages {
+		if m.reject != nil {
+			if errs[i] = m.reject(msg); errs[i] != nil {
+				failed = true
+				continue
+			}
+		}
+		m.messages = append(m.messages, publishedMessage{topic, string(msg.Key), msg.Value})
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+func (m *mockProducer) published() []publishedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]publishedMessage(nil), m.messages...)
+}
+
+func TestKafkaSink(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.KafkaTopic = "pixel-events"
+	tracker.Configure(config)
+
+	// The broker is down for the first attempt; the event must still arrive.
+	producer := &mockProducer{failures: 1}
+	if err := tracker.startKafkaSink(producer); err != nil {
+		t.Fatalf("startKafkaSink() returned error: %v", err)
+	}
+
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor-a", Path: "/welcome", Timestamp: time.Now()})
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor-b", Path: "/pricing", Timestamp: time.Now()})
+
+	time.Sleep(300 * time.Millisecond)
+
+	messages := producer.published()
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 published events, got %d", len(messages))
+	}
+	for i, expected := range []struct{ key, path string }{{"visitor-a", "/welcome"}, {"visitor-b", "/pricing"}} {
+		if messages[i].topic != "pixel-events" {
+			t.Errorf("Expected topic pixel-events, got %q", messages[i].topic)
+		}
+		if messages[i].key != expected.key {
+			t.Errorf("Expected key %q, got %q", expected.key, messages[i].key)
+		}
+		var event TrackingData
+		if err := json.Unmarshal(messages[i].value, &event); err != nil {
+			t.Fatalf("Failed to unmarshal published event: %v", err)
+		}
+		if event.Path != expected.path {
+			t.Errorf("Expected path %q, got %q", expected.path, event.Path)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{"pixel_tracker_kafka_published_total 2", "pixel_tracker_kafka_failures_total 1"} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestKafkaSinkBufferFull(t *testing.T) {
+	producer := &mockProducer{block: make(chan struct{})}
+	sink := newKafkaSink(producer, newCircuitBreaker("kafka", 0, 0), "pixel-events", jsonCodec{}, 2)
+
+	// One event is held by the blocked producer, two fill the queue.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		sink.publish(&TrackingData{Token: "visitor"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected publish not to block on the broker, took %v", elapsed)
+	}
+	if dropped := sink.dropped.Load(); dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+	close(producer.block)
+}
+
+func TestKafkaSinkBatches(t *testing.T) {
+	producer := &mockProducer{block: make(chan struct{})}
+	sink := newKafkaSink(producer, newCircuitBreaker("kafka", 0, 0), "pixel-events", jsonCodec{}, 1000)
+
+	// Events queue up behind the blocked producer; they must go out
+	// together rather than one write each.
+	for i := 0; i < 201; i++ {
+		sink.publish(&TrackingData{Token: "visitor"})
+	}
+	close(producer.block)
+	time.Sleep(200 * time.Millisecond)
+
+	producer.mu.Lock()
+	batches := append([]int(nil), producer.batches...)
+	producer.mu.Unlock()
+	if len(batches) > 2 {
+		t.Errorf("Expected the queued events to go out in at most 2 writes, got %v", batches)
+	}
+	if published := sink.published.Load(); published != 201 {
+		t.Errorf("Expected 201 published events, got %d", published)
+	}
+}
+
+func TestKafkaSinkGivesUpOnRejectedMessage(t *testing.T) {
+	producer := &mockProducer{
+		block: make(chan struct{}),
+		reject: func(msg kafka.Message) error {
+			if string(msg.Key) == "huge" {
+				return kafka.MessageTooLargeError{}
+			}
+			return nil
+		},
+	}
+	sink := newKafkaSink(producer, newCircuitBreaker("kafka", 0, 0), "pixel-events", jsonCodec{}, 100)
+
+	sink.publish(&TrackingData{Token: "first"})
+	sink.publish(&TrackingData{Token: "huge"})
+	sink.publish(&TrackingData{Token: "after"})
+	close(producer.block)
+
+	// Five attempts with backoff take 100+200+400+800ms.
+	deadline := time.Now().Add(3 * time.Second)
+	for sink.dropped.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if dropped := sink.dropped.Load(); dropped != 1 {
+		t.Fatalf("Expected the rejected message to be dropped, got %d dropped", dropped)
+	}
+
+	sink.publish(&TrackingData{Token: "later"})
+	time.Sleep(100 * time.Millisecond)
+	var keys []string
+	for _, msg := range producer.published() {
+		keys = append(keys, msg.key)
+	}
+	if strings.Join(keys, ",") != "first,after,later" {
+		t.Errorf("Expected the other messages to be published, got %v", keys)
+	}
+}
+
+func TestRetryableKafkaError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Too large", kafka.MessageTooLargeError{}, false},
+		{"Leader unavailable", kafka.LeaderNotAvailable, true},
+		{"Invalid topic", kafka.InvalidTopic, false},
+		{"Network", errors.New("connection refused"), true},
+	}
+	for _, tt := range tests {
+		if got := retryableKafkaError(tt.err); got != tt.expected {
+			t.Errorf("%s: retryableKafkaError() = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
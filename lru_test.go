@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := newLRUCache[int](3)
+
+	cache.set("a", 1)
+	cache.set("b", 2)
+	cache.set("c", 3)
+	// Touch "a" so "b" becomes the least recently used.
+	cache.get("a")
+	cache.set("d", 4)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected least recently used key b to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("Expected key %s to be kept", key)
+		}
+	}
+	if cache.evictions != 1 {
+		t.Errorf("Expected 1 eviction, got %d", cache.evictions)
+	}
+}
+
+func TestCardinalityCap(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.VelocityThreshold = 5
+	config.VelocityWindow = time.Minute
+	config.MaxVelocityKeys = 50
+	config.DedupWindow = time.Minute
+	config.MaxDedupKeys = 20
+	tracker.Configure(config)
+
+	for i := 0; i < 500; i++ {
+		tracker.storeAndDispatch(&TrackingData{IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Token: fmt.Sprint(i)})
+	}
+
+	// Each event adds an IP and a token key to the velocity map.
+	if keys, evictions := tracker.velocity.cardinality(); keys != 50 || evictions != 950 {
+		t.Errorf("Expected velocity map capped at 50 keys with 950 evictions, got %d keys and %d evictions", keys, evictions)
+	}
+	if keys, evictions := tracker.dedup.cardinality(); keys != 20 || evictions != 480 {
+		t.Errorf("Expected dedup map capped at 20 keys with 480 evictions, got %d keys and %d evictions", keys, evictions)
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`pixel_tracker_tracked_keys{map="velocity"} 50`,
+		`pixel_tracker_tracked_keys{map="dedup"} 20`,
+		`pixel_tracker_evicted_keys_total{map="dedup"} 480`,
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
@@ -1,22 +1,29 @@
 package main
 
 import (
-	"crypto/md5"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/publicsuffix"
 )
 
 var pixel1x1 = []byte{
@@ -26,153 +33,822 @@ var pixel1x1 = []byte{
 	0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
 }
 
+// pixelWebP is a fully transparent 1x1 lossless WebP. It is smaller than the
+// GIF but not rendered by some older email clients, so GIF stays the default.
+var pixelWebP = []byte{
+	0x52, 0x49, 0x46, 0x46, 0x1a, 0x00, 0x00, 0x00, 0x57, 0x45, 0x42, 0x50,
+	0x56, 0x50, 0x38, 0x4c, 0x0d, 0x00, 0x00, 0x00, 0x2f, 0x00, 0x00, 0x00,
+	0x10, 0x07, 0x10, 0x11, 0x11, 0x88, 0x88, 0xfe, 0x07, 0x00,
+}
+
+type pixelImage struct {
+	contentType string
+	body        []byte
+}
+
+var pixelFormats = map[string]pixelImage{
+	"gif":  {"image/gif", pixel1x1},
+	"webp": {"image/webp", pixelWebP},
+}
+
+func pixelFor(format string) pixelImage {
+	if img, ok := pixelFormats[format]; ok {
+		return img
+	}
+	return pixelFormats["gif"]
+}
+
 type Config struct {
-	DisableCookies bool
-	MaxAge         int
-	CookieName     string
-	TrackIP        bool
-	Port           string
+	DisableCookies           bool
+	MaxAge                   int
+	CookieName               string
+	TrackIP                  bool
+	Port                     string
+	ResponseJitter           time.Duration
+	MaxConcurrent            int
+	RejectOverload           bool
+	PayloadParam             string
+	EnableDebugEndpoints     bool
+	ClockSkew                time.Duration
+	StorageCodec             string
+	TokenBytes               int
+	VelocityThreshold        int
+	VelocityWindow           time.Duration
+	MaxVelocityKeys          int
+	PixelFormat              string
+	FirstPartyCookie         bool
+	MaxQueryWindow           time.Duration
+	RecordTimings            bool
+	TrackNotFound            bool
+	CookieAllowlist          []string
+	CaptureHeaders           []string
+	EnableSampling           bool
+	SampleRate               float64
+	AlwaysKeepEvents         []string
+	ProcessTimeout           time.Duration
+	EnableTracing            bool
+	RefererParam             string
+	DedupWindow              time.Duration
+	DedupKeyFields           []string
+	MaxDedupKeys             int
+	ResponseHeaders          map[string]string
+	OverrideProtectedHeaders bool
+	AdminToken               string
+	HashIP                   bool
+	IPHashSalt               string
+	EventSchema              EventSchema
+	FieldMapping             map[string]string
+	SnippetEndpoint          string
+	RateLimit                RateLimit
+	PathRateLimits           map[string]RateLimit
+	EnableQueryCache         bool
+	QueryCacheTTL            time.Duration
+	SlowHandlerThreshold     time.Duration
+	Tenant                   string
+	GeoCacheTTL              time.Duration
+	GeoCacheSize             int
+	MaxBodyBytes             int64
+	EnableCohorts            bool
+	CookieSecret             string
+	MinTLSVersion            uint16
+	IPHashRotation           time.Duration
+	CaptureNetworkHints      bool
+	StoragePartition         string
+	Retention                time.Duration
+	RetentionByEvent         map[string]time.Duration
+	IdempotencyWindow        time.Duration
+	MaxIdempotencyKeys       int
+	ParseReferer             bool
+	ErrorPixelRoutes         []string
+	PrecomputeSummary        bool
+	CaptureFormBody          bool
+	MaxParams                int
+	MaxEventsPerRequest      int
+	DefaultParams            map[string]string
+	NormalizePaths           bool
+	PersistDedup             bool
+	RespectSaveData          bool
+	TenantKeys               map[string]string
+	KafkaBrokers             []string
+	KafkaTopic               string
+	KafkaBufferSize          int
+	MinRenderTime            time.Duration
+	CaptureRawQuery          bool
+	UABlocklist              []string
+	RespectDNT               bool
+	ConsentCookie            string
+	RequireConsent           bool
+	RecordWithoutConsent     bool
+	SuppressedContentType    string
+	SuppressedBody           string
+	MaxEventBytes            int
+	TrackTouchpoints         bool
+	MaxTouchpointKeys        int
+	S3Bucket                 string
+	S3Prefix                 string
+	S3Endpoint               string
+	S3Region                 string
+	S3AccessKey              string
+	S3SecretKey              string
+	S3Insecure               bool
+	S3FlushInterval          time.Duration
+	S3MaxObjectBytes         int
+	S3MaxPending             int
+	FeatureAllowlist         []string
+	CloudflareCountry        bool
+	PreferCloudflareCountry  bool
+	ConversionEvents         []string
+	AttributionWindow        time.Duration
+	EnableHTTP3              bool
+	VisitorEventCap          int
+	VisitorCapWindow         time.Duration
+	MaxVisitorCapKeys        int
+	KeepOverCap              bool
+	CaptureTimezone          bool
+	SampleDebugParam         string
+	SampleNoTrackParam       string
+	EnableChecksum           bool
+	ChecksumSecret           string
+	CaptureFetchMetadata     bool
+	BlockedTokens            []string
+	LanguageByCountry        map[string]string
+	CacheForBots             time.Duration
+	ExcludeIPs               []string
+	ExcludeSelf              bool
+	BreakerThreshold         int
+	BreakerCooldown          time.Duration
+	CursorSecret             string
+	AnonymizeIP              bool
 }
 
 type TrackingData struct {
-	Cookies   map[string]string `json:"cookies"`
-	Host      string            `json:"host"`
-	Path      string            `json:"path"`
-	Referer   string            `json:"referer"`
-	Params    map[string]string `json:"params"`
-	Query     map[string]string `json:"query"`
-	IP        string            `json:"ip,omitempty"`
-	Decay     int64             `json:"decay"`
-	UserAgent BrowserInfo       `json:"useragent"`
-	Language  []string          `json:"language"`
-	Geo       GeoInfo           `json:"geo"`
-	Domain    string            `json:"domain"`
-	Timestamp time.Time         `json:"timestamp"`
+	ID               string                   `json:"id"`
+	Cookies          map[string]string        `json:"cookies"`
+	Host             string                   `json:"host"`
+	Path             string                   `json:"path"`
+	RawPath          string                   `json:"raw_path,omitempty"`
+	Referer          string                   `json:"referer"`
+	RefererSource    string                   `json:"referer_source,omitempty"`
+	RefererStripped  bool                     `json:"referer_stripped,omitempty"`
+	RefererInfo      *RefererInfo             `json:"referer_info,omitempty"`
+	FirstReferer     string                   `json:"first_referer,omitempty"`
+	LastReferer      string                   `json:"last_referer,omitempty"`
+	Origin           string                   `json:"origin,omitempty"`
+	Params           map[string]string        `json:"params"`
+	Query            map[string]string        `json:"query"`
+	RawQuery         string                   `json:"raw_query,omitempty"`
+	Event            string                   `json:"event,omitempty"`
+	IP               string                   `json:"ip,omitempty"`
+	Decay            int64                    `json:"decay"`
+	UserAgent        BrowserInfo              `json:"useragent"`
+	IsBot            bool                     `json:"is_bot,omitempty"`
+	RenderTime       int                      `json:"render_time,omitempty"`
+	LikelySynthetic  bool                     `json:"likely_synthetic,omitempty"`
+	TimezoneOffset   *int                     `json:"timezone_offset,omitempty"`
+	TimezoneMismatch bool                     `json:"timezone_mismatch,omitempty"`
+	Language         []string                 `json:"language"`
+	LanguageInferred bool                     `json:"language_inferred,omitempty"`
+	Geo              GeoInfo                  `json:"geo"`
+	Domain           string                   `json:"domain"`
+	Token            string                   `json:"token,omitempty"`
+	Tenant           string                   `json:"tenant,omitempty"`
+	NewVisitor       bool                     `json:"new_visitor"`
+	Cohort           string                   `json:"cohort,omitempty"`
+	CookieBlocked    bool                     `json:"cookie_blocked,omitempty"`
+	Consentless      bool                     `json:"consentless,omitempty"`
+	TLS              *TLSInfo                 `json:"tls,omitempty"`
+	Proto            string                   `json:"proto,omitempty"`
+	Network          *Network                 `json:"network,omitempty"`
+	FetchMeta        *FetchMeta               `json:"fetch_meta,omitempty"`
+	SaveData         bool                     `json:"save_data,omitempty"`
+	Payload          map[string]any           `json:"payload,omitempty"`
+	PayloadInvalid   bool                     `json:"payload_invalid,omitempty"`
+	Truncated        bool                     `json:"truncated,omitempty"`
+	Engagement       *Engagement              `json:"engagement,omitempty"`
+	PixelSize        *PixelSize               `json:"pixel_size,omitempty"`
+	Timestamp        time.Time                `json:"timestamp"`
+	ReceivedAt       time.Time                `json:"received_at"`
+	ClientTimestamp  *time.Time               `json:"client_timestamp,omitempty"`
+	HighVelocity     bool                     `json:"high_velocity,omitempty"`
+	OverCap          bool                     `json:"over_cap,omitempty"`
+	Overloaded       bool                     `json:"overloaded,omitempty"`
+	Timings          map[string]time.Duration `json:"timings,omitempty"`
+	Headers          map[string]string        `json:"headers,omitempty"`
+	SampleRate       float64                  `json:"sample_rate,omitempty"`
+	DedupKey         string                   `json:"dedup_key,omitempty"`
+	Checksum         string                   `json:"checksum,omitempty"`
 }
 
 type BrowserInfo struct {
-	Browser string `json:"browser"`
-	Version string `json:"version"`
+	Browser  string `json:"browser"`
+	Version  string `json:"version"`
+	Platform string `json:"platform,omitempty"`
+	Mobile   bool   `json:"mobile,omitempty"`
+	Source   string `json:"source,omitempty"`
+}
+
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
 }
 
 type GeoInfo struct {
-	IP string `json:"ip"`
+	IP              string `json:"ip"`
+	Country         string `json:"country,omitempty"`
+	CountryInferred bool   `json:"country_inferred,omitempty"`
+	CountrySource   string `json:"country_source,omitempty"`
+	City            string `json:"city,omitempty"`
+	Region          string `json:"region,omitempty"`
+	Metro           uint   `json:"metro,omitempty"`
+	TimeZone        string `json:"time_zone,omitempty"`
+	ASN             uint   `json:"asn,omitempty"`
+	ASNOrg          string `json:"asn_org,omitempty"`
+	Datacenter      bool   `json:"datacenter,omitempty"`
 }
 
 type PixelTracker struct {
-	config    Config
-	handlers  []func(data *TrackingData)
-	dataStore *DataStore
-	mu        sync.RWMutex
+	cfg            atomic.Pointer[Config]
+	handlers       []namedHandler
+	enrichers      []namedEnricher
+	asnResolver    ASNResolver
+	auditLogger    AuditLogger
+	geo            *geoDB
+	velocity       *velocityCounter
+	dedup          *dedupCache
+	idempotency    *dedupCache
+	touchpoints    *touchpointCache
+	visitorCap     *visitorCapCounter
+	limiter        *rateLimiter
+	timings        *timingRecorder
+	requests       *requestHistogram
+	slowHandlers   *slowHandlerCounter
+	cursorKey      []byte
+	ipHashSalt     []byte
+	tracerProvider trace.TracerProvider
+	dataStore      *DataStore
+	storage        Storage
+	queryCache     *queryCache
+	aggregates     *summaryAggregates
+	kafka          *kafkaSink
+	s3             *s3Exporter
+	breakers       []*circuitBreaker
+	slots          chan struct{}
+	overloaded     int64
+	blockedUA      int64
+	cappedEvents   int64
+	uaBlocklist    []*regexp.Regexp
+	blockedTokens  map[string]struct{}
+	excludedIPs    []netip.Prefix
+	mu             sync.RWMutex
 }
 
 type DataStore struct {
 	data []TrackingData
+	byID map[string]int
 	mu   sync.RWMutex
 }
 
 func NewPixelTracker() *PixelTracker {
-	return &PixelTracker{
-		config: Config{
-			DisableCookies: false,
-			MaxAge:         2592000,
-			CookieName:     "_tracker",
-			TrackIP:        true,
-			Port:           "8080",
-		},
-		handlers:  []func(data *TrackingData){},
+	pt := &PixelTracker{
+		handlers:  []namedHandler{},
 		dataStore: &DataStore{data: []TrackingData{}},
 	}
+	pt.cfg.Store(&Config{
+		DisableCookies: false,
+		MaxAge:         2592000,
+		CookieName:     "_tracker",
+		TrackIP:        true,
+		Port:           "8080",
+	})
+	pt.storage = pt.dataStore
+	pt.enrichers = pt.defaultEnrichers()
+	pt.timings = newTimingRecorder()
+	pt.requests = newRequestHistogram()
+	pt.slowHandlers = newSlowHandlerCounter()
+	pt.geo = newGeoDB()
+	pt.cursorKey = make([]byte, 32)
+	cryptorand.Read(pt.cursorKey)
+	// Used when HashIP is on without an IPHashSalt, so hashes are only
+	// comparable within one process.
+	pt.ipHashSalt = make([]byte, 32)
+	cryptorand.Read(pt.ipHashSalt)
+	return pt
+}
+
+// config returns the current configuration. Configure swaps in a new one
+// instead of writing over it, so requests still being processed in the
+// background can read it without a lock. Callers must not modify it.
+func (pt *PixelTracker) config() *Config {
+	return pt.cfg.Load()
 }
 
-func (pt *PixelTracker) Configure(config Config) {
+// Configure replaces the configuration. It returns an error and keeps the
+// previous configuration when config is invalid.
+func (pt *PixelTracker) Configure(config Config) error {
+	uaBlocklist, err := compileUABlocklist(config.UABlocklist)
+	if err != nil {
+		return err
+	}
+	excludedIPs, err := parseExcludeIPs(config.ExcludeIPs, config.ExcludeSelf)
+	if err != nil {
+		return err
+	}
+	if config.EnableCohorts && config.CookieSecret == "" {
+		return errors.New("EnableCohorts requires CookieSecret")
+	}
+
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
-	pt.config = config
+	pt.cfg.Store(&config)
+	pt.uaBlocklist = uaBlocklist
+	pt.blockedTokens = tokenSet(config.BlockedTokens)
+	pt.excludedIPs = excludedIPs
+	pt.slots = nil
+	if config.MaxConcurrent > 0 {
+		pt.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	// Aggregates over the same tenant stay valid, so keep them rather than
+	// rescanning storage on the next summary.
+	if !config.PrecomputeSummary {
+		pt.aggregates = nil
+	} else if pt.aggregates == nil || pt.aggregates.tenant != config.Tenant {
+		pt.aggregates = newSummaryAggregates(config.Tenant)
+	}
+	pt.velocity = nil
+	if config.VelocityThreshold > 0 && config.VelocityWindow > 0 {
+		pt.velocity = newVelocityCounter(config.VelocityThreshold, config.VelocityWindow, config.MaxVelocityKeys)
+	}
+	pt.dedup = nil
+	if config.DedupWindow > 0 {
+		pt.dedup = newDedupCache(config.DedupWindow, config.MaxDedupKeys)
+	}
+	pt.idempotency = nil
+	if config.IdempotencyWindow > 0 {
+		pt.idempotency = newDedupCache(config.IdempotencyWindow, config.MaxIdempotencyKeys)
+	}
+	pt.touchpoints = nil
+	if config.TrackTouchpoints {
+		pt.touchpoints = newTouchpointCache(config.MaxTouchpointKeys)
+	}
+	pt.visitorCap = nil
+	if config.VisitorEventCap > 0 && config.VisitorCapWindow > 0 {
+		pt.visitorCap = newVisitorCapCounter(config.VisitorEventCap, config.VisitorCapWindow, config.MaxVisitorCapKeys)
+	}
+	pt.limiter = nil
+	if config.RateLimit.Rate > 0 || len(config.PathRateLimits) > 0 {
+		pt.limiter = newRateLimiter(config.RateLimit, config.PathRateLimits)
+	}
+	pt.rebuildQueryCache()
+	pt.geo.configureCache(config.GeoCacheTTL, config.GeoCacheSize)
+	return nil
 }
 
 func (pt *PixelTracker) Use(handler func(data *TrackingData)) {
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
-	pt.handlers = append(pt.handlers, handler)
+	pt.handlers = append(pt.handlers, namedHandler{name: defaultHandlerName(len(pt.handlers)), fn: handler})
 }
 
 func (pt *PixelTracker) PixelHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "image/gif")
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
+	start := time.Now()
+	ctx, span := pt.startSpan(pt.extractTraceContext(r), "PixelHandler", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	defer pt.observeRequest(start, span)
+	r = r.WithContext(ctx)
+
+	if status, err := pt.parseFormBody(r); err != nil {
+		pt.httpError(w, r, err.Error(), status)
+		return
+	}
+	if errs := pt.validatePayload(r); len(errs) > 0 {
+		if pt.isErrorPixelRoute(r) {
+			pt.httpError(w, r, "invalid payload", http.StatusUnprocessableEntity)
+			return
+		}
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if pt.suppressPixel(w, r, r.URL.Query().Get("event")) {
+		return
+	}
+
+	pixel := pt.setPixelHeaders(w, r)
+
+	token := pt.visitorToken(w, r)
+
+	if pt.skipRecording(r, token) || pt.replayedRequest(w, r, pt.config().Tenant) {
+		w.Write(pixel.body)
+		return
+	}
+	if !pt.recordPixel(w, r, token, "") {
+		return
+	}
+
+	if pt.config().ResponseJitter > 0 {
+		waitJitter(r.Context(), pt.config().ResponseJitter)
+	}
+
+	w.Write(pixel.body)
+}
+
+func (pt *PixelTracker) setPixelHeaders(w http.ResponseWriter, r *http.Request) pixelImage {
+	pixel := pixelFor(pt.config().PixelFormat)
+	if pt.config().RespectSaveData && saveData(r) {
+		pixel = smallestPixel(r)
+	}
+	if size, ok := requestedSize(r); ok {
+		pixel = sizedPixel(size)
+	}
+	w.Header().Set("Content-Type", pixel.contentType)
+	if pt.config().CacheForBots > 0 && isBotUserAgent(r.UserAgent()) {
+		// Crawlers re-fetching the pixel only add load. Vary keeps shared
+		// caches from handing the cached copy to browsers.
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(pt.config().CacheForBots.Seconds())))
+		w.Header().Set("Vary", "User-Agent")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Header().Set("Pragma", "no-cache")
+		w.Header().Set("Expires", "0")
+	}
+	if pt.config().CaptureNetworkHints {
+		w.Header().Set("Accept-CH", networkHints)
+	}
+
+	for name, value := range pt.config().ResponseHeaders {
+		if protectedPixelHeaders[http.CanonicalHeaderKey(name)] && !pt.config().OverrideProtectedHeaders {
+			continue
+		}
+		w.Header().Set(name, value)
+	}
+	return pixel
+}
+
+// skipRecording reports whether a request that may be tracked should still
+// not be recorded: its user agent is in UABlocklist, its IP in ExcludeIPs or
+// its visitor token in BlockedTokens. Every route that records events checks
+// it; skipped requests get the same response as recorded ones.
+func (pt *PixelTracker) skipRecording(r *http.Request, token string) bool {
+	return pt.blockedUserAgent(r) || pt.excludedIP(r) || pt.blockedToken(token)
+}
+
+// recordPixel processes a pixel request under a MaxConcurrent slot, in the
+// background unless the sync feature asks otherwise. A non-empty event
+// replaces the one from the query. It returns false after answering 503
+// when overloaded with RejectOverload set.
+func (pt *PixelTracker) recordPixel(w http.ResponseWriter, r *http.Request, token, event string) bool {
+	slots, ok := pt.acquireSlot()
+	if !ok {
+		atomic.AddInt64(&pt.overloaded, 1)
+		if pt.config().RejectOverload {
+			pt.httpError(w, r, "server busy", http.StatusServiceUnavailable)
+			return false
+		}
+		pt.recordOverloaded(r, token, event)
+		return true
+	}
+
+	if pt.requestFeatures(r)[featureSync] {
+		// Debugging aid: the event is stored by the time the pixel arrives.
+		pt.processRequest(r, token, event)
+		releaseSlot(slots)
+	} else {
+		go func() {
+			defer releaseSlot(slots)
+			pt.processRequest(r, token, event)
+		}()
+	}
+	return true
+}
 
-	cookie, err := r.Cookie(pt.config.CookieName)
-	if !pt.config.DisableCookies && (err != nil || cookie == nil) {
-		token := generateUserToken()
-		http.SetCookie(w, &http.Cookie{
-			Name:     pt.config.CookieName,
-			Value:    token,
-			MaxAge:   pt.config.MaxAge,
-			HttpOnly: true,
-			Path:     "/",
-		})
+// visitorToken returns the token from the tracking cookie, issuing a new
+// token and cookie for first-time visitors unless cookies are disabled.
+func (pt *PixelTracker) visitorToken(w http.ResponseWriter, r *http.Request) string {
+	token, _, hasCookie := pt.trackerCookie(r)
+	if hasCookie || pt.config().DisableCookies {
+		return token
 	}
 
-	w.Write(pixel1x1)
+	token = generateUserToken(pt.tokenBytes())
+	var cookieDomain string
+	if pt.config().FirstPartyCookie {
+		cookieDomain = firstPartyCookieDomain(r.Host)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     pt.config().CookieName,
+		Value:    pt.trackerCookieValue(token, time.Now()),
+		MaxAge:   pt.config().MaxAge,
+		HttpOnly: true,
+		Path:     "/",
+		Domain:   cookieDomain,
+	})
+	return token
+}
 
-	go pt.processRequest(r, cookie)
+// protectedPixelHeaders keep the pixel uncached and correctly typed. They can
+// only be replaced through ResponseHeaders when OverrideProtectedHeaders is set.
+var protectedPixelHeaders = map[string]bool{
+	"Content-Type":  true,
+	"Cache-Control": true,
+	"Pragma":        true,
+	"Expires":       true,
 }
 
-func (pt *PixelTracker) processRequest(r *http.Request, cookie *http.Cookie) {
+// acquireSlot reserves one of the MaxConcurrent processing slots without
+// blocking. It always succeeds when no limit is configured. The slot must be
+// released on the returned channel, since Configure may replace pt.slots
+// while it is held.
+func (pt *PixelTracker) acquireSlot() (chan struct{}, bool) {
+	pt.mu.RLock()
+	slots := pt.slots
+	pt.mu.RUnlock()
+	if slots == nil {
+		return nil, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return slots, true
+	default:
+		return nil, false
+	}
+}
+
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// recordOverloaded stores an event for a request that arrived over
+// MaxConcurrent without running the enrichers, which is where the time
+// goes. It is flagged overloaded so analyses know geo, user agent and the
+// rest are missing.
+func (pt *PixelTracker) recordOverloaded(r *http.Request, token, event string) {
+	data := pt.newTrackingData(r, token)
+	if event != "" {
+		data.Event = event
+	}
+	data.Overloaded = true
+	pt.storeAndDispatch(data)
+}
+
+// OverloadedRequests returns how many requests were turned away or served
+// without tracking because MaxConcurrent was reached.
+func (pt *PixelTracker) OverloadedRequests() int64 {
+	return atomic.LoadInt64(&pt.overloaded)
+}
+
+// waitJitter sleeps a random duration up to max, returning early if the
+// request context is cancelled and never sleeping past its deadline.
+func waitJitter(ctx context.Context, max time.Duration) {
+	delay := time.Duration(rand.Int63n(int64(max) + 1))
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < delay {
+			delay = remaining
+		}
+	}
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func (pt *PixelTracker) processRequest(r *http.Request, token, event string) {
+	ctx, span := pt.startSpan(r.Context(), "processRequest")
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	base := pt.withRequestContext(context.Background(), r, nil)
+	timeout := pt.config().ProcessTimeout
+	if timeout <= 0 {
+		pt.storeImpressions(base, pt.eventTrackingData(r, token, event))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(base, timeout)
+	defer cancel()
+
+	// A blocked enricher or handler can't be interrupted, but returning here
+	// frees the caller's concurrency slot and the context stops any
+	// handlers that haven't started yet.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		trackingData := pt.eventTrackingData(r, token, event)
+		if ctx.Err() != nil {
+			return
+		}
+		pt.storeImpressions(ctx, trackingData)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Processing %s exceeded %v, abandoning remaining work", r.URL.Path, timeout)
+	}
+}
+
+func (pt *PixelTracker) buildTrackingData(r *http.Request, token string) *TrackingData {
+	trackingData := pt.newTrackingData(r, token)
+	pt.enrich(trackingData, r)
+	return trackingData
+}
+
+// eventTrackingData builds the event, overriding Event when event is set.
+func (pt *PixelTracker) eventTrackingData(r *http.Request, token, event string) *TrackingData {
+	data := pt.buildTrackingData(r, token)
+	if event != "" {
+		data.Event = event
+	}
+	return data
+}
+
+// newTrackingData fills in what the request carries directly, before any
+// enrichment.
+func (pt *PixelTracker) newTrackingData(r *http.Request, token string) *TrackingData {
+	now := time.Now()
 	trackingData := &TrackingData{
-		Cookies:   extractCookies(r),
+		Cookies:   filterCookies(extractCookies(r), pt.config().CookieAllowlist, pt.config().CookieName),
 		Host:      r.Host,
 		Path:      r.URL.Path,
-		Referer:   getReferer(r),
 		Params:    mux.Vars(r),
-		Query:     extractQueryParams(r),
-		Timestamp: time.Now(),
+		Query:     pt.requestParams(r),
+		Token:     token,
+		Timestamp: now,
+		// Timestamp may be replaced by the client's time; ReceivedAt can't.
+		ReceivedAt: now,
+	}
+	trackingData.Event = trackingData.Query["event"]
+	if pt.config().CaptureRawQuery {
+		trackingData.RawQuery = truncateRawQuery(r.URL.RawQuery)
+	}
+	if pt.config().NormalizePaths {
+		trackingData.RawPath = trackingData.Path
+		trackingData.Path = normalizePath(trackingData.Path)
 	}
+	// The cookie issued for a new visitor is only on the response, so the
+	// request still lacks it.
+	if _, cohort, ok := pt.trackerCookie(r); ok {
+		trackingData.Cohort = cohort
+	} else {
+		trackingData.NewVisitor = true
+		if pt.config().EnableCohorts && !pt.config().DisableCookies {
+			trackingData.Cohort = cohortFor(trackingData.Timestamp)
+		}
+	}
+	return trackingData
+}
 
-	if pt.config.TrackIP {
-		trackingData.IP = getClientIP(r)
+func (pt *PixelTracker) storeAndDispatch(trackingData *TrackingData) {
+	pt.storeAndDispatchContext(context.Background(), trackingData)
+}
+
+func (pt *PixelTracker) storeAndDispatchContext(ctx context.Context, trackingData *TrackingData) {
+	// API keys can assign another tenant on /batch.
+	if trackingData.Tenant == "" {
+		trackingData.Tenant = pt.config().Tenant
+	}
+	if trackingData.ID == "" {
+		trackingData.ID = generateUserToken(eventIDBytes)
 	}
+	pt.flagVelocity(trackingData)
 
-	trackingData.Decay = getDecay(r.URL.Query().Get("decay"))
-	trackingData.UserAgent = parseUserAgent(r.UserAgent())
-	trackingData.Language = parseLanguage(r.Header.Get("Accept-Language"))
-	trackingData.Geo = GeoInfo{IP: getClientIP(r)}
-	trackingData.Domain = extractDomain(r.Host)
+	if pt.isDuplicate(trackingData) {
+		return
+	}
+	if pt.capVisitor(trackingData) {
+		return
+	}
+	pt.stampTouchpoints(trackingData)
+	if !pt.sample(trackingData) {
+		return
+	}
+	pt.capEventSize(trackingData)
+	pt.stampChecksum(trackingData)
 
-	pt.dataStore.mu.Lock()
-	pt.dataStore.data = append(pt.dataStore.data, *trackingData)
-	pt.dataStore.mu.Unlock()
+	pt.appendEvent(*trackingData)
 
 	pt.mu.RLock()
 	handlers := pt.handlers
 	pt.mu.RUnlock()
 
 	for _, handler := range handlers {
-		handler(trackingData)
+		if ctx.Err() != nil {
+			return
+		}
+		pt.runHandler(handler, trackingData, requestContextFrom(ctx))
 	}
 }
 
 func (pt *PixelTracker) GetTrackingData() []TrackingData {
-	pt.dataStore.mu.RLock()
-	defer pt.dataStore.mu.RUnlock()
-	dataCopy := make([]TrackingData, len(pt.dataStore.data))
-	copy(dataCopy, pt.dataStore.data)
-	return dataCopy
+	return pt.query(QueryFilter{})
 }
 
 func (pt *PixelTracker) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	data := pt.GetTrackingData()
-	json.NewEncoder(w).Encode(data)
+	// Liveness probes only need the status, so skip copying and encoding.
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	since, err := pt.statsSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("cursor") || query.Has("limit") {
+		pt.writePage(w, r, since)
+		return
+	}
+
+	if scanner, ok := pt.store().(EventScanner); ok {
+		pt.streamEvents(w, scanner, QueryFilter{Since: since, Tenant: pt.config().Tenant})
+		return
+	}
+	data := pt.query(QueryFilter{Since: since})
+	json.NewEncoder(w).Encode(pt.outputEvents(data))
 }
 
-func generateUserToken() string {
-	rand.Seed(time.Now().UnixNano())
-	val := fmt.Sprintf("%f", rand.Float64())
-	hash := md5.Sum([]byte(val))
-	return hex.EncodeToString(hash[:])
+// statsSince returns the earliest timestamp /stats should return. An
+// explicit since older than MaxQueryWindow is clamped to the window.
+func (pt *PixelTracker) statsSince(r *http.Request) (time.Time, error) {
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, ok := parseClientTimestamp(value)
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid since %q", value)
+		}
+		since = parsed
+	}
+
+	if window := pt.config().MaxQueryWindow; window > 0 {
+		if floor := time.Now().Add(-window); since.Before(floor) {
+			since = floor
+		}
+	}
+	return since, nil
+}
+
+func filterSince(data []TrackingData, since time.Time) []TrackingData {
+	if since.IsZero() {
+		return data
+	}
+	filtered := make([]TrackingData, 0, len(data))
+	for _, event := range data {
+		if !event.Timestamp.Before(since) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered
+}
+
+// DebugEchoHandler runs the enrichment pipeline on the request and returns
+// the result without storing it, dispatching handlers or setting cookies.
+func (pt *PixelTracker) DebugEchoHandler(w http.ResponseWriter, r *http.Request) {
+	if !pt.config().EnableDebugEndpoints {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, _, _ := pt.trackerCookie(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pt.buildTrackingData(r, token))
+}
+
+const (
+	defaultTokenBytes = 16
+	minTokenBytes     = 8
+)
+
+// tokenBytes returns the configured token size, defaulting to 16 bytes
+// (32 hex characters) and never going below minTokenBytes.
+func (pt *PixelTracker) tokenBytes() int {
+	n := pt.config().TokenBytes
+	if n == 0 {
+		return defaultTokenBytes
+	}
+	if n < minTokenBytes {
+		return minTokenBytes
+	}
+	return n
+}
+
+func generateUserToken(n int) string {
+	buf := make([]byte, n)
+	if _, err := cryptorand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
 }
 
 func extractCookies(r *http.Request) map[string]string {
@@ -183,6 +859,56 @@ func extractCookies(r *http.Request) map[string]string {
 	return cookies
 }
 
+func extractHeaders(r *http.Request, names []string) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range names {
+		if values := r.Header.Values(name); len(values) > 0 {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	return headers
+}
+
+// filterCookies keeps only allowlisted cookies plus the tracker's own. An
+// empty allowlist keeps everything.
+func filterCookies(cookies map[string]string, allowlist []string, trackerCookie string) map[string]string {
+	if len(allowlist) == 0 {
+		return cookies
+	}
+
+	filtered := make(map[string]string)
+	if value, ok := cookies[trackerCookie]; ok {
+		filtered[trackerCookie] = value
+	}
+	for _, name := range allowlist {
+		if value, ok := cookies[name]; ok {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+// maxRawQueryLength bounds the verbatim query string kept per event, about
+// the longest URL browsers and proxies reliably pass through.
+const maxRawQueryLength = 2048
+
+func truncateRawQuery(raw string) string {
+	if len(raw) <= maxRawQueryLength {
+		return raw
+	}
+	return raw[:maxRawQueryLength]
+}
+
+// normalizePath lowercases p and trims trailing slashes so /Page/ and /page
+// count as one path in stats. The root stays "/".
+func normalizePath(p string) string {
+	p = strings.TrimRight(strings.ToLower(p), "/")
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
 func extractQueryParams(r *http.Request) map[string]string {
 	params := make(map[string]string)
 	for key, values := range r.URL.Query() {
@@ -204,6 +930,35 @@ func getReferer(r *http.Request) string {
 	return referer
 }
 
+// resolveReferer walks the referer fallback chain: the Referer header, the
+// Origin header, the configured query param, then "direct". It also reports
+// which source was used.
+func resolveReferer(r *http.Request, param string) (string, string) {
+	if referer := getReferer(r); referer != "direct" {
+		return referer, "header"
+	}
+	// fetch() with a no-referrer policy still sends Origin on cross-origin
+	// requests.
+	if origin := getOrigin(r); origin != "" {
+		return origin, "origin"
+	}
+	if param != "" {
+		if referer := r.URL.Query().Get(param); referer != "" {
+			return referer, "query"
+		}
+	}
+	return "direct", "direct"
+}
+
+// getOrigin returns the Origin header, ignoring the opaque "null" origin
+// sent by sandboxed frames and privacy-sensitive redirects.
+func getOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "null" {
+		return origin
+	}
+	return ""
+}
+
 func getClientIP(r *http.Request) string {
 	forwarded := r.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
@@ -223,6 +978,16 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
+func extractTLSInfo(r *http.Request) *TLSInfo {
+	if r.TLS == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:     tls.VersionName(r.TLS.Version),
+		CipherSuite: tls.CipherSuiteName(r.TLS.CipherSuite),
+	}
+}
+
 func getDecay(decay string) int64 {
 	if decay == "" {
 		return time.Now().Add(5*time.Minute).Unix() * 1000
@@ -290,29 +1055,147 @@ func extractDomain(host string) string {
 	return u.Hostname()
 }
 
+// firstPartyCookieDomain returns the registrable domain of host prefixed
+// with a dot, e.g. "track.shop.com" becomes ".shop.com". It returns "" for
+// IPs, single-label hosts and public suffixes, where a Domain attribute
+// would be rejected by browsers.
+func firstPartyCookieDomain(host string) string {
+	hostname := extractDomain(host)
+	if hostname == "" || net.ParseIP(hostname) != nil || !strings.Contains(hostname, ".") {
+		return ""
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return ""
+	}
+	return "." + domain
+}
+
 func main() {
 	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = os.Getenv("ADMIN_TOKEN")
+	config.CursorSecret = os.Getenv("CURSOR_SECRET")
+	if port := os.Getenv("PORT"); port != "" {
+		config.Port = port
+	}
+	if version := os.Getenv("MIN_TLS_VERSION"); version != "" {
+		minVersion, err := parseTLSVersion(version)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.MinTLSVersion = minVersion
+	}
+	config.EnableHTTP3 = os.Getenv("ENABLE_HTTP3") == "true"
+	config.StoragePartition = os.Getenv("STORAGE_PARTITION")
+	config.StorageCodec = os.Getenv("STORAGE_CODEC")
+	if retention := os.Getenv("RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			log.Fatalf("Invalid RETENTION: %v", err)
+		}
+		config.Retention = d
+	}
+	if spec := os.Getenv("RETENTION_BY_EVENT"); spec != "" {
+		byEvent, err := parseRetentionByEvent(spec)
+		if err != nil {
+			log.Fatalf("Invalid RETENTION_BY_EVENT: %v", err)
+		}
+		config.RetentionByEvent = byEvent
+	}
+	if err := tracker.Configure(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
-	tracker.Use(func(data *TrackingData) {
+	if dir := os.Getenv("STORAGE_DIR"); dir != "" {
+		codec, err := tracker.storageCodec()
+		if err != nil {
+			log.Fatalf("Invalid STORAGE_CODEC: %v", err)
+		}
+		store, err := OpenFileStore(dir, config.StoragePartition, codec)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		tracker.SetStorage(store)
+	}
+	if config.Retention > 0 || len(config.RetentionByEvent) > 0 {
+		tracker.runRetention(time.Hour)
+	}
+
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		tracker.SetAuditLogger(NewJSONAuditLogger(f))
+	}
+
+	tracker.UseNamed("log", func(data *TrackingData) {
 		log.Printf("Tracking event: %s from %s", data.Path, data.IP)
 	})
 
-	r := mux.NewRouter()
-	r.HandleFunc("/pixel.gif", tracker.PixelHandler).Methods("GET", "HEAD")
-	r.HandleFunc("/stats", tracker.StatsHandler).Methods("GET")
-	r.HandleFunc("/", serveTestPage).Methods("GET")
+	if path := os.Getenv("GEOIP_DB"); path != "" {
+		if err := tracker.ReloadGeoIP(path); err != nil {
+			log.Fatalf("Failed to open GeoIP database: %v", err)
+		}
+	}
+
+	if path := os.Getenv("GEOIP_ASN_DB"); path != "" {
+		resolver, err := OpenASNDatabase(path)
+		if err != nil {
+			log.Fatalf("Failed to open ASN database: %v", err)
+		}
+		tracker.SetASNResolver(resolver)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		config := *tracker.config()
+		config.KafkaBrokers = strings.Split(brokers, ",")
+		config.KafkaTopic = os.Getenv("KAFKA_TOPIC")
+		if err := tracker.Configure(config); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if err := tracker.StartKafka(); err != nil {
+			log.Fatalf("Failed to start Kafka sink: %v", err)
+		}
 	}
 
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		config := *tracker.config()
+		config.S3Bucket = bucket
+		config.S3Prefix = os.Getenv("S3_PREFIX")
+		config.S3Endpoint = os.Getenv("S3_ENDPOINT")
+		config.S3Region = os.Getenv("S3_REGION")
+		config.S3AccessKey = os.Getenv("S3_ACCESS_KEY")
+		config.S3SecretKey = os.Getenv("S3_SECRET_KEY")
+		if err := tracker.Configure(config); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		if err := tracker.StartS3Export(); err != nil {
+			log.Fatalf("Failed to start S3 export: %v", err)
+		}
+	}
+
+	tracker.handleSIGHUP(os.Getenv("SNAPSHOT_PATH"))
+	tracker.handleSIGTERM()
+
+	port := config.Port
+
 	log.Printf("Starting pixel tracker server on port %s", port)
 	log.Printf("Test page: http://localhost:%s/", port)
 	log.Printf("Pixel endpoint: http://localhost:%s/pixel.gif", port)
 	log.Printf("Stats endpoint: http://localhost:%s/stats", port)
+	log.Printf("Metrics endpoint: http://localhost:%s/metrics", port)
+	log.Printf("Health endpoint: http://localhost:%s/healthz", port)
+	log.Printf("Summary endpoint: http://localhost:%s/stats/summary", port)
+	log.Printf("Dashboard: http://localhost:%s/dashboard", port)
 
-	if err := http.ListenAndServe(":"+port, r); err != nil {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		log.Fatal(tracker.ServeTLS(certFile, keyFile))
+	}
+	if err := tracker.Server().ListenAndServe(); err != nil {
 		log.Fatal(err)
 	}
 }
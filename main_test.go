@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,8 +17,8 @@ import (
 )
 
 func TestGenerateUserToken(t *testing.T) {
-	token1 := generateUserToken()
-	token2 := generateUserToken()
+	token1 := generateUserToken(defaultTokenBytes)
+	token2 := generateUserToken(defaultTokenBytes)
 
 	if len(token1) != 32 {
 		t.Errorf("Expected token length of 32, got %d", len(token1))
@@ -29,6 +33,41 @@ func TestGenerateUserToken(t *testing.T) {
 	}
 }
 
+func TestTokenBytes(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokenBytes     int
+		expectedLength int
+	}{
+		{name: "Default", tokenBytes: 0, expectedLength: 32},
+		{name: "32 bytes", tokenBytes: 32, expectedLength: 64},
+		{name: "Below minimum", tokenBytes: 4, expectedLength: minTokenBytes * 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.TokenBytes = tt.tokenBytes
+			tracker.Configure(config)
+
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("Expected one cookie, got %d", len(cookies))
+			}
+			if len(cookies[0].Value) != tt.expectedLength {
+				t.Errorf("Expected token length %d, got %d", tt.expectedLength, len(cookies[0].Value))
+			}
+			if !isHexString(cookies[0].Value) {
+				t.Error("Token should be a valid hex string")
+			}
+		})
+	}
+}
+
 func TestParseUserAgent(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -135,6 +174,293 @@ func TestExtractDomain(t *testing.T) {
 	}
 }
 
+func TestFirstPartyCookieDomain(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"track.shop.com", ".shop.com"},
+		{"a.b.track.shop.com:8080", ".shop.com"},
+		{"track.shop.co.uk", ".shop.co.uk"},
+		{"shop.com", ".shop.com"},
+		{"co.uk", ""},
+		{"localhost:8080", ""},
+		{"192.168.1.1:8080", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		result := firstPartyCookieDomain(tt.host)
+		if result != tt.expected {
+			t.Errorf("firstPartyCookieDomain(%s) = %q, want %q", tt.host, result, tt.expected)
+		}
+	}
+}
+
+func TestFirstPartyCookie(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.FirstPartyCookie = true
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "http://track.shop.com/pixel.gif", nil)
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected one cookie, got %d", len(cookies))
+	}
+	if !strings.Contains(rr.Header().Get("Set-Cookie"), "Domain=shop.com") {
+		t.Errorf("Expected cookie on the parent domain, got %q", rr.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestCookieAllowlist(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		expected  map[string]string
+	}{
+		{
+			name:      "Allowlist keeps named cookies and the tracker cookie",
+			allowlist: []string{"consent"},
+			expected:  map[string]string{"_tracker": "abc", "consent": "yes"},
+		},
+		{
+			name:      "Empty allowlist keeps everything",
+			allowlist: nil,
+			expected:  map[string]string{"_tracker": "abc", "consent": "yes", "_ga": "GA1.2.3", "session": "s3cr3t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.CookieAllowlist = tt.allowlist
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.Header.Set("Cookie", "_tracker=abc; consent=yes; _ga=GA1.2.3; session=s3cr3t")
+
+			data := tracker.buildTrackingData(req, "abc")
+			if len(data.Cookies) != len(tt.expected) {
+				t.Errorf("Expected cookies %v, got %v", tt.expected, data.Cookies)
+			}
+			for name, value := range tt.expected {
+				if data.Cookies[name] != value {
+					t.Errorf("Expected cookie %s=%s, got %q", name, value, data.Cookies[name])
+				}
+			}
+		})
+	}
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.CaptureHeaders = []string{"X-Campaign-ID", "X-Experiment"}
+	tracker.Configure(config)
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("X-Campaign-ID", "spring-2024")
+	req.Header.Add("X-Experiment", "checkout-a")
+	req.Header.Add("X-Experiment", "banner-b")
+	req.Header.Set("X-Internal-Secret", "do-not-store")
+
+	data := tracker.buildTrackingData(req, "")
+
+	expected := map[string]string{
+		"X-Campaign-ID": "spring-2024",
+		"X-Experiment":  "checkout-a,banner-b",
+	}
+	if len(data.Headers) != len(expected) {
+		t.Errorf("Expected headers %v, got %v", expected, data.Headers)
+	}
+	for name, value := range expected {
+		if data.Headers[name] != value {
+			t.Errorf("Expected header %s=%q, got %q", name, value, data.Headers[name])
+		}
+	}
+}
+
+func TestResolveReferer(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          string
+		headers         map[string]string
+		expectedReferer string
+		expectedSource  string
+	}{
+		{
+			name:            "Header present",
+			target:          "/pixel.gif?ref=https://query.example.com",
+			headers:         map[string]string{"Referer": "https://header.example.com"},
+			expectedReferer: "https://header.example.com",
+			expectedSource:  "header",
+		},
+		{
+			name:            "Header absent, query param present",
+			target:          "/pixel.gif?ref=https%3A%2F%2Fquery.example.com%2Fpage",
+			expectedReferer: "https://query.example.com/page",
+			expectedSource:  "query",
+		},
+		{
+			name:            "Origin without referer",
+			target:          "/pixel.gif?ref=https://query.example.com",
+			headers:         map[string]string{"Origin": "https://app.example.com"},
+			expectedReferer: "https://app.example.com",
+			expectedSource:  "origin",
+		},
+		{
+			name:            "Referer wins over origin",
+			target:          "/pixel.gif",
+			headers:         map[string]string{"Origin": "https://app.example.com", "Referer": "https://app.example.com/checkout"},
+			expectedReferer: "https://app.example.com/checkout",
+			expectedSource:  "header",
+		},
+		{
+			name:            "Opaque origin is ignored",
+			target:          "/pixel.gif",
+			headers:         map[string]string{"Origin": "null"},
+			expectedReferer: "direct",
+			expectedSource:  "direct",
+		},
+		{
+			name:            "Both absent",
+			target:          "/pixel.gif",
+			expectedReferer: "direct",
+			expectedSource:  "direct",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			referer, source := resolveReferer(req, "ref")
+			if referer != tt.expectedReferer {
+				t.Errorf("Expected referer %q, got %q", tt.expectedReferer, referer)
+			}
+			if source != tt.expectedSource {
+				t.Errorf("Expected source %q, got %q", tt.expectedSource, source)
+			}
+		})
+	}
+}
+
+func TestOriginRecorded(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	req := httptest.NewRequest("POST", "/pixel.gif", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	data := tracker.buildTrackingData(req, "")
+
+	if data.Origin != "https://app.example.com" {
+		t.Errorf("Expected origin https://app.example.com, got %q", data.Origin)
+	}
+	if data.Referer != "https://app.example.com" || data.RefererSource != "origin" {
+		t.Errorf("Expected origin as referer fallback, got %q from %q", data.Referer, data.RefererSource)
+	}
+}
+
+func TestRefererStripped(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RefererParam = "ref"
+	tracker.Configure(config)
+
+	tests := []struct {
+		name     string
+		url      string
+		headers  map[string]string
+		expected bool
+	}{
+		{"Cross-site without referer", "/pixel.gif", map[string]string{"Sec-Fetch-Site": "cross-site"}, true},
+		{"Cross-site with referer", "/pixel.gif", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://blog.example.com/post"}, false},
+		{"Cross-site with origin fallback", "/pixel.gif", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.com"}, true},
+		{"Cross-site with query fallback", "/pixel.gif?ref=https%3A%2F%2Fnews.example.com", map[string]string{"Sec-Fetch-Site": "cross-site"}, true},
+		{"Same-origin without referer", "/pixel.gif", map[string]string{"Sec-Fetch-Site": "same-origin"}, false},
+		{"No fetch metadata", "/pixel.gif", map[string]string{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			data := tracker.buildTrackingData(req, "")
+			if data.RefererStripped != tt.expected {
+				t.Errorf("Expected referer_stripped %v, got %v", tt.expected, data.RefererStripped)
+			}
+		})
+	}
+}
+
+func TestNormalizePaths(t *testing.T) {
+	tracker := NewPixelTracker()
+	build := func(target string) *TrackingData {
+		return tracker.buildTrackingData(httptest.NewRequest("GET", target, nil), "")
+	}
+
+	if upper, lower := build("/Page/"), build("/page"); upper.Path == lower.Path {
+		t.Errorf("Expected paths to stay distinct when disabled, both got %q", upper.Path)
+	} else if upper.RawPath != "" {
+		t.Errorf("Expected no raw path when disabled, got %q", upper.RawPath)
+	}
+
+	config := *tracker.config()
+	config.NormalizePaths = true
+	tracker.Configure(config)
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		{"/Page/", "/page"},
+		{"/page", "/page"},
+		{"/Blog/Post//", "/blog/post"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		data := build(tt.target)
+		if data.Path != tt.expected {
+			t.Errorf("Expected %q to normalize to %q, got %q", tt.target, tt.expected, data.Path)
+		}
+		if data.RawPath != tt.target {
+			t.Errorf("Expected raw path %q, got %q", tt.target, data.RawPath)
+		}
+	}
+}
+
+func TestRawQuery(t *testing.T) {
+	tracker := NewPixelTracker()
+	raw := "utm_source=news%20letter&tag=a&tag=b&q=caf%C3%A9+au+lait&empty="
+	req := httptest.NewRequest("GET", "/pixel.gif?"+raw, nil)
+
+	if data := tracker.buildTrackingData(req, ""); data.RawQuery != "" {
+		t.Errorf("Expected no raw query when disabled, got %q", data.RawQuery)
+	}
+
+	config := *tracker.config()
+	config.CaptureRawQuery = true
+	tracker.Configure(config)
+	if data := tracker.buildTrackingData(req, ""); data.RawQuery != raw {
+		t.Errorf("Expected raw query %q, got %q", raw, data.RawQuery)
+	}
+
+	long := httptest.NewRequest("GET", "/pixel.gif?pad="+strings.Repeat("x", 3*maxRawQueryLength), nil)
+	if data := tracker.buildTrackingData(long, ""); len(data.RawQuery) != maxRawQueryLength {
+		t.Errorf("Expected raw query truncated to %d bytes, got %d", maxRawQueryLength, len(data.RawQuery))
+	}
+}
+
 func TestGetClientIP(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -263,15 +589,15 @@ func TestPixelHandler(t *testing.T) {
 				cookies := rr.Result().Cookies()
 				found := false
 				for _, cookie := range cookies {
-					if cookie.Name == tracker.config.CookieName {
+					if cookie.Name == tracker.config().CookieName {
 						found = true
-						if len(cookie.Value) != 32 {
-							t.Errorf("Cookie value should be 32 characters, got %d", len(cookie.Value))
+						if len(cookie.Value) != tracker.tokenBytes()*2 {
+							t.Errorf("Cookie value should be %d characters, got %d", tracker.tokenBytes()*2, len(cookie.Value))
 						}
 						break
 					}
 				}
-				if !found && !tracker.config.DisableCookies {
+				if !found && !tracker.config().DisableCookies {
 					t.Error("Expected tracking cookie to be set")
 				}
 			}
@@ -322,6 +648,52 @@ func TestStatsHandler(t *testing.T) {
 	}
 }
 
+func TestStatsHandlerMaxQueryWindow(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxQueryWindow = 7 * 24 * time.Hour
+	tracker.Configure(config)
+
+	now := time.Now()
+	for _, age := range []time.Duration{10 * 24 * time.Hour, 3 * 24 * time.Hour, time.Minute} {
+		tracker.dataStore.data = append(tracker.dataStore.data, TrackingData{
+			Query:     map[string]string{"age": age.String()},
+			Timestamp: now.Add(-age),
+		})
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedCount int
+	}{
+		{"No since is clamped to the window", "", 2},
+		{"Since older than the window is clamped", "?since=" + fmt.Sprint(now.Add(-30*24*time.Hour).Unix()), 2},
+		{"Since inside the window is honored", "?since=" + now.Add(-time.Hour).UTC().Format(time.RFC3339), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tracker.StatsHandler(rr, httptest.NewRequest("GET", "/stats"+tt.query, nil))
+
+			var data []TrackingData
+			if err := json.Unmarshal(rr.Body.Bytes(), &data); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(data) != tt.expectedCount {
+				t.Errorf("Expected %d events, got %d", tt.expectedCount, len(data))
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.StatsHandler(rr, httptest.NewRequest("GET", "/stats?since=last-week", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid since, got %d", rr.Code)
+	}
+}
+
 func TestTrackerWithCustomHandler(t *testing.T) {
 	tracker := NewPixelTracker()
 
@@ -423,6 +795,424 @@ func TestIntegrationWithRouter(t *testing.T) {
 	}
 }
 
+func TestResponseJitter(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ResponseJitter = 50 * time.Millisecond
+	tracker.Configure(config)
+
+	handlerChan := make(chan struct{}, 1)
+	tracker.Use(func(data *TrackingData) {
+		handlerChan <- struct{}{}
+	})
+
+	req := httptest.NewRequest("GET", "/pixel.gif?jitter=1", nil)
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	tracker.PixelHandler(rr, req)
+	elapsed := time.Since(start)
+
+	if elapsed > config.ResponseJitter+25*time.Millisecond {
+		t.Errorf("Expected response within jitter bound %v, took %v", config.ResponseJitter, elapsed)
+	}
+
+	if len(rr.Body.Bytes()) != 43 {
+		t.Errorf("Expected pixel size of 43 bytes, got %d", len(rr.Body.Bytes()))
+	}
+
+	select {
+	case <-handlerChan:
+	case <-time.After(1 * time.Second):
+		t.Error("Tracking did not fire with jitter enabled")
+	}
+}
+
+func TestResponseJitterRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	waitJitter(ctx, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected jitter to stop at context deadline, took %v", elapsed)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	tests := []struct {
+		name           string
+		rejectOverload bool
+		expectedStatus int
+	}{
+		{name: "Serve pixel when overloaded", rejectOverload: false, expectedStatus: http.StatusOK},
+		{name: "Reject when overloaded", rejectOverload: true, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.MaxConcurrent = 2
+			config.RejectOverload = tt.rejectOverload
+			tracker.Configure(config)
+
+			release := make(chan struct{})
+			var handled, overloaded int64
+			tracker.Use(func(data *TrackingData) {
+				if data.Overloaded {
+					atomic.AddInt64(&overloaded, 1)
+					return
+				}
+				atomic.AddInt64(&handled, 1)
+				<-release
+			})
+
+			statuses := []int{}
+			for i := 0; i < 5; i++ {
+				rr := httptest.NewRecorder()
+				tracker.PixelHandler(rr, httptest.NewRequest("GET", fmt.Sprintf("/pixel.gif?id=%d", i), nil))
+				statuses = append(statuses, rr.Code)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			if got := atomic.LoadInt64(&handled); got != 2 {
+				t.Errorf("Expected 2 requests to be processed, got %d", got)
+			}
+			if got := tracker.OverloadedRequests(); got != 3 {
+				t.Errorf("Expected 3 overloaded requests, got %d", got)
+			}
+			// Served overloaded requests are still recorded, just not enriched.
+			expectedOverloaded := int64(3)
+			if tt.rejectOverload {
+				expectedOverloaded = 0
+			}
+			if got := atomic.LoadInt64(&overloaded); got != expectedOverloaded {
+				t.Errorf("Expected %d unenriched overloaded events, got %d", expectedOverloaded, got)
+			}
+			for i, status := range statuses[2:] {
+				if status != tt.expectedStatus {
+					t.Errorf("Request %d: expected status %d, got %d", i+2, tt.expectedStatus, status)
+				}
+			}
+
+			close(release)
+			time.Sleep(100 * time.Millisecond)
+
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif?id=after", nil))
+			time.Sleep(100 * time.Millisecond)
+
+			if got := atomic.LoadInt64(&handled); got != 3 {
+				t.Errorf("Expected slots to be released after processing, got %d processed", got)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentReconfigure(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxConcurrent = 1
+	tracker.Configure(config)
+
+	// A request in flight holds a slot while Configure replaces the channel.
+	held, _ := tracker.acquireSlot()
+	tracker.Configure(config)
+
+	released := make(chan struct{})
+	go func() {
+		releaseSlot(held)
+		close(released)
+	}()
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Releasing a slot acquired before Configure blocked")
+	}
+
+	slots, ok := tracker.acquireSlot()
+	if !ok {
+		t.Fatal("Expected a free slot after Configure")
+	}
+	releaseSlot(slots)
+}
+
+func TestOverloadedSkipsEnrichment(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxConcurrent = 1
+	tracker.Configure(config)
+
+	slots, _ := tracker.acquireSlot()
+	defer releaseSlot(slots)
+
+	req := httptest.NewRequest("GET", "/pixel.gif?event=open", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/116.0.0.0")
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the pixel, got %d", rr.Code)
+	}
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected the overloaded request to be stored, got %d events", len(data))
+	}
+	if !data[0].Overloaded || data[0].Event != "open" || data[0].UserAgent.Browser != "" {
+		t.Errorf("Expected an unenriched event flagged overloaded, got %+v", data[0])
+	}
+}
+
+func TestTLSInfo(t *testing.T) {
+	tracker := NewPixelTracker()
+	r := mux.NewRouter()
+	r.HandleFunc("/pixel.gif", tracker.PixelHandler).Methods("GET", "HEAD")
+
+	testServer := httptest.NewTLSServer(r)
+	defer testServer.Close()
+
+	resp, err := testServer.Client().Get(testServer.URL + "/pixel.gif")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected 1 tracking entry, got %d", len(data))
+	}
+	if data[0].TLS == nil {
+		t.Fatal("Expected TLS info to be captured")
+	}
+	if data[0].TLS.Version != "TLS 1.3" {
+		t.Errorf("Expected TLS version %q, got %q", "TLS 1.3", data[0].TLS.Version)
+	}
+	if data[0].TLS.CipherSuite == "" || strings.HasPrefix(data[0].TLS.CipherSuite, "0x") {
+		t.Errorf("Expected a named cipher suite, got %q", data[0].TLS.CipherSuite)
+	}
+}
+
+func TestTLSInfoPlainHTTP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	if info := extractTLSInfo(req); info != nil {
+		t.Errorf("Expected no TLS info for plain HTTP, got %+v", info)
+	}
+}
+
+func TestDebugEchoHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	req := httptest.NewRequest("GET", "/debug/echo?campaign=spring&user_id=7", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/118.0")
+	req.Header.Set("Referer", "https://example.com/landing")
+
+	rr := httptest.NewRecorder()
+	tracker.DebugEchoHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with debug endpoints disabled, got %d", rr.Code)
+	}
+
+	config := *tracker.config()
+	config.EnableDebugEndpoints = true
+	tracker.Configure(config)
+
+	rr = httptest.NewRecorder()
+	tracker.DebugEchoHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	var echoed TrackingData
+	if err := json.Unmarshal(rr.Body.Bytes(), &echoed); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if echoed.Query["campaign"] != "spring" || echoed.Query["user_id"] != "7" {
+		t.Errorf("Expected query params to be echoed, got %v", echoed.Query)
+	}
+	if echoed.Referer != "https://example.com/landing" {
+		t.Errorf("Expected referer to be echoed, got %q", echoed.Referer)
+	}
+	if echoed.UserAgent.Browser != "Firefox" || echoed.UserAgent.Version != "118.0" {
+		t.Errorf("Expected parsed user agent to be echoed, got %+v", echoed.UserAgent)
+	}
+
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("Expected no cookies to be set by the echo endpoint")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if data := tracker.GetTrackingData(); len(data) != 0 {
+		t.Errorf("Expected echo not to be stored, got %d entries", len(data))
+	}
+}
+
+func TestStatsHandlerHead(t *testing.T) {
+	tracker := NewPixelTracker()
+	for i := 0; i < 1000; i++ {
+		tracker.dataStore.data = append(tracker.dataStore.data, TrackingData{
+			Path:  "/pixel.gif",
+			Query: map[string]string{"id": fmt.Sprint(i)},
+		})
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/stats", tracker.StatsHandler).Methods("GET", "HEAD")
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("HEAD", "/stats", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected no body to be encoded for HEAD, got %d bytes", rr.Body.Len())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected content type application/json, got %q", contentType)
+	}
+}
+
+func TestPixelFormat(t *testing.T) {
+	tests := []struct {
+		format              string
+		expectedContentType string
+		expectedBody        []byte
+	}{
+		{"", "image/gif", pixel1x1},
+		{"gif", "image/gif", pixel1x1},
+		{"webp", "image/webp", pixelWebP},
+		{"bmp", "image/gif", pixel1x1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.PixelFormat = tt.format
+			tracker.Configure(config)
+
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedContentType {
+				t.Errorf("Expected content type %q, got %q", tt.expectedContentType, contentType)
+			}
+			if !bytes.Equal(rr.Body.Bytes(), tt.expectedBody) {
+				t.Errorf("Expected %d pixel bytes, got %d", len(tt.expectedBody), rr.Body.Len())
+			}
+		})
+	}
+
+	if !bytes.HasPrefix(pixelWebP, []byte("RIFF")) || !bytes.Equal(pixelWebP[8:12], []byte("WEBP")) {
+		t.Error("pixelWebP is not a RIFF/WEBP container")
+	}
+}
+
+func TestConfigureDuringProcessing(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	// Requests are processed in the background; reconfiguring meanwhile
+	// must not race with them (run with -race).
+	for i := 0; i < 20; i++ {
+		tracker.PixelHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/pixel.gif", nil))
+		config := *tracker.config()
+		config.EnableTracing = i%2 == 0
+		config.CaptureNetworkHints = i%2 == 0
+		tracker.Configure(config)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(tracker.GetTrackingData()) < 20 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := len(tracker.GetTrackingData()); got != 20 {
+		t.Errorf("Expected 20 events, got %d", got)
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ResponseHeaders = map[string]string{
+		"Timing-Allow-Origin":         "*",
+		"Access-Control-Allow-Origin": "https://example.com",
+		"Cache-Control":               "public, max-age=3600",
+	}
+	tracker.Configure(config)
+
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+
+	if got := rr.Header().Get("Timing-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Timing-Allow-Origin *, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Expected Access-Control-Allow-Origin https://example.com, got %q", got)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "image/gif" {
+		t.Errorf("Expected Content-Type image/gif, got %q", got)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-cache, no-store, must-revalidate" {
+		t.Errorf("Expected default Cache-Control to be kept, got %q", got)
+	}
+
+	config.OverrideProtectedHeaders = true
+	tracker.Configure(config)
+
+	rr = httptest.NewRecorder()
+	tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Expected overridden Cache-Control, got %q", got)
+	}
+}
+
+func TestProcessTimeout(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MaxConcurrent = 1
+	config.ProcessTimeout = 50 * time.Millisecond
+	tracker.Configure(config)
+
+	blockForever := make(chan struct{})
+	defer close(blockForever)
+
+	var handled int64
+	var laterHandlerCalls int64
+	tracker.Use(func(data *TrackingData) {
+		if data.Query["block"] == "1" {
+			<-blockForever
+		}
+		atomic.AddInt64(&handled, 1)
+	})
+	tracker.Use(func(data *TrackingData) {
+		atomic.AddInt64(&laterHandlerCalls, 1)
+	})
+
+	tracker.PixelHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/pixel.gif?block=1", nil))
+
+	time.Sleep(150 * time.Millisecond)
+
+	tracker.PixelHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/pixel.gif?block=0", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	if got := tracker.OverloadedRequests(); got != 0 {
+		t.Errorf("Expected the timed-out request to release its slot, got %d overloaded requests", got)
+	}
+	if got := atomic.LoadInt64(&handled); got != 1 {
+		t.Errorf("Expected the second request to be handled, got %d handled", got)
+	}
+	if got := atomic.LoadInt64(&laterHandlerCalls); got != 1 {
+		t.Errorf("Expected handlers after the blocked one to be abandoned, got %d calls", got)
+	}
+}
+
 func BenchmarkPixelHandler(b *testing.B) {
 	tracker := NewPixelTracker()
 	req := httptest.NewRequest("GET", "/pixel.gif", nil)
@@ -446,7 +1236,7 @@ func BenchmarkParseUserAgent(b *testing.B) {
 func BenchmarkGenerateUserToken(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		generateUserToken()
+		generateUserToken(defaultTokenBytes)
 	}
 }
 
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingSamples is how many recent durations are kept per stage for the
+// percentile estimates.
+const timingSamples = 1024
+
+var timingQuantiles = []float64{0.5, 0.9, 0.99}
+
+type stageTiming struct {
+	samples []time.Duration
+	next    int
+	count   int64
+	sum     time.Duration
+}
+
+type timingRecorder struct {
+	mu     sync.Mutex
+	stages map[string]*stageTiming
+}
+
+func newTimingRecorder() *timingRecorder {
+	return &timingRecorder{stages: make(map[string]*stageTiming)}
+}
+
+func (tr *timingRecorder) observe(stage string, d time.Duration) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	st, ok := tr.stages[stage]
+	if !ok {
+		st = &stageTiming{}
+		tr.stages[stage] = st
+	}
+	if len(st.samples) < timingSamples {
+		st.samples = append(st.samples, d)
+	} else {
+		st.samples[st.next] = d
+		st.next = (st.next + 1) % timingSamples
+	}
+	st.count++
+	st.sum += d
+}
+
+type stageSnapshot struct {
+	stage     string
+	quantiles []time.Duration
+	count     int64
+	sum       time.Duration
+}
+
+func (tr *timingRecorder) snapshot() []stageSnapshot {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	snapshots := make([]stageSnapshot, 0, len(tr.stages))
+	for stage, st := range tr.stages {
+		sorted := make([]time.Duration, len(st.samples))
+		copy(sorted, st.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		quantiles := make([]time.Duration, len(timingQuantiles))
+		for i, q := range timingQuantiles {
+			quantiles[i] = sorted[int(q*float64(len(sorted)-1))]
+		}
+		snapshots = append(snapshots, stageSnapshot{stage, quantiles, st.count, st.sum})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].stage < snapshots[j].stage })
+	return snapshots
+}
+
+// MetricsHandler serves metrics in the Prometheus text exposition format.
+// It switches to OpenMetrics, which adds trace exemplars, when the scraper
+// asks for it.
+func (pt *PixelTracker) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	openMetrics := acceptsOpenMetrics(r)
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	}
+
+	pt.requests.write(w, openMetrics)
+
+	fmt.Fprintln(w, "# HELP pixel_tracker_enrichment_seconds Duration of each enrichment stage.")
+	fmt.Fprintln(w, "# TYPE pixel_tracker_enrichment_seconds summary")
+	for _, s := range pt.timings.snapshot() {
+		for i, q := range timingQuantiles {
+			fmt.Fprintf(w, "pixel_tracker_enrichment_seconds{stage=%q,quantile=\"%g\"} %g\n", s.stage, q, s.quantiles[i].Seconds())
+		}
+		fmt.Fprintf(w, "pixel_tracker_enrichment_seconds_sum{stage=%q} %g\n", s.stage, s.sum.Seconds())
+		fmt.Fprintf(w, "pixel_tracker_enrichment_seconds_count{stage=%q} %d\n", s.stage, s.count)
+	}
+
+	slow := pt.slowHandlers.snapshot()
+	names := make([]string, 0, len(slow))
+	for name := range slow {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeCounterHeader(w, "pixel_tracker_slow_handlers_total", "Handler calls that exceeded SlowHandlerThreshold.", openMetrics)
+	for _, name := range names {
+		fmt.Fprintf(w, "pixel_tracker_slow_handlers_total{handler=%q} %d\n", name, slow[name])
+	}
+
+	writeBreakerMetrics(w, pt.circuitBreakers(), openMetrics)
+
+	caches := pt.statefulCaches()
+	fmt.Fprintln(w, "# HELP pixel_tracker_tracked_keys Distinct keys held by each stateful feature.")
+	fmt.Fprintln(w, "# TYPE pixel_tracker_tracked_keys gauge")
+	for _, c := range caches {
+		keys, _ := c.cache.cardinality()
+		fmt.Fprintf(w, "pixel_tracker_tracked_keys{map=%q} %d\n", c.name, keys)
+	}
+	writeCounterHeader(w, "pixel_tracker_evicted_keys_total", "Keys evicted after a stateful feature hit its cap.", openMetrics)
+	for _, c := range caches {
+		_, evictions := c.cache.cardinality()
+		fmt.Fprintf(w, "pixel_tracker_evicted_keys_total{map=%q} %d\n", c.name, evictions)
+	}
+
+	pt.mu.RLock()
+	sink := pt.kafka
+	exporter := pt.s3
+	pt.mu.RUnlock()
+	if sink != nil {
+		sink.writeMetrics(w, openMetrics)
+	}
+	if exporter != nil {
+		exporter.writeMetrics(w, openMetrics)
+	}
+
+	if openMetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+// writeCounterHeader names the counter family without its _total suffix in
+// OpenMetrics, which requires that, and with it in the classic format.
+func writeCounterHeader(w io.Writer, name, help string, openMetrics bool) {
+	if openMetrics {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+}
+
+type keyCardinality interface {
+	cardinality() (keys int, evictions int64)
+}
+
+type namedCache struct {
+	name  string
+	cache keyCardinality
+}
+
+// statefulCaches lists the bounded per-key maps that are currently enabled.
+func (pt *PixelTracker) statefulCaches() []namedCache {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	var caches []namedCache
+	if pt.velocity != nil {
+		caches = append(caches, namedCache{"velocity", pt.velocity})
+	}
+	if pt.dedup != nil {
+		caches = append(caches, namedCache{"dedup", pt.dedup})
+	}
+	if pt.idempotency != nil {
+		caches = append(caches, namedCache{"idempotency", pt.idempotency})
+	}
+	if pt.touchpoints != nil {
+		caches = append(caches, namedCache{"touchpoints", pt.touchpoints})
+	}
+	if pt.visitorCap != nil {
+		caches = append(caches, namedCache{"visitorcap", pt.visitorCap})
+	}
+	if pt.limiter != nil {
+		caches = append(caches, namedCache{"ratelimit", pt.limiter})
+	}
+	return caches
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordTimings(t *testing.T) {
+	tests := []struct {
+		name          string
+		recordTimings bool
+	}{
+		{"Enabled", true},
+		{"Disabled", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.RecordTimings = tt.recordTimings
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0")
+			data := tracker.buildTrackingData(req, "")
+
+			if !tt.recordTimings {
+				if len(data.Timings) != 0 {
+					t.Errorf("Expected no timings when disabled, got %v", data.Timings)
+				}
+				return
+			}
+
+			for _, stage := range tracker.Enrichers() {
+				if _, ok := data.Timings[stage]; !ok {
+					t.Errorf("Expected timing for stage %q", stage)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsHandlerTimings(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RecordTimings = true
+	tracker.Configure(config)
+
+	for i := 0; i < 10; i++ {
+		tracker.buildTrackingData(httptest.NewRequest("GET", "/pixel.gif", nil), "")
+	}
+	tracker.timings.observe("slow", 30*time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	tracker.MetricsHandler(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+
+	for _, expected := range []string{
+		"# TYPE pixel_tracker_enrichment_seconds summary",
+		`pixel_tracker_enrichment_seconds{stage="useragent",quantile="0.99"}`,
+		`pixel_tracker_enrichment_seconds_count{stage="useragent"} 10`,
+		`pixel_tracker_enrichment_seconds{stage="slow",quantile="0.5"} 0.03`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics output to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// networkHints are the Network Information client hints Chromium sends once
+// a response has asked for them with Accept-CH.
+const networkHints = "RTT, Downlink, ECT"
+
+type Network struct {
+	RTT           int     `json:"rtt"`
+	Downlink      float64 `json:"downlink"`
+	EffectiveType string  `json:"effective_type,omitempty"`
+}
+
+// enrichNetwork records the RTT (ms), Downlink (Mbps) and ECT hints when
+// CaptureNetworkHints is on. Missing or malformed hints are left as zero.
+func (pt *PixelTracker) enrichNetwork(data *TrackingData, r *http.Request) {
+	if !pt.config().CaptureNetworkHints {
+		return
+	}
+	rtt, _ := strconv.Atoi(r.Header.Get("RTT"))
+	downlink, _ := strconv.ParseFloat(r.Header.Get("Downlink"), 64)
+	data.Network = &Network{
+		RTT:           rtt,
+		Downlink:      downlink,
+		EffectiveType: r.Header.Get("ECT"),
+	}
+}
+
+func enrichSaveData(data *TrackingData, r *http.Request) {
+	data.SaveData = saveData(r)
+}
+
+// saveData reports whether the client asked for reduced data usage.
+func saveData(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on")
+}
+
+// smallestPixel picks the smallest pixel format the client accepts. GIF is
+// always acceptable; other formats need to be listed in Accept.
+func smallestPixel(r *http.Request) pixelImage {
+	smallest := pixelFor("gif")
+	accept := r.Header.Get("Accept")
+	for _, img := range pixelFormats {
+		if len(img.body) < len(smallest.body) && strings.Contains(accept, img.contentType) {
+			smallest = img
+		}
+	}
+	return smallest
+}
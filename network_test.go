@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnrichNetwork(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected Network
+	}{
+		{
+			name:     "All hints",
+			headers:  map[string]string{"RTT": "150", "Downlink": "2.5", "ECT": "4g"},
+			expected: Network{RTT: 150, Downlink: 2.5, EffectiveType: "4g"},
+		},
+		{
+			name:     "No hints",
+			headers:  map[string]string{},
+			expected: Network{},
+		},
+		{
+			name:     "Malformed hints",
+			headers:  map[string]string{"RTT": "fast", "Downlink": "n/a", "ECT": "3g"},
+			expected: Network{EffectiveType: "3g"},
+		},
+	}
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.CaptureNetworkHints = true
+	tracker.Configure(config)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			data := &TrackingData{}
+			tracker.enrichNetwork(data, req)
+			if data.Network == nil || *data.Network != tt.expected {
+				t.Errorf("enrichNetwork() = %+v, want %+v", data.Network, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNetworkHintsDisabled(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("RTT", "150")
+
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	if accept := rr.Header().Get("Accept-CH"); accept != "" {
+		t.Errorf("Expected no Accept-CH header, got %q", accept)
+	}
+	if data := tracker.buildTrackingData(req, ""); data.Network != nil {
+		t.Errorf("Expected no network info, got %+v", data.Network)
+	}
+	// Let the first request's background processing finish, so it is
+	// recorded under the old configuration.
+	deadline := time.Now().Add(time.Second)
+	for len(tracker.GetTrackingData()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if data := tracker.GetTrackingData(); len(data) != 1 || data[0].Network != nil {
+		t.Errorf("Expected one event without network info, got %+v", data)
+	}
+
+	config := *tracker.config()
+	config.CaptureNetworkHints = true
+	tracker.Configure(config)
+	rr = httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	if accept := rr.Header().Get("Accept-CH"); accept != networkHints {
+		t.Errorf("Expected Accept-CH %q, got %q", networkHints, accept)
+	}
+}
+
+func TestSaveData(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RespectSaveData = true
+	tracker.Configure(config)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		expectedFlag bool
+		expectedType string
+	}{
+		{"Save-Data with WebP support", map[string]string{"Save-Data": "on", "Accept": "image/avif,image/webp,*/*"}, true, "image/webp"},
+		{"Save-Data without WebP support", map[string]string{"Save-Data": "on", "Accept": "image/gif"}, true, "image/gif"},
+		{"No Save-Data", map[string]string{"Accept": "image/avif,image/webp,*/*"}, false, "image/gif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			if data := tracker.buildTrackingData(req, ""); data.SaveData != tt.expectedFlag {
+				t.Errorf("Expected save_data %v, got %v", tt.expectedFlag, data.SaveData)
+			}
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+			if contentType := rr.Header().Get("Content-Type"); contentType != tt.expectedType {
+				t.Errorf("Expected content type %q, got %q", tt.expectedType, contentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// notFoundEvent marks hits on pixel-like paths that have no route, which
+// usually point at a broken or mistyped integration.
+const notFoundEvent = "notfound"
+
+var pixelExtensions = map[string]bool{
+	".gif":  true,
+	".png":  true,
+	".webp": true,
+	".jpg":  true,
+	".jpeg": true,
+}
+
+// NotFoundHandler serves and records a pixel for unknown image paths when
+// TrackNotFound is enabled, and a plain 404 otherwise.
+func (pt *PixelTracker) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	if !pt.config().TrackNotFound || !isPixelPath(r.URL.Path) {
+		pt.httpError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	if pt.suppressPixel(w, r, notFoundEvent) {
+		return
+	}
+
+	log.Printf("Tracking request to unknown pixel path %s", r.URL.Path)
+
+	pixel := pt.setPixelHeaders(w, r)
+	token := pt.visitorToken(w, r)
+	if !pt.skipRecording(r, token) && !pt.recordPixel(w, r, token, notFoundEvent) {
+		return
+	}
+	w.Write(pixel.body)
+}
+
+func isPixelPath(p string) bool {
+	return pixelExtensions[strings.ToLower(path.Ext(p))]
+}
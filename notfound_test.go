@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestNotFoundTracking(t *testing.T) {
+	tests := []struct {
+		name           string
+		trackNotFound  bool
+		path           string
+		expectedStatus int
+		expectRecorded bool
+	}{
+		{"Unknown pixel path tracked", true, "/campaigns/sprng/pixel.gif", http.StatusOK, true},
+		{"Non-pixel path stays 404", true, "/favicon.ico", http.StatusNotFound, false},
+		{"Disabled", false, "/campaigns/sprng/pixel.gif", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.TrackNotFound = tt.trackNotFound
+			tracker.Configure(config)
+
+			r := mux.NewRouter()
+			r.HandleFunc("/pixel.gif", tracker.PixelHandler).Methods("GET", "HEAD")
+			r.NotFoundHandler = http.HandlerFunc(tracker.NotFoundHandler)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest("GET", tt.path+"?campaign=spring", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			data := tracker.GetTrackingData()
+
+			if !tt.expectRecorded {
+				if len(data) != 0 {
+					t.Errorf("Expected nothing recorded, got %d events", len(data))
+				}
+				return
+			}
+
+			if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+				t.Error("Expected the pixel to be served for an unknown pixel path")
+			}
+			if len(data) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(data))
+			}
+			if data[0].Event != notFoundEvent || data[0].Path != tt.path {
+				t.Errorf("Expected notfound event for %s, got event %q path %q", tt.path, data[0].Event, data[0].Path)
+			}
+			if data[0].Query["campaign"] != "spring" {
+				t.Error("Expected query params to be recorded")
+			}
+		})
+	}
+}
+
+func TestNotFoundSetsCookie(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.TrackNotFound = true
+	tracker.Configure(config)
+
+	rr := httptest.NewRecorder()
+	tracker.NotFoundHandler(rr, httptest.NewRequest("GET", "/campaigns/pixel.gif", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tracker.config().CookieName {
+		t.Fatalf("Expected the tracking cookie to be set, got %v", cookies)
+	}
+	data := tracker.GetTrackingData()
+	if len(data) != 1 || data[0].Token != cookies[0].Value {
+		t.Errorf("Expected the event to carry the issued token %q, got %+v", cookies[0].Value, data)
+	}
+
+	req := httptest.NewRequest("GET", "/campaigns/pixel.gif", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	tracker.NotFoundHandler(rr, req)
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("Expected no new cookie for a returning visitor")
+	}
+}
+
+func TestSkipRecordingOnEveryRoute(t *testing.T) {
+	reasons := []struct {
+		name    string
+		prepare func(req *http.Request)
+	}{
+		{"Blocked user agent", func(req *http.Request) { req.Header.Set("User-Agent", "BadBot/1.0") }},
+		{"Excluded IP", func(req *http.Request) { req.RemoteAddr = "203.0.113.5:1234" }},
+		{"Blocked token", func(req *http.Request) { req.AddCookie(&http.Cookie{Name: "_tracker", Value: "abuser"}) }},
+	}
+	routes := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Pixel", "GET", "/pixel.gif", ""},
+		{"Batch", "POST", "/batch", `{"event":"a"}`},
+		{"Unknown pixel path", "GET", "/campaigns/pixel.gif", ""},
+	}
+
+	for _, route := range routes {
+		for _, reason := range reasons {
+			t.Run(route.name+"/"+reason.name, func(t *testing.T) {
+				tracker := NewPixelTracker()
+				config := *tracker.config()
+				config.TrackNotFound = true
+				config.UABlocklist = []string{"BadBot"}
+				config.ExcludeIPs = []string{"203.0.113.0/24"}
+				config.BlockedTokens = []string{"abuser"}
+				config.FeatureAllowlist = []string{featureSync}
+				tracker.Configure(config)
+
+				req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+				req.Header.Set(featuresHeader, featureSync)
+				reason.prepare(req)
+				rr := httptest.NewRecorder()
+				tracker.Router().ServeHTTP(rr, req)
+
+				if rr.Code != http.StatusOK && rr.Code != http.StatusAccepted {
+					t.Errorf("Expected a normal response, got %d", rr.Code)
+				}
+				if data := tracker.GetTrackingData(); len(data) != 0 {
+					t.Errorf("Expected nothing stored, got %d events", len(data))
+				}
+			})
+		}
+	}
+}
+
+func TestNotFoundMaxConcurrent(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.TrackNotFound = true
+	config.MaxConcurrent = 1
+	config.RejectOverload = true
+	tracker.Configure(config)
+
+	slots, _ := tracker.acquireSlot()
+	defer releaseSlot(slots)
+
+	rr := httptest.NewRecorder()
+	tracker.NotFoundHandler(rr, httptest.NewRequest("GET", "/campaigns/pixel.gif", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d over MaxConcurrent, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if got := tracker.OverloadedRequests(); got != 1 {
+		t.Errorf("Expected 1 overloaded request, got %d", got)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+var payloadEncodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+func (pt *PixelTracker) enrichPayload(data *TrackingData, r *http.Request) {
+	if pt.config().PayloadParam == "" {
+		return
+	}
+	raw := r.URL.Query().Get(pt.config().PayloadParam)
+	if raw == "" {
+		return
+	}
+
+	payload, ok := decodePayload(raw)
+	if !ok {
+		data.PayloadInvalid = true
+		return
+	}
+	data.Payload = payload
+}
+
+// decodePayload decodes a base64-encoded JSON object, accepting both the
+// standard and URL-safe alphabets with or without padding.
+func decodePayload(raw string) (map[string]any, bool) {
+	// An unescaped "+" in the query string arrives as a space.
+	raw = strings.ReplaceAll(raw, " ", "+")
+
+	for _, encoding := range payloadEncodings {
+		decoded, err := encoding.DecodeString(raw)
+		if err != nil {
+			continue
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(decoded, &payload); err != nil {
+			return nil, false
+		}
+		return payload, true
+	}
+	return nil, false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEnrichPayload(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.PayloadParam = "d"
+	tracker.Configure(config)
+
+	tests := []struct {
+		name            string
+		value           string
+		expectedPayload map[string]any
+		expectedInvalid bool
+	}{
+		{
+			name:            "Valid base64 JSON",
+			value:           base64.StdEncoding.EncodeToString([]byte(`{"event":"signup","value":12.5}`)),
+			expectedPayload: map[string]any{"event": "signup", "value": 12.5},
+		},
+		{
+			name:            "Valid URL-safe base64 without padding",
+			value:           base64.RawURLEncoding.EncodeToString([]byte(`{"page":"/a?b>c"}`)),
+			expectedPayload: map[string]any{"page": "/a?b>c"},
+		},
+		{
+			name:            "Invalid base64",
+			value:           "not*base64!",
+			expectedInvalid: true,
+		},
+		{
+			name:            "Base64 that is not JSON",
+			value:           base64.StdEncoding.EncodeToString([]byte("hello world")),
+			expectedInvalid: true,
+		},
+		{
+			name:  "Param absent",
+			value: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/pixel.gif"
+			if tt.value != "" {
+				target += "?d=" + url.QueryEscape(tt.value)
+			}
+			req := httptest.NewRequest("GET", target, nil)
+
+			data := &TrackingData{}
+			tracker.enrichPayload(data, req)
+
+			if data.PayloadInvalid != tt.expectedInvalid {
+				t.Errorf("Expected PayloadInvalid %v, got %v", tt.expectedInvalid, data.PayloadInvalid)
+			}
+			if len(data.Payload) != len(tt.expectedPayload) {
+				t.Fatalf("Expected payload %v, got %v", tt.expectedPayload, data.Payload)
+			}
+			for key, value := range tt.expectedPayload {
+				if data.Payload[key] != value {
+					t.Errorf("Expected payload[%s] = %v, got %v", key, value, data.Payload[key])
+				}
+			}
+		})
+	}
+}
+
+func TestEnrichPayloadDisabled(t *testing.T) {
+	tracker := NewPixelTracker()
+	encoded := base64.StdEncoding.EncodeToString([]byte(`{"event":"signup"}`))
+	req := httptest.NewRequest("GET", "/pixel.gif?d="+url.QueryEscape(encoded), nil)
+
+	data := &TrackingData{}
+	tracker.enrichPayload(data, req)
+
+	if data.Payload != nil || data.PayloadInvalid {
+		t.Errorf("Expected payload to be ignored without PayloadParam, got %v", data.Payload)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"sync"
+)
+
+// summaryAggregates keeps the summary for all events and for humans only,
+// updated as events are written, so /stats/summary doesn't rescan storage.
+// Appends go through it under one lock so a rebuild from storage never
+// misses or double counts a concurrent write. Like the rebuild, which reads
+// through GetTrackingData, it only counts events of its own tenant.
+type summaryAggregates struct {
+	mu     sync.Mutex
+	tenant string
+	fresh  bool
+	all    *summaryBuilder
+	humans *summaryBuilder
+}
+
+func newSummaryAggregates(tenant string) *summaryAggregates {
+	return &summaryAggregates{tenant: tenant}
+}
+
+func (a *summaryAggregates) append(storage Storage, event TrackingData) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := storage.Append(event); err != nil {
+		return err
+	}
+	if a.fresh && event.Tenant == a.tenant {
+		a.all.add(event)
+		if !event.IsBot {
+			a.humans.add(event)
+		}
+	}
+	return nil
+}
+
+// invalidate makes the next read rebuild from storage, for when events were
+// removed or the backend changed underneath.
+func (a *summaryAggregates) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.fresh = false
+}
+
+func (a *summaryAggregates) summaries(load func() []TrackingData) (all, humans Summary) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.fresh {
+		a.all, a.humans = newSummaryBuilder(), newSummaryBuilder()
+		for _, event := range load() {
+			a.all.add(event)
+			if !event.IsBot {
+				a.humans.add(event)
+			}
+		}
+		a.fresh = true
+	}
+	return a.all.result(), a.humans.result()
+}
+
+func (pt *PixelTracker) summaryAggregates() *summaryAggregates {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.aggregates
+}
+
+// appendEvent writes to storage, through the summary aggregates when
+// PrecomputeSummary is on.
+func (pt *PixelTracker) appendEvent(event TrackingData) {
+	var err error
+	if aggregates := pt.summaryAggregates(); aggregates != nil {
+		err = aggregates.append(pt.store(), event)
+	} else {
+		err = pt.store().Append(event)
+	}
+	if err != nil {
+		log.Printf("Failed to store event: %v", err)
+	}
+}
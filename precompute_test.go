@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrecomputedSummary(t *testing.T) {
+	precomputed := NewPixelTracker()
+	config := *precomputed.config()
+	config.PrecomputeSummary = true
+	precomputed.Configure(config)
+	scanned := NewPixelTracker()
+
+	summaryBody := func(tracker *PixelTracker, target string) string {
+		rr := httptest.NewRecorder()
+		tracker.SummaryHandler(rr, httptest.NewRequest("GET", target, nil))
+		return rr.Body.String()
+	}
+
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	events := func(from, to int) []TrackingData {
+		var batch []TrackingData
+		for i := from; i < to; i++ {
+			batch = append(batch, TrackingData{
+				Path:       fmt.Sprintf("/page/%d", i%3),
+				Token:      fmt.Sprintf("visitor-%d", i%5),
+				IP:         fmt.Sprintf("203.0.113.%d", i%7),
+				Query:      map[string]string{"message_id": fmt.Sprintf("m%d", i%4)},
+				UserAgent:  BrowserInfo{Browser: []string{"Chrome", "Firefox"}[i%2]},
+				Geo:        GeoInfo{Country: []string{"US", "DE", "GB"}[i%3]},
+				IsBot:      i%6 == 0,
+				NewVisitor: i < 5,
+				Timestamp:  start.Add(time.Duration(i) * 10 * time.Minute),
+			})
+		}
+		return batch
+	}
+
+	// The first batch is picked up by the lazy rebuild, the second by
+	// incremental updates.
+	for _, event := range events(0, 20) {
+		copied := event
+		precomputed.storeAndDispatch(&copied)
+		scanned.storeAndDispatch(&event)
+	}
+	summaryBody(precomputed, "/stats/summary")
+
+	var wg sync.WaitGroup
+	for _, event := range events(20, 60) {
+		copied := event
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			precomputed.storeAndDispatch(&copied)
+		}()
+		scanned.storeAndDispatch(&event)
+	}
+	wg.Wait()
+
+	for _, target := range []string{"/stats/summary", "/stats/summary?includeBots=true"} {
+		got, want := summaryBody(precomputed, target), summaryBody(scanned, target)
+		if got != want {
+			t.Errorf("%s: precomputed summary differs from recompute\ngot:  %s\nwant: %s", target, got, want)
+		}
+	}
+}
+
+func TestPrecomputedSummaryStorageSwap(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.PrecomputeSummary = true
+	tracker.Configure(config)
+
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Timestamp: time.Now()})
+	if all, _ := tracker.summaryAggregates().summaries(tracker.GetTrackingData); all.TotalOpens != 1 {
+		t.Fatalf("Expected 1 open, got %d", all.TotalOpens)
+	}
+
+	// Reconfiguring keeps the running totals.
+	aggregates := tracker.summaryAggregates()
+	tracker.Configure(config)
+	if tracker.summaryAggregates() != aggregates {
+		t.Error("Expected Configure to keep the aggregates for the same tenant")
+	}
+
+	// Events removed underneath, as retention does, must not linger.
+	tracker.SetStorage(&DataStore{data: []TrackingData{}})
+	if all, _ := tracker.summaryAggregates().summaries(tracker.GetTrackingData); all.TotalOpens != 0 {
+		t.Errorf("Expected the aggregates to rebuild from the new storage, got %d opens", all.TotalOpens)
+	}
+}
+
+func TestPrecomputedSummaryOtherTenant(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.Tenant = "acme"
+	config.PrecomputeSummary = true
+	tracker.Configure(config)
+
+	// Build the aggregates, then write events for this and another tenant,
+	// as /batch does with TenantKeys.
+	tracker.summaryAggregates().summaries(tracker.GetTrackingData)
+	tracker.storeAndDispatch(&TrackingData{Token: "a", Timestamp: time.Now()})
+	tracker.storeAndDispatch(&TrackingData{Token: "b", Tenant: "globex", Timestamp: time.Now()})
+
+	all, _ := tracker.summaryAggregates().summaries(tracker.GetTrackingData)
+	if all.TotalOpens != 1 {
+		t.Errorf("Expected only acme's event to be counted, got %d opens", all.TotalOpens)
+	}
+	tracker.summaryAggregates().invalidate()
+	if rebuilt, _ := tracker.summaryAggregates().summaries(tracker.GetTrackingData); rebuilt.TotalOpens != all.TotalOpens {
+		t.Errorf("Expected the rebuild to agree, got %d opens vs %d", rebuilt.TotalOpens, all.TotalOpens)
+	}
+
+	config.Tenant = "globex"
+	tracker.Configure(config)
+	if all, _ := tracker.summaryAggregates().summaries(tracker.GetTrackingData); all.TotalOpens != 1 {
+		t.Errorf("Expected the aggregates to rebuild for the new tenant, got %d opens", all.TotalOpens)
+	}
+}
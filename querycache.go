@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueryCacheTTL = 10 * time.Second
+	maxCachedQueries     = 256
+)
+
+type cachedQuery struct {
+	data    []TrackingData
+	expires time.Time
+}
+
+// queryCache sits in front of a Storage so repeated identical queries skip
+// the backend. Entries live for ttl and every write drops them all, so a
+// reader never misses an event it wrote itself. gen counts writes: a query
+// that raced one doesn't cache its result, which may predate the write.
+type queryCache struct {
+	mu      sync.Mutex
+	inner   Storage
+	ttl     time.Duration
+	entries *lruCache[cachedQuery]
+	gen     uint64
+}
+
+func newQueryCache(inner Storage, ttl time.Duration) *queryCache {
+	if ttl <= 0 {
+		ttl = defaultQueryCacheTTL
+	}
+	return &queryCache{
+		inner:   inner,
+		ttl:     ttl,
+		entries: newLRUCache[cachedQuery](maxCachedQueries),
+	}
+}
+
+func (c *queryCache) Append(event TrackingData) error {
+	err := c.inner.Append(event)
+
+	c.mu.Lock()
+	c.entries = newLRUCache[cachedQuery](maxCachedQueries)
+	c.gen++
+	c.mu.Unlock()
+	return err
+}
+
+// Query caches by Since rounded down to the TTL, so sliding windows such as
+// MaxQueryWindow's now-window share an entry, and trims the cached result
+// to the exact Since.
+func (c *queryCache) Query(filter QueryFilter) ([]TrackingData, error) {
+	requested := filter.Since
+	filter.Since = requested.Truncate(c.ttl)
+	key := queryCacheKey(filter)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries.get(key)
+	gen := c.gen
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return filterSince(copyEvents(entry.data), requested), nil
+	}
+
+	data, err := c.inner.Query(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.gen == gen {
+		c.entries.set(key, cachedQuery{data, now.Add(c.ttl)})
+	}
+	c.mu.Unlock()
+	return filterSince(copyEvents(data), requested), nil
+}
+
+// Get passes through to the backend; single-event lookups are cheap enough
+// not to cache.
+func (c *queryCache) Get(id string) (TrackingData, bool, error) {
+	if getter, ok := c.inner.(EventGetter); ok {
+		return getter.Get(id)
+	}
+	data, err := c.Query(QueryFilter{})
+	if err != nil {
+		return TrackingData{}, false, err
+	}
+	for _, event := range data {
+		if event.ID == id {
+			return event, true, nil
+		}
+	}
+	return TrackingData{}, false, nil
+}
+
+func queryCacheKey(filter QueryFilter) string {
+	key := "tenant=" + filter.Tenant + "&since="
+	if !filter.Since.IsZero() {
+		key += strconv.FormatInt(filter.Since.UnixNano(), 10)
+	}
+	return key
+}
+
+func copyEvents(data []TrackingData) []TrackingData {
+	dataCopy := make([]TrackingData, len(data))
+	copy(dataCopy, data)
+	return dataCopy
+}
+
+// rebuildQueryCache puts a fresh cache in front of the current storage when
+// EnableQueryCache is on. Callers hold pt.mu.
+func (pt *PixelTracker) rebuildQueryCache() {
+	pt.queryCache = nil
+	if pt.config().EnableQueryCache {
+		pt.queryCache = newQueryCache(pt.storage, pt.config().QueryCacheTTL)
+	}
+}
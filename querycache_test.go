@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// countingStorage wraps a DataStore and counts the queries that reach it.
+type countingStorage struct {
+	DataStore
+	queries int
+}
+
+func (s *countingStorage) Query(filter QueryFilter) ([]TrackingData, error) {
+	s.queries++
+	return s.DataStore.Query(filter)
+}
+
+func TestQueryCache(t *testing.T) {
+	backend := &countingStorage{}
+	tracker := NewPixelTracker()
+	tracker.SetStorage(backend)
+	config := *tracker.config()
+	config.EnableQueryCache = true
+	config.QueryCacheTTL = time.Minute
+	tracker.Configure(config)
+
+	tracker.storeAndDispatch(&TrackingData{Path: "/a", Timestamp: time.Now()})
+
+	if got := len(tracker.GetTrackingData()); got != 1 {
+		t.Fatalf("Expected 1 event, got %d", got)
+	}
+	tracker.GetTrackingData()
+	if backend.queries != 1 {
+		t.Errorf("Expected repeated query to hit the cache, backend saw %d queries", backend.queries)
+	}
+
+	since := time.Now().Add(-time.Hour)
+	tracker.query(QueryFilter{Since: since})
+	if backend.queries != 2 {
+		t.Errorf("Expected a different filter to miss the cache, backend saw %d queries", backend.queries)
+	}
+
+	tracker.storeAndDispatch(&TrackingData{Path: "/b", Timestamp: time.Now()})
+
+	if got := len(tracker.GetTrackingData()); got != 2 {
+		t.Errorf("Expected write to invalidate the cache and return 2 events, got %d", got)
+	}
+	if backend.queries != 3 {
+		t.Errorf("Expected the query after a write to reach the backend, backend saw %d queries", backend.queries)
+	}
+}
+
+func TestQueryCacheTTL(t *testing.T) {
+	backend := &countingStorage{}
+	cache := newQueryCache(backend, 10*time.Millisecond)
+
+	cache.Query(QueryFilter{})
+	cache.Query(QueryFilter{})
+	time.Sleep(20 * time.Millisecond)
+	cache.Query(QueryFilter{})
+
+	if backend.queries != 2 {
+		t.Errorf("Expected an expired entry to be refetched, backend saw %d queries", backend.queries)
+	}
+}
+
+// racingStorage lets a test run a write while a query is reading.
+type racingStorage struct {
+	DataStore
+	duringQuery func()
+}
+
+func (s *racingStorage) Query(filter QueryFilter) ([]TrackingData, error) {
+	data, err := s.DataStore.Query(filter)
+	if hook := s.duringQuery; hook != nil {
+		s.duringQuery = nil
+		hook()
+	}
+	return data, err
+}
+
+func TestQueryCacheWriteDuringMiss(t *testing.T) {
+	backend := &racingStorage{}
+	cache := newQueryCache(backend, time.Minute)
+
+	// The first query reads an empty store, then a write lands before it
+	// caches the result.
+	backend.duringQuery = func() {
+		cache.Append(TrackingData{Path: "/a", Timestamp: time.Now()})
+	}
+	if data, _ := cache.Query(QueryFilter{}); len(data) != 0 {
+		t.Fatalf("Expected the racing query to see the empty store, got %d events", len(data))
+	}
+
+	if data, _ := cache.Query(QueryFilter{}); len(data) != 1 {
+		t.Errorf("Expected the stale result not to be cached, got %d events", len(data))
+	}
+}
+
+func TestQueryCacheSlidingSince(t *testing.T) {
+	backend := &countingStorage{}
+	cache := newQueryCache(backend, time.Minute)
+	now := time.Now()
+	backend.Append(TrackingData{Path: "/old", Timestamp: now.Add(-2 * time.Hour)})
+	backend.Append(TrackingData{Path: "/new", Timestamp: now.Add(-30 * time.Minute)})
+
+	// MaxQueryWindow moves since forward on every request.
+	for i := 0; i < 3; i++ {
+		since := now.Add(-time.Hour).Add(time.Duration(i) * time.Millisecond)
+		data, _ := cache.Query(QueryFilter{Since: since})
+		if len(data) != 1 || data[0].Path != "/new" {
+			t.Errorf("Expected only /new since %v, got %+v", since, data)
+		}
+	}
+	if backend.queries > 2 {
+		t.Errorf("Expected nearby since values to share a cache entry, backend saw %d queries", backend.queries)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultMaxRateLimitKeys bounds how many buckets are kept.
+const defaultMaxRateLimitKeys = 100000
+
+// RateLimit allows Rate requests per second per client, with bursts of up to
+// Burst. A zero Rate disables limiting.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per client IP for the global limit, and
+// one per client IP and path for each path with an override.
+type rateLimiter struct {
+	mu        sync.Mutex
+	global    RateLimit
+	overrides map[string]RateLimit
+	buckets   *lruCache[*tokenBucket]
+}
+
+func newRateLimiter(global RateLimit, overrides map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		global:    global,
+		overrides: overrides,
+		buckets:   newLRUCache[*tokenBucket](defaultMaxRateLimitKeys),
+	}
+}
+
+// limitFor returns the override for path and its bucket key, falling back
+// to the global limit. Paths without an override share the client's global
+// bucket, so varying the path doesn't buy a fresh budget.
+func (l *rateLimiter) limitFor(ip, path string) (RateLimit, string) {
+	if limit, ok := l.overrides[path]; ok {
+		return limit, path + "\x00" + ip
+	}
+	return l.global, ip
+}
+
+func (l *rateLimiter) allow(ip, path string, now time.Time) bool {
+	limit, key := l.limitFor(ip, path)
+	if limit.Rate <= 0 {
+		return true
+	}
+	burst := float64(max(limit.Burst, 1))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets.get(key)
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets.set(key, bucket)
+	}
+
+	bucket.tokens = min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (l *rateLimiter) cardinality() (keys int, evictions int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buckets.len(), l.buckets.evictions
+}
+
+// RateLimit wraps the router so every request is checked against the limit
+// for its path before being handled.
+func (pt *PixelTracker) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pt.mu.RLock()
+		limiter := pt.limiter
+		pt.mu.RUnlock()
+
+		if limiter != nil && !limiter.allow(getClientIP(r), r.URL.Path, time.Now()) {
+			pt.httpError(w, r, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
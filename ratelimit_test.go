@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPathRateLimits(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.RateLimit = RateLimit{Rate: 1, Burst: 5}
+	config.PathRateLimits = map[string]RateLimit{
+		"/conversion.gif": {Rate: 1, Burst: 2},
+	}
+	tracker.Configure(config)
+
+	handler := tracker.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	allowed := func(path string, n int) int {
+		ok := 0
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest("GET", path, nil)
+			req.RemoteAddr = "203.0.113.1:1234"
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code == http.StatusOK {
+				ok++
+			} else if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status 200 or 429, got %d", rr.Code)
+			}
+		}
+		return ok
+	}
+
+	if got := allowed("/conversion.gif", 10); got != 2 {
+		t.Errorf("Expected override to allow 2 conversions, got %d", got)
+	}
+	// The conversion bucket being empty must not affect pageviews.
+	if got := allowed("/pixel.gif", 10); got != 5 {
+		t.Errorf("Expected global limit to allow 5 pageviews, got %d", got)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Rate: 2, Burst: 1}, nil)
+	start := time.Now()
+
+	if !limiter.allow("203.0.113.1", "/pixel.gif", start) {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if limiter.allow("203.0.113.1", "/pixel.gif", start) {
+		t.Error("Expected second immediate request to be limited")
+	}
+	if !limiter.allow("198.51.100.7", "/pixel.gif", start) {
+		t.Error("Expected another client to have its own bucket")
+	}
+	if !limiter.allow("203.0.113.1", "/pixel.gif", start.Add(500*time.Millisecond)) {
+		t.Error("Expected a token to refill after 1/rate seconds")
+	}
+}
+
+func TestRateLimiterGlobalBudgetAcrossPaths(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Rate: 1, Burst: 3}, map[string]RateLimit{
+		"/conversion.gif": {Rate: 1, Burst: 1},
+	})
+	now := time.Now()
+
+	// Paths without an override draw from one budget per client.
+	allowed := 0
+	for _, path := range []string{"/pixel.gif", "/other.gif", "/pixel.gif", "/random-404", "/other.gif"} {
+		if limiter.allow("203.0.113.1", path, now) {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("Expected 3 requests across paths within the global burst, got %d", allowed)
+	}
+	if !limiter.allow("203.0.113.1", "/conversion.gif", now) {
+		t.Error("Expected an overridden path to keep its own budget")
+	}
+	if keys, _ := limiter.cardinality(); keys != 2 {
+		t.Errorf("Expected one global and one override bucket, got %d", keys)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RefererInfo is the referring URL split into parts, so attribution can read
+// the referrer's own params (e.g. its utm_source) without reparsing.
+type RefererInfo struct {
+	Host  string            `json:"host"`
+	Path  string            `json:"path,omitempty"`
+	Query map[string]string `json:"query,omitempty"`
+}
+
+// parseRefererInfo parses an absolute referer URL. It returns nil for
+// "direct" and for referers that aren't absolute URLs. Malformed query
+// pairs are skipped and the rest kept; a repeated param keeps its first
+// value, as in Query.
+func parseRefererInfo(referer string) *RefererInfo {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	info := &RefererInfo{Host: u.Hostname(), Path: u.Path}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil || key == "" {
+			continue
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		if info.Query == nil {
+			info.Query = make(map[string]string)
+		}
+		if _, ok := info.Query[key]; !ok {
+			info.Query[key] = value
+		}
+	}
+	return info
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRefererInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		referer  string
+		expected *RefererInfo
+	}{
+		{
+			"With query",
+			"https://blog.example.com/post?utm_source=news&utm_medium=email&utm_source=dup",
+			&RefererInfo{Host: "blog.example.com", Path: "/post", Query: map[string]string{"utm_source": "news", "utm_medium": "email"}},
+		},
+		{"Without query", "https://example.com/", &RefererInfo{Host: "example.com", Path: "/"}},
+		{"Origin only", "https://example.com", &RefererInfo{Host: "example.com"}},
+		{
+			"Malformed pairs skipped",
+			"https://example.com/?ok=1&bad=%zz&=empty&flag",
+			&RefererInfo{Host: "example.com", Path: "/", Query: map[string]string{"ok": "1", "flag": ""}},
+		},
+		{"Malformed URL", "http://[::1", nil},
+		{"Not absolute", "not a url", nil},
+		{"Direct", "direct", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRefererInfo(tt.referer); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseRefererInfo(%q) = %+v, want %+v", tt.referer, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRefererEnrichment(t *testing.T) {
+	tracker := NewPixelTracker()
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("Referer", "https://partner.example/landing?utm_source=partner")
+
+	if data := tracker.buildTrackingData(req, ""); data.RefererInfo != nil {
+		t.Errorf("Expected no referer info without ParseReferer, got %+v", data.RefererInfo)
+	}
+
+	config := *tracker.config()
+	config.ParseReferer = true
+	tracker.Configure(config)
+	data := tracker.buildTrackingData(req, "")
+	if data.RefererInfo == nil || data.RefererInfo.Query["utm_source"] != "partner" {
+		t.Errorf("Expected the referer's utm_source, got %+v", data.RefererInfo)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// RequestContext is a read-only snapshot of the request an event came from,
+// for handlers that need more than TrackingData captures. It is shared by
+// every handler of the event, so accessors return copies.
+type RequestContext struct {
+	method     string
+	url        string
+	remoteAddr string
+	header     http.Header
+	body       []byte
+}
+
+func (rc *RequestContext) Method() string     { return rc.method }
+func (rc *RequestContext) URL() string        { return rc.url }
+func (rc *RequestContext) RemoteAddr() string { return rc.remoteAddr }
+
+// Header returns the first value of the named request header.
+func (rc *RequestContext) Header(name string) string {
+	return rc.header.Get(name)
+}
+
+// HeaderValues returns every value of the named request header.
+func (rc *RequestContext) HeaderValues(name string) []string {
+	return slices.Clone(rc.header.Values(name))
+}
+
+// Body returns the raw request body of /batch requests, decompressed, and
+// nil for pixel requests.
+func (rc *RequestContext) Body() []byte {
+	return slices.Clone(rc.body)
+}
+
+type requestContextKey struct{}
+
+// withRequestContext attaches a snapshot of r, and body if the caller read
+// one, to ctx when a registered handler wants it.
+func (pt *PixelTracker) withRequestContext(ctx context.Context, r *http.Request, body []byte) context.Context {
+	if !pt.wantsRequestContext() {
+		return ctx
+	}
+	return context.WithValue(ctx, requestContextKey{}, &RequestContext{
+		method:     r.Method,
+		url:        r.URL.String(),
+		remoteAddr: r.RemoteAddr,
+		header:     r.Header.Clone(),
+		body:       body,
+	})
+}
+
+func requestContextFrom(ctx context.Context) *RequestContext {
+	rc, _ := ctx.Value(requestContextKey{}).(*RequestContext)
+	return rc
+}
+
+func (pt *PixelTracker) wantsRequestContext() bool {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	for _, h := range pt.handlers {
+		if h.withRequest != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// UseWithRequest registers a named handler that also gets the request the
+// event came from. Events not tied to a request, such as consentless
+// records, pass an empty RequestContext.
+func (pt *PixelTracker) UseWithRequest(name string, handler func(data *TrackingData, rc *RequestContext)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.handlers = append(pt.handlers, namedHandler{name: name, withRequest: handler})
+}
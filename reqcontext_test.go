@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUseWithRequestHeader(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.FeatureAllowlist = []string{"sync"}
+	tracker.Configure(config)
+
+	var got, method string
+	tracker.UseWithRequest("partner", func(data *TrackingData, rc *RequestContext) {
+		got = rc.Header("X-Partner-Id")
+		method = rc.Method()
+	})
+
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("X-Partner-Id", "acme")
+	req.Header.Set(featuresHeader, "sync")
+	tracker.PixelHandler(httptest.NewRecorder(), req)
+
+	if got != "acme" {
+		t.Errorf("Expected handler to read X-Partner-Id %q, got %q", "acme", got)
+	}
+	if method != "GET" {
+		t.Errorf("Expected method GET, got %q", method)
+	}
+}
+
+func TestUseWithRequestBody(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	body := `[{"event":"a"},{"event":"b"}]`
+	var bodies []string
+	tracker.UseWithRequest("raw", func(data *TrackingData, rc *RequestContext) {
+		b := rc.Body()
+		bodies = append(bodies, string(b))
+		// Mutating the copy must not affect later handlers or events.
+		if len(b) > 0 {
+			b[0] = 'x'
+		}
+	})
+
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(body))
+	tracker.BatchHandler(httptest.NewRecorder(), req)
+
+	if len(bodies) != 2 {
+		t.Fatalf("Expected handler to run for 2 events, got %d", len(bodies))
+	}
+	for i, b := range bodies {
+		if b != body {
+			t.Errorf("Event %d: expected raw body %q, got %q", i, body, b)
+		}
+	}
+}
+
+func TestUseWithRequestWithoutRequest(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	called := false
+	tracker.UseWithRequest("raw", func(data *TrackingData, rc *RequestContext) {
+		called = true
+		if rc.Header("User-Agent") != "" || rc.Body() != nil {
+			t.Errorf("Expected empty RequestContext, got %+v", rc)
+		}
+	})
+	tracker.storeAndDispatch(&TrackingData{Path: "/pixel.gif"})
+
+	if !called {
+		t.Error("Expected handler to be called")
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	defaultS3Endpoint       = "s3.amazonaws.com"
+	defaultS3FlushInterval  = 5 * time.Minute
+	defaultS3MaxObjectBytes = 8 << 20
+	defaultS3MaxPending     = 100
+)
+
+// S3Uploader writes one object. It is satisfied by a minio client through
+// minioUploader and can be swapped for tests.
+type S3Uploader interface {
+	Upload(ctx context.Context, bucket, key string, body []byte) error
+}
+
+type minioUploader struct {
+	client *minio.Client
+}
+
+func (m minioUploader) Upload(ctx context.Context, bucket, key string, body []byte) error {
+	_, err := m.client.PutObject(ctx, bucket, key, bytes.NewReader(body), int64(len(body)), minio.PutObjectOptions{
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+	})
+	return err
+}
+
+type s3Object struct {
+	key  string
+	body []byte
+}
+
+// s3Exporter collects events as JSON lines and rotates them into gzipped
+// objects once S3MaxObjectBytes of events have accumulated or on each
+// flush. Objects that fail to upload stay queued in memory and are retried
+// on the next flush; past S3MaxPending the oldest are dropped. close
+// uploads whatever is left before the exporter stops.
+type s3Exporter struct {
+	uploader   S3Uploader
+	breaker    *circuitBreaker
+	bucket     string
+	prefix     string
+	instance   string
+	maxBytes   int
+	maxPending int
+
+	// ctx is cancelled when close gives up waiting for a periodic flush,
+	// which aborts its upload.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// flushing serializes flushes, which SIGHUP can start alongside the
+	// periodic one, so no object is uploaded twice.
+	flushing sync.Mutex
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	pending  []s3Object
+	seq      int
+
+	uploaded atomic.Int64
+	failures atomic.Int64
+	dropped  atomic.Int64
+}
+
+func newS3Exporter(uploader S3Uploader, breaker *circuitBreaker, config Config) *s3Exporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &s3Exporter{
+		uploader:   uploader,
+		breaker:    breaker,
+		bucket:     config.S3Bucket,
+		prefix:     config.S3Prefix,
+		instance:   newInstanceID(),
+		maxBytes:   config.S3MaxObjectBytes,
+		maxPending: config.S3MaxPending,
+		ctx:        ctx,
+		cancel:     cancel,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if e.maxBytes <= 0 {
+		e.maxBytes = defaultS3MaxObjectBytes
+	}
+	if e.maxPending <= 0 {
+		e.maxPending = defaultS3MaxPending
+	}
+	return e
+}
+
+// objectKey names an object by the UTC time it was closed, the exporting
+// process and a sequence number, so objects closed within the same second
+// by this process, another replica or a restart don't collide, e.g.
+// "events/2024/03/10/120000-web-1-3f9a0c2e-000001.jsonl.gz".
+func (e *s3Exporter) objectKey(now time.Time) string {
+	e.seq++
+	return fmt.Sprintf("%s%s-%s-%06d.jsonl.gz", e.prefix, now.UTC().Format("2006/01/02/150405"), e.instance, e.seq)
+}
+
+// newInstanceID names this process as its host name plus a random suffix,
+// since a restarted process, or one in another container, may reuse the
+// host name and pid.
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "host"
+	}
+	suffix := make([]byte, 4)
+	cryptorand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// add appends an event, closing the object once it reaches maxBytes.
+func (e *s3Exporter) add(data *TrackingData) {
+	line, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode event for S3: %v", err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buf.Write(line)
+	e.buf.WriteByte('\n')
+	if e.buf.Len() >= e.maxBytes {
+		e.rotate(time.Now())
+	}
+}
+
+// rotate gzips the buffered events into a pending object. Callers hold mu.
+func (e *s3Exporter) rotate(now time.Time) {
+	if e.buf.Len() == 0 {
+		return
+	}
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write(e.buf.Bytes())
+	zw.Close()
+	e.buf.Reset()
+
+	e.pending = append(e.pending, s3Object{key: e.objectKey(now), body: body.Bytes()})
+	if over := len(e.pending) - e.maxPending; over > 0 {
+		e.pending = e.pending[over:]
+		e.dropped.Add(int64(over))
+	}
+}
+
+// flush closes the current object and uploads everything pending in order,
+// stopping at the first failure so the rest is retried next time. While the
+// breaker is open nothing is uploaded.
+func (e *s3Exporter) flush(ctx context.Context, now time.Time) error {
+	e.flushing.Lock()
+	defer e.flushing.Unlock()
+
+	e.mu.Lock()
+	e.rotate(now)
+	pending := e.pending
+	e.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if !e.breaker.allow() {
+		return errBreakerOpen
+	}
+	done := make(map[string]bool, len(pending))
+	var err error
+	for _, obj := range pending {
+		if err = e.uploader.Upload(ctx, e.bucket, obj.key, obj.body); err != nil {
+			e.failures.Add(1)
+			e.breaker.failure()
+			break
+		}
+		e.uploaded.Add(1)
+		done[obj.key] = true
+	}
+	if err == nil {
+		e.breaker.success()
+	}
+
+	// More objects may have been rotated in, or dropped past maxPending,
+	// while uploading, so remove the uploaded ones by key.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	kept := e.pending[:0]
+	for _, obj := range e.pending {
+		if !done[obj.key] {
+			kept = append(kept, obj)
+		}
+	}
+	e.pending = kept
+	return err
+}
+
+func (e *s3Exporter) run(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := e.flush(e.ctx, now); err != nil {
+				log.Printf("S3 upload failed, retrying at next flush: %v", err)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// close stops the periodic flush and uploads the current object and
+// everything pending. Whatever ctx ends before is lost.
+func (e *s3Exporter) close(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		e.cancel()
+		<-e.done
+		return ctx.Err()
+	}
+	return e.flush(ctx, time.Now())
+}
+
+func (e *s3Exporter) writeMetrics(w io.Writer, openMetrics bool) {
+	e.mu.Lock()
+	pending := len(e.pending)
+	e.mu.Unlock()
+	fmt.Fprintln(w, "# HELP pixel_tracker_s3_pending_objects Objects waiting to be uploaded to S3.")
+	fmt.Fprintln(w, "# TYPE pixel_tracker_s3_pending_objects gauge")
+	fmt.Fprintf(w, "pixel_tracker_s3_pending_objects %d\n", pending)
+	writeCounterHeader(w, "pixel_tracker_s3_uploaded_total", "Objects uploaded to S3.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_s3_uploaded_total %d\n", e.uploaded.Load())
+	writeCounterHeader(w, "pixel_tracker_s3_failures_total", "Failed S3 uploads, each retried at the next flush.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_s3_failures_total %d\n", e.failures.Load())
+	writeCounterHeader(w, "pixel_tracker_s3_dropped_total", "Objects dropped because too many were pending.", openMetrics)
+	fmt.Fprintf(w, "pixel_tracker_s3_dropped_total %d\n", e.dropped.Load())
+}
+
+// StartS3Export archives every stored event to S3Bucket as gzipped JSON
+// lines, flushing every S3FlushInterval. S3Endpoint can point at any
+// S3-compatible service such as MinIO.
+func (pt *PixelTracker) StartS3Export() error {
+	if pt.config().S3Bucket == "" {
+		return errors.New("S3Bucket is required")
+	}
+	endpoint := pt.config().S3Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(pt.config().S3AccessKey, pt.config().S3SecretKey, ""),
+		Secure: !pt.config().S3Insecure,
+		Region: pt.config().S3Region,
+	})
+	if err != nil {
+		return err
+	}
+	pt.startS3Exporter(minioUploader{client})
+	return nil
+}
+
+func (pt *PixelTracker) startS3Exporter(uploader S3Uploader) *s3Exporter {
+	exporter := newS3Exporter(uploader, pt.newBreaker("s3"), *pt.config())
+	interval := pt.config().S3FlushInterval
+	if interval <= 0 {
+		interval = defaultS3FlushInterval
+	}
+	go exporter.run(interval)
+
+	pt.mu.Lock()
+	pt.s3 = exporter
+	pt.mu.Unlock()
+	pt.UseNamed("s3", exporter.add)
+	return exporter
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type uploadedObject struct {
+	bucket string
+	key    string
+	body   []byte
+}
+
+type mockUploader struct {
+	mu       sync.Mutex
+	failures int
+	objects  []uploadedObject
+}
+
+func (m *mockUploader) Upload(ctx context.Context, bucket, key string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("bucket unavailable")
+	}
+	m.objects = append(m.objects, uploadedObject{bucket, key, body})
+	return nil
+}
+
+func (m *mockUploader) uploaded() []uploadedObject {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]uploadedObject(nil), m.objects...)
+}
+
+func gunzipEvents(t *testing.T, body []byte) []TrackingData {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected gzip content: %v", err)
+	}
+	var events []TrackingData
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var event TrackingData
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Expected JSON lines: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestS3Export(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.S3Bucket = "archive"
+	config.S3Prefix = "events/"
+	config.S3FlushInterval = time.Hour
+	tracker.Configure(config)
+
+	// The first upload fails; the object must be retried, not lost.
+	uploader := &mockUploader{failures: 1}
+	exporter := tracker.startS3Exporter(uploader)
+
+	tracker.storeAndDispatch(&TrackingData{Path: "/welcome", Timestamp: time.Now()})
+	tracker.storeAndDispatch(&TrackingData{Path: "/pricing", Timestamp: time.Now()})
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	if err := exporter.flush(context.Background(), now); err == nil {
+		t.Fatal("Expected the first flush to fail")
+	}
+	if err := exporter.flush(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected the retry to succeed, got %v", err)
+	}
+
+	objects := uploader.uploaded()
+	if len(objects) != 1 {
+		t.Fatalf("Expected 1 object, got %d", len(objects))
+	}
+	obj := objects[0]
+	if obj.bucket != "archive" || obj.key != "events/2024/03/10/120000-"+exporter.instance+"-000001.jsonl.gz" {
+		t.Errorf("Unexpected bucket %q and key %q", obj.bucket, obj.key)
+	}
+	events := gunzipEvents(t, obj.body)
+	if len(events) != 2 || events[0].Path != "/welcome" || events[1].Path != "/pricing" {
+		t.Errorf("Expected both events in order, got %+v", events)
+	}
+
+	// Nothing new means no empty objects.
+	exporter.flush(context.Background(), now.Add(2*time.Minute))
+	if got := len(uploader.uploaded()); got != 1 {
+		t.Errorf("Expected no upload without new events, got %d objects", got)
+	}
+}
+
+func TestS3ExportRotatesBySize(t *testing.T) {
+	config := Config{S3Bucket: "archive", S3MaxObjectBytes: 1, S3MaxPending: 2}
+	uploader := &mockUploader{}
+	exporter := newS3Exporter(uploader, newCircuitBreaker("s3", 0, 0), config)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		exporter.add(&TrackingData{Path: path})
+	}
+	if err := exporter.flush(context.Background(), time.Now()); err != nil {
+		t.Fatalf("flush() returned error: %v", err)
+	}
+
+	// Each event filled an object; the oldest was dropped past S3MaxPending.
+	objects := uploader.uploaded()
+	if len(objects) != 2 {
+		t.Fatalf("Expected 2 objects, got %d", len(objects))
+	}
+	if events := gunzipEvents(t, objects[0].body); len(events) != 1 || events[0].Path != "/b" {
+		t.Errorf("Expected the first kept object to hold /b, got %+v", events)
+	}
+	if exporter.dropped.Load() != 1 {
+		t.Errorf("Expected 1 dropped object, got %d", exporter.dropped.Load())
+	}
+}
+
+func TestS3ObjectKeysPerProcess(t *testing.T) {
+	// A restarted process starts its sequence over; its keys must not
+	// overwrite the previous process's objects.
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	before := newS3Exporter(&mockUploader{}, newCircuitBreaker("s3", 0, 0), Config{S3Bucket: "archive"})
+	after := newS3Exporter(&mockUploader{}, newCircuitBreaker("s3", 0, 0), Config{S3Bucket: "archive"})
+	if a, b := before.objectKey(now), after.objectKey(now); a == b {
+		t.Errorf("Expected different keys from different processes, both got %q", a)
+	}
+	host, _ := os.Hostname()
+	if !strings.HasPrefix(before.instance, host+"-") {
+		t.Errorf("Expected the instance to start with the host name %q, got %q", host, before.instance)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// enrichCookieBlocked flags cross-site requests that arrive without the
+// tracking cookie. The cookie is issued without SameSite=None, so browsers
+// default it to Lax and hold it back from cross-site image loads; a missing
+// cookie there usually means it was withheld rather than never set.
+func (pt *PixelTracker) enrichCookieBlocked(data *TrackingData, r *http.Request) {
+	if pt.config().DisableCookies || r.Header.Get("Sec-Fetch-Site") != "cross-site" {
+		return
+	}
+	if _, err := r.Cookie(pt.config().CookieName); err != nil {
+		data.CookieBlocked = true
+	}
+}
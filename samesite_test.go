@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieBlocked(t *testing.T) {
+	tests := []struct {
+		name      string
+		fetchSite string
+		hasCookie bool
+		expected  bool
+	}{
+		{"Same-site with cookie", "same-site", true, false},
+		{"Same-site without cookie", "same-site", false, false},
+		{"Cross-site with cookie", "cross-site", true, false},
+		{"Cross-site without cookie", "cross-site", false, true},
+		{"No fetch metadata", "", false, false},
+	}
+
+	tracker := NewPixelTracker()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			if tt.fetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			if tt.hasCookie {
+				req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: "visitor"})
+			}
+
+			data := &TrackingData{}
+			tracker.enrichCookieBlocked(data, req)
+			if data.CookieBlocked != tt.expected {
+				t.Errorf("Expected CookieBlocked %v, got %v", tt.expected, data.CookieBlocked)
+			}
+		})
+	}
+}
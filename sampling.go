@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+)
+
+// sample decides whether an event is stored. A true SampleNoTrackParam drops
+// the event and a true SampleDebugParam keeps it, whatever the rate; both
+// take precedence over AlwaysKeepEvents, which in turn bypass sampling. Kept
+// events are recorded at rate 1 so that estimates stay correct when rates
+// are mixed.
+func (pt *PixelTracker) sample(data *TrackingData) bool {
+	if overrideParam(data, pt.config().SampleNoTrackParam) {
+		return false
+	}
+	if overrideParam(data, pt.config().SampleDebugParam) {
+		if pt.config().EnableSampling {
+			data.SampleRate = 1
+		}
+		return true
+	}
+
+	if !pt.config().EnableSampling {
+		return true
+	}
+
+	if data.Event != "" && slices.Contains(pt.config().AlwaysKeepEvents, data.Event) {
+		data.SampleRate = 1
+		return true
+	}
+
+	rate := pt.effectiveSampleRate()
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	data.SampleRate = rate
+	return true
+}
+
+// overrideParam reports whether the named query param is set to a true value
+// such as 1. An empty name disables the override.
+func overrideParam(data *TrackingData, name string) bool {
+	if name == "" {
+		return false
+	}
+	on, _ := strconv.ParseBool(data.Query[name])
+	return on
+}
+
+func (pt *PixelTracker) effectiveSampleRate() float64 {
+	if !pt.config().EnableSampling {
+		return 1
+	}
+	rate := pt.config().SampleRate
+	if rate < 0 {
+		return 0
+	}
+	if rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// sampleWeight is how many original events a stored event stands for.
+func sampleWeight(event TrackingData) float64 {
+	if event.SampleRate <= 0 {
+		return 1
+	}
+	return 1 / event.SampleRate
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSamplingSummary(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableSampling = true
+	config.SampleRate = 0.25
+	config.AlwaysKeepEvents = []string{"purchase"}
+	tracker.Configure(config)
+
+	const pageviews = 4000
+	for i := 0; i < pageviews; i++ {
+		tracker.storeAndDispatch(&TrackingData{Event: "pageview", Query: map[string]string{}})
+	}
+	for i := 0; i < 10; i++ {
+		tracker.storeAndDispatch(&TrackingData{Event: "purchase", Query: map[string]string{}})
+	}
+
+	data := tracker.GetTrackingData()
+	purchases := 0
+	for _, event := range data {
+		if event.Event == "purchase" {
+			purchases++
+			if event.SampleRate != 1 {
+				t.Errorf("Expected always-kept event to have rate 1, got %v", event.SampleRate)
+			}
+		} else if event.SampleRate != 0.25 {
+			t.Errorf("Expected sampled event to have rate 0.25, got %v", event.SampleRate)
+		}
+	}
+	if purchases != 10 {
+		t.Errorf("Expected all 10 purchases to be kept, got %d", purchases)
+	}
+
+	rr := httptest.NewRecorder()
+	tracker.SummaryHandler(rr, httptest.NewRequest("GET", "/stats/summary", nil))
+
+	var summary Summary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("Failed to unmarshal summary: %v", err)
+	}
+
+	if summary.SampleRate != 0.25 {
+		t.Errorf("Expected sample rate 0.25, got %v", summary.SampleRate)
+	}
+	expected := float64(pageviews + 10)
+	if math.Abs(summary.EstimatedTotal-expected)/expected > 0.15 {
+		t.Errorf("Expected estimated total near %v, got %v (stored %d)", expected, summary.EstimatedTotal, summary.TotalOpens)
+	}
+	if summary.TotalOpens >= pageviews/2 {
+		t.Errorf("Expected sampling to drop most pageviews, stored %d", summary.TotalOpens)
+	}
+}
+
+func TestSamplingDisabled(t *testing.T) {
+	tracker := NewPixelTracker()
+	for i := 0; i < 5; i++ {
+		tracker.storeAndDispatch(&TrackingData{Query: map[string]string{}})
+	}
+
+	summary := Summarize(tracker.GetTrackingData())
+	if summary.TotalOpens != 5 || summary.EstimatedTotal != 5 {
+		t.Errorf("Expected 5 stored and estimated events without sampling, got %d and %v", summary.TotalOpens, summary.EstimatedTotal)
+	}
+}
+
+func TestSamplingOverrideParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   float64
+		query  map[string]string
+		event  string
+		stored bool
+	}{
+		{"Debug forces capture at rate 0", 0, map[string]string{"debug": "1"}, "", true},
+		{"Notrack forces drop at rate 1", 1, map[string]string{"notrack": "1"}, "", false},
+		{"Notrack beats always-kept event", 1, map[string]string{"notrack": "1"}, "purchase", false},
+		{"Notrack beats debug", 1, map[string]string{"debug": "1", "notrack": "1"}, "", false},
+		{"False value ignored", 0, map[string]string{"debug": "0"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.EnableSampling = true
+			config.SampleRate = tt.rate
+			config.AlwaysKeepEvents = []string{"purchase"}
+			config.SampleDebugParam = "debug"
+			config.SampleNoTrackParam = "notrack"
+			tracker.Configure(config)
+
+			tracker.storeAndDispatch(&TrackingData{Event: tt.event, Query: tt.query})
+
+			data := tracker.GetTrackingData()
+			if stored := len(data) == 1; stored != tt.stored {
+				t.Fatalf("Expected stored=%v, got %d events", tt.stored, len(data))
+			}
+			if tt.stored && data[0].SampleRate != 1 {
+				t.Errorf("Expected forced event to have rate 1, got %v", data[0].SampleRate)
+			}
+		})
+	}
+}
+
+func TestSamplingOverrideParamsDisabled(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableSampling = true
+	config.SampleRate = 0
+	tracker.Configure(config)
+
+	tracker.storeAndDispatch(&TrackingData{Query: map[string]string{"debug": "1"}})
+	if n := len(tracker.GetTrackingData()); n != 0 {
+		t.Errorf("Expected debug param to be ignored when not configured, got %d events", n)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// FieldRule constrains one top-level field of a JSON payload. Type is one of
+// string, number, bool, object or array; an empty Type accepts any value.
+type FieldRule struct {
+	Type     string
+	Required bool
+}
+
+// EventSchema maps payload field names to their rules. Fields not listed are
+// accepted as-is.
+type EventSchema map[string]FieldRule
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate checks payload against the schema and returns one error per
+// failing field, sorted by field name.
+func (s EventSchema) Validate(payload map[string]any) []FieldError {
+	var errs []FieldError
+	for field, rule := range s {
+		value, ok := payload[field]
+		if !ok || value == nil {
+			if rule.Required {
+				errs = append(errs, FieldError{field, "is required"})
+			}
+			continue
+		}
+		if rule.Type != "" && !matchesType(value, rule.Type) {
+			errs = append(errs, FieldError{field, fmt.Sprintf("must be a %s", rule.Type)})
+			continue
+		}
+		if str, isString := value.(string); rule.Required && isString && str == "" {
+			errs = append(errs, FieldError{field, "must not be empty"})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+func matchesType(value any, kind string) bool {
+	switch kind {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	default:
+		return false
+	}
+}
+
+// validatePayload checks the PayloadParam of a request against EventSchema.
+// Requests without a payload are plain pixel hits and are not validated.
+func (pt *PixelTracker) validatePayload(r *http.Request) []FieldError {
+	if len(pt.config().EventSchema) == 0 || pt.config().PayloadParam == "" {
+		return nil
+	}
+	raw := r.URL.Query().Get(pt.config().PayloadParam)
+	if raw == "" {
+		return nil
+	}
+
+	payload, ok := decodePayload(raw)
+	if !ok {
+		return []FieldError{{pt.config().PayloadParam, "must be base64-encoded JSON"}}
+	}
+	return pt.config().EventSchema.Validate(payload)
+}
+
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Errors []FieldError `json:"errors"`
+	}{errs})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEventSchema(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.PayloadParam = "d"
+	config.EventSchema = EventSchema{
+		"event": {Type: "string", Required: true},
+		"value": {Type: "number"},
+	}
+	tracker.Configure(config)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+		expectedErrors []FieldError
+	}{
+		{
+			name:           "Conforming payload",
+			payload:        `{"event":"signup","value":12.5}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Missing required field",
+			payload:        `{"value":3}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []FieldError{{"event", "is required"}},
+		},
+		{
+			name:           "Wrong types",
+			payload:        `{"event":42,"value":"ten"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []FieldError{{"event", "must be a string"}, {"value", "must be a number"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := base64.RawURLEncoding.EncodeToString([]byte(tt.payload))
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif?d="+encoded, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Errors []FieldError `json:"errors"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if len(body.Errors) != len(tt.expectedErrors) {
+				t.Fatalf("Expected errors %v, got %v", tt.expectedErrors, body.Errors)
+			}
+			for i, expected := range tt.expectedErrors {
+				if body.Errors[i] != expected {
+					t.Errorf("Expected error %v, got %v", expected, body.Errors[i])
+				}
+			}
+		})
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 1 {
+		t.Fatalf("Expected only the conforming event to be stored, got %d", len(data))
+	}
+	if data[0].Payload["event"] != "signup" {
+		t.Errorf("Expected stored payload event signup, got %v", data[0].Payload["event"])
+	}
+}
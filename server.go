@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Router returns the tracker's routes wrapped in the rate limiter.
+func (pt *PixelTracker) Router() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/pixel.gif", pt.PixelHandler).Methods("GET", "HEAD", "POST")
+	r.HandleFunc("/batch", pt.BatchHandler).Methods("POST")
+	r.HandleFunc("/tracker.js", pt.TrackerScriptHandler).Methods("GET")
+	r.HandleFunc("/stats", pt.StatsHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/stats/summary", pt.SummaryHandler).Methods("GET")
+	r.HandleFunc("/stats/engagement", pt.EngagementHandler).Methods("GET")
+	r.HandleFunc("/stats/funnel", pt.FunnelHandler).Methods("GET")
+	r.HandleFunc("/stats/attribution", pt.AttributionHandler).Methods("GET")
+	r.HandleFunc("/stats/journey", pt.requireAdmin(pt.JourneyHandler)).Methods("GET")
+	// Registered after the fixed /stats routes so they take precedence.
+	r.HandleFunc("/stats/{id}", pt.requireAdmin(pt.EventHandler)).Methods("GET")
+	r.HandleFunc("/metrics", pt.MetricsHandler).Methods("GET")
+	r.HandleFunc("/healthz", pt.HealthHandler).Methods("GET")
+	r.HandleFunc("/debug/echo", pt.DebugEchoHandler).Methods("GET")
+	r.HandleFunc("/admin/blocked-tokens", pt.requireAdmin(pt.BlockedTokensHandler)).Methods("GET")
+	r.HandleFunc("/admin/blocked-tokens/{token}", pt.requireAdmin(pt.BlockedTokensHandler)).Methods("PUT", "DELETE")
+	r.HandleFunc("/dashboard", pt.requireAdmin(serveDashboard)).Methods("GET")
+	r.HandleFunc("/", serveTestPage).Methods("GET")
+	r.NotFoundHandler = http.HandlerFunc(pt.NotFoundHandler)
+	return pt.RateLimit(r)
+}
+
+// Server builds an http.Server listening on the configured port.
+func (pt *PixelTracker) Server() *http.Server {
+	return &http.Server{
+		Addr:      ":" + pt.config().Port,
+		Handler:   pt.Router(),
+		TLSConfig: pt.tlsConfig(),
+	}
+}
+
+// ServeTLS serves the tracker over HTTPS, refusing handshakes below
+// MinTLSVersion, and over HTTP/3 too when EnableHTTP3 is on.
+func (pt *PixelTracker) ServeTLS(certFile, keyFile string) error {
+	if pt.config().EnableHTTP3 {
+		return pt.serveWithHTTP3(certFile, keyFile)
+	}
+	return pt.Server().ListenAndServeTLS(certFile, keyFile)
+}
+
+// tlsConfig leaves the minimum at Go's default (TLS 1.2) when unset.
+func (pt *PixelTracker) tlsConfig() *tls.Config {
+	return &tls.Config{MinVersion: pt.config().MinTLSVersion}
+}
+
+// parseTLSVersion maps "1.0" to "1.3" onto the crypto/tls constants.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", version)
+}
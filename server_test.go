@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMinTLSVersion(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.MinTLSVersion = tls.VersionTLS13
+	tracker.Configure(config)
+
+	server := httptest.NewUnstartedServer(tracker.Router())
+	server.TLS = tracker.tlsConfig()
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		version   uint16
+		expectErr bool
+	}{
+		{"TLS 1.1 rejected", tls.VersionTLS11, true},
+		{"TLS 1.2 rejected", tls.VersionTLS12, true},
+		{"TLS 1.3 accepted", tls.VersionTLS13, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					MinVersion:         tt.version,
+					MaxVersion:         tt.version,
+				},
+			}}
+
+			resp, err := client.Get(server.URL + "/pixel.gif")
+			if tt.expectErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("Expected handshake to fail for TLS version %x", tt.version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected handshake to succeed, got %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	if version, err := parseTLSVersion("1.3"); err != nil || version != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got %x (%v)", version, err)
+	}
+	if _, err := parseTLSVersion("1.4"); err == nil {
+		t.Error("Expected error for unknown TLS version")
+	}
+}
+
+func TestRequestProto(t *testing.T) {
+	tests := []struct {
+		proto    string
+		major    int
+		expected string
+	}{
+		{"HTTP/3.0", 3, "h3"},
+		{"HTTP/2.0", 2, "h2"},
+		{"HTTP/1.1", 1, "http/1.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/pixel.gif", nil)
+		req.Proto, req.ProtoMajor = tt.proto, tt.major
+		if got := requestProto(req); got != tt.expected {
+			t.Errorf("requestProto(%s) = %q, want %q", tt.proto, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds how long SIGTERM and SIGHUP wait for the Kafka sink
+// and S3 export to flush.
+const shutdownTimeout = 30 * time.Second
+
+// Shutdown stops the Kafka sink and S3 export, publishing queued events and
+// uploading buffered ones first. Events they still hold when ctx ends are
+// dropped, and ctx's error is returned. Events recorded afterwards are no
+// longer sent to either.
+func (pt *PixelTracker) Shutdown(ctx context.Context) error {
+	pt.mu.RLock()
+	sink := pt.kafka
+	exporter := pt.s3
+	pt.mu.RUnlock()
+
+	var errs []error
+	if sink != nil {
+		if err := sink.close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if exporter != nil {
+		if err := exporter.close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleSIGTERM flushes the Kafka sink and S3 export on SIGTERM or SIGINT,
+// then exits.
+func (pt *PixelTracker) handleSIGTERM() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+
+	go func() {
+		<-sig
+		log.Printf("Shutting down, flushing Kafka and S3")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err := pt.Shutdown(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Shutdown flush failed: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
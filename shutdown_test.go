@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShutdownFlushesSinks(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.KafkaTopic = "pixel-events"
+	config.S3Bucket = "archive"
+	config.S3FlushInterval = time.Hour
+	tracker.Configure(config)
+
+	producer := &mockProducer{}
+	if err := tracker.startKafkaSink(producer); err != nil {
+		t.Fatalf("startKafkaSink() returned error: %v", err)
+	}
+	uploader := &mockUploader{}
+	tracker.startS3Exporter(uploader)
+
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor", Path: "/welcome", Timestamp: time.Now()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracker.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+	if got := len(producer.published()); got != 1 {
+		t.Errorf("Expected the queued event to be published, got %d", got)
+	}
+	objects := uploader.uploaded()
+	if len(objects) != 1 {
+		t.Fatalf("Expected the buffered event to be uploaded, got %d objects", len(objects))
+	}
+	if events := gunzipEvents(t, objects[0].body); len(events) != 1 || events[0].Path != "/welcome" {
+		t.Errorf("Expected the event in the final object, got %+v", events)
+	}
+
+	// Events after shutdown are not sent anywhere.
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor", Path: "/late", Timestamp: time.Now()})
+	if dropped := tracker.kafka.dropped.Load(); dropped != 1 {
+		t.Errorf("Expected the late event to be dropped by the Kafka sink, got %d", dropped)
+	}
+}
+
+func TestShutdownGivesUpAtDeadline(t *testing.T) {
+	producer := &mockProducer{block: make(chan struct{})}
+	sink := newKafkaSink(producer, newCircuitBreaker("kafka", 0, 0), "pixel-events", jsonCodec{}, 100)
+	sink.publish(&TrackingData{Token: "first"})
+	sink.publish(&TrackingData{Token: "second"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sink.close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected close to return at the deadline, took %v", elapsed)
+	}
+	if dropped := sink.dropped.Load(); dropped != 2 {
+		t.Errorf("Expected both undelivered events to be dropped, got %d", dropped)
+	}
+}
+
+func TestFlushWritesOutSinks(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.KafkaTopic = "pixel-events"
+	config.S3Bucket = "archive"
+	config.S3FlushInterval = time.Hour
+	tracker.Configure(config)
+
+	producer := &mockProducer{block: make(chan struct{})}
+	if err := tracker.startKafkaSink(producer); err != nil {
+		t.Fatalf("startKafkaSink() returned error: %v", err)
+	}
+	uploader := &mockUploader{}
+	tracker.startS3Exporter(uploader)
+
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor", Path: "/welcome", Timestamp: time.Now()})
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor", Path: "/pricing", Timestamp: time.Now()})
+	close(producer.block)
+
+	if err := tracker.Flush(); err != nil {
+		t.Fatalf("Flush() returned error: %v", err)
+	}
+	if got := len(producer.published()); got != 2 {
+		t.Errorf("Expected the Kafka queue to be published, got %d events", got)
+	}
+	if got := len(uploader.uploaded()); got != 1 {
+		t.Errorf("Expected the S3 buffer to be uploaded, got %d objects", got)
+	}
+
+	// The sinks keep running after a flush.
+	tracker.storeAndDispatch(&TrackingData{Token: "visitor", Path: "/later", Timestamp: time.Now()})
+	if err := tracker.Flush(); err != nil {
+		t.Fatalf("Flush() returned error: %v", err)
+	}
+	if got := len(producer.published()); got != 3 {
+		t.Errorf("Expected the later event to be published, got %d events", got)
+	}
+}
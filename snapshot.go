@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Snapshot writes every stored event to path as a JSON array. The file is
+// written next to path and renamed into place so readers never see a
+// partial snapshot.
+func (pt *PixelTracker) Snapshot(path string) error {
+	data := pt.GetTrackingData()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Flush writes out what the sinks still buffer: it waits for the Kafka sink
+// to publish its queue and uploads the S3 export's current and pending
+// objects, giving up after shutdownTimeout. Events are appended to the store
+// synchronously, so it needs no flushing. SIGHUP calls it before taking a
+// snapshot.
+func (pt *PixelTracker) Flush() error {
+	pt.mu.RLock()
+	sink := pt.kafka
+	exporter := pt.s3
+	pt.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var errs []error
+	if sink != nil {
+		if err := sink.flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("kafka: %w", err))
+		}
+	}
+	if exporter != nil {
+		if err := exporter.flush(ctx, time.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("s3: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleSIGHUP flushes on every SIGHUP and, when snapshotPath is set, writes
+// a full snapshot there.
+func (pt *PixelTracker) handleSIGHUP(snapshotPath string) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			// The snapshot covers the store, so a sink that can't be
+			// flushed doesn't hold it up.
+			if err := pt.Flush(); err != nil {
+				log.Printf("Flush failed: %v", err)
+			}
+			if snapshotPath == "" {
+				continue
+			}
+			if err := pt.Snapshot(snapshotPath); err != nil {
+				log.Printf("Snapshot to %s failed: %v", snapshotPath, err)
+				continue
+			}
+			log.Printf("Wrote snapshot to %s", snapshotPath)
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	tracker := NewPixelTracker()
+	for _, event := range sampleEvents(3) {
+		tracker.storeAndDispatch(&event)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := tracker.Snapshot(path); err != nil {
+		t.Fatalf("Snapshot returned error: %v", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+
+	var events []TrackingData
+	if err := json.Unmarshal(contents, &events); err != nil {
+		t.Fatalf("Failed to unmarshal snapshot: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events in snapshot, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Query["id"] != sampleEvents(3)[i].Query["id"] {
+			t.Errorf("Expected event %d to have id %q, got %q", i, sampleEvents(3)[i].Query["id"], event.Query["id"])
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to list snapshot dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the snapshot file to remain, got %d entries", len(entries))
+	}
+}
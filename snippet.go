@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"text/template"
+)
+
+const defaultSnippetEndpoint = "/pixel.gif"
+
+// trackerSnippet fires the pixel once per page load with page metadata. The
+// document referrer goes in a query param since the pixel request's own
+// Referer header is the page itself.
+var trackerSnippet = template.Must(template.New("tracker.js").Parse(`(function () {
+  var params = new URLSearchParams({
+    url: location.href,
+    title: document.title,
+    "{{js .RefererParam}}": document.referrer,
+    sw: String(screen.width),
+    sh: String(screen.height),
+    rt: String(Math.round(performance.now())),
+    tz: String(new Date().getTimezoneOffset())
+  });
+  var img = new Image(1, 1);
+  img.src = "{{js .Endpoint}}?" + params.toString();
+})();
+`))
+
+type snippetOptions struct {
+	Endpoint     string
+	RefererParam string
+}
+
+// TrackerScriptHandler serves a drop-in tag that calls the configured pixel
+// endpoint.
+func (pt *PixelTracker) TrackerScriptHandler(w http.ResponseWriter, r *http.Request) {
+	opts := snippetOptions{
+		Endpoint:     pt.config().SnippetEndpoint,
+		RefererParam: pt.config().RefererParam,
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = defaultSnippetEndpoint
+	}
+	if opts.RefererParam == "" {
+		opts.RefererParam = "ref"
+	}
+
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if err := trackerSnippet.Execute(w, opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
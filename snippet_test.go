@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrackerScriptHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.SnippetEndpoint = "https://t.example.com/pixel.gif"
+	config.RefererParam = "src"
+	tracker.Configure(config)
+
+	rr := httptest.NewRecorder()
+	tracker.TrackerScriptHandler(rr, httptest.NewRequest("GET", "/tracker.js", nil))
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/javascript" {
+		t.Errorf("Expected Content-Type application/javascript, got %q", ct)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"https://t.example.com/pixel.gif?"`) {
+		t.Errorf("Expected snippet to reference the configured endpoint, got:\n%s", body)
+	}
+	if !strings.Contains(body, `"src": document.referrer`) {
+		t.Errorf("Expected snippet to send the referrer as src, got:\n%s", body)
+	}
+}
+
+func TestTrackerScriptHandlerDefaults(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	rr := httptest.NewRecorder()
+	tracker.TrackerScriptHandler(rr, httptest.NewRequest("GET", "/tracker.js", nil))
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `"/pixel.gif?"`) {
+		t.Errorf("Expected snippet to default to /pixel.gif, got:\n%s", body)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Storage persists tracked events. The default is the in-memory DataStore;
+// SetStorage swaps in another backend.
+type Storage interface {
+	Append(event TrackingData) error
+	Query(filter QueryFilter) ([]TrackingData, error)
+}
+
+// EventGetter is implemented by storage backends that index events by ID.
+// Backends without it are scanned instead.
+type EventGetter interface {
+	Get(id string) (TrackingData, bool, error)
+}
+
+// EventScanner is implemented by storage backends that can hand matching
+// events over one at a time, which lets /stats stream large responses
+// instead of building the whole result first. fn's error stops the scan.
+type EventScanner interface {
+	Scan(filter QueryFilter, fn func(TrackingData) error) error
+}
+
+// eventIDBytes is the random size of event IDs, shorter than visitor tokens
+// since they only need to be unique, not unguessable across visitors.
+const eventIDBytes = 12
+
+// QueryFilter narrows a Storage query. The zero value matches every event.
+type QueryFilter struct {
+	Since  time.Time
+	Tenant string
+}
+
+func (ds *DataStore) Append(event TrackingData) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if event.ID != "" {
+		if ds.byID == nil {
+			ds.byID = make(map[string]int)
+		}
+		ds.byID[event.ID] = len(ds.data)
+	}
+	ds.data = append(ds.data, event)
+	return nil
+}
+
+func (ds *DataStore) Get(id string) (TrackingData, bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	i, ok := ds.byID[id]
+	if !ok {
+		return TrackingData{}, false, nil
+	}
+	return ds.data[i], true, nil
+}
+
+// Query returns a copy of the matching events in insertion order.
+func (ds *DataStore) Query(filter QueryFilter) ([]TrackingData, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	if filter.Tenant == "" {
+		dataCopy := make([]TrackingData, len(ds.data))
+		copy(dataCopy, ds.data)
+		return filterSince(dataCopy, filter.Since), nil
+	}
+
+	matched := []TrackingData{}
+	for _, event := range ds.data {
+		if event.Tenant == filter.Tenant {
+			matched = append(matched, event)
+		}
+	}
+	return filterSince(matched, filter.Since), nil
+}
+
+// Scan visits the matching events in insertion order without copying them.
+// Events are only ever appended, so the slice as of the call stays valid
+// after the lock is released and a slow reader doesn't hold up writers.
+func (ds *DataStore) Scan(filter QueryFilter, fn func(TrackingData) error) error {
+	ds.mu.RLock()
+	data := ds.data
+	ds.mu.RUnlock()
+
+	for _, event := range data {
+		if filter.Tenant != "" && event.Tenant != filter.Tenant {
+			continue
+		}
+		if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+			continue
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireEvents removes the events for which expired returns true. The kept
+// events go into a new slice, so Scan callers holding the old one are
+// unaffected.
+func (ds *DataStore) ExpireEvents(expired func(TrackingData) bool) (int, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	kept := make([]TrackingData, 0, len(ds.data))
+	byID := make(map[string]int, len(ds.byID))
+	for _, event := range ds.data {
+		if expired(event) {
+			continue
+		}
+		if event.ID != "" {
+			byID[event.ID] = len(kept)
+		}
+		kept = append(kept, event)
+	}
+	removed := len(ds.data) - len(kept)
+	if removed > 0 {
+		ds.data, ds.byID = kept, byID
+	}
+	return removed, nil
+}
+
+func (pt *PixelTracker) SetStorage(storage Storage) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.storage = storage
+	pt.rebuildQueryCache()
+	if pt.aggregates != nil {
+		pt.aggregates.invalidate()
+	}
+	// Seed dedup from the new backend rather than the old one.
+	if pt.dedup != nil && pt.config().PersistDedup {
+		pt.dedup = newDedupCache(pt.config().DedupWindow, pt.config().MaxDedupKeys)
+	}
+}
+
+// store is the Storage that reads and writes go through, with the query
+// cache in front when enabled.
+func (pt *PixelTracker) store() Storage {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	if pt.queryCache != nil {
+		return pt.queryCache
+	}
+	return pt.storage
+}
+
+// query reads from storage, scoped to this tracker's tenant.
+func (pt *PixelTracker) query(filter QueryFilter) []TrackingData {
+	filter.Tenant = pt.config().Tenant
+	data, err := pt.store().Query(filter)
+	if err != nil {
+		log.Printf("Storage query failed: %v", err)
+		return []TrackingData{}
+	}
+	return data
+}
+
+// scan visits every event of this tracker's tenant in insertion order,
+// streaming them when the backend supports it.
+func (pt *PixelTracker) scan(fn func(TrackingData) error) error {
+	filter := QueryFilter{Tenant: pt.config().Tenant}
+	if scanner, ok := pt.store().(EventScanner); ok {
+		return scanner.Scan(filter, fn)
+	}
+	data, err := pt.store().Query(filter)
+	if err != nil {
+		return err
+	}
+	for _, event := range data {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// event looks up a single event of this tracker's tenant by ID.
+func (pt *PixelTracker) event(id string) (TrackingData, bool) {
+	var (
+		event TrackingData
+		found bool
+		err   error
+	)
+	if getter, ok := pt.store().(EventGetter); ok {
+		event, found, err = getter.Get(id)
+	} else {
+		for _, e := range pt.query(QueryFilter{}) {
+			if e.ID == id {
+				event, found = e, true
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Storage get failed: %v", err)
+		return TrackingData{}, false
+	}
+	if !found || (pt.config().Tenant != "" && event.Tenant != pt.config().Tenant) {
+		return TrackingData{}, false
+	}
+	return event, true
+}
+
+// EventHandler serves a single event by ID, or 404.
+func (pt *PixelTracker) EventHandler(w http.ResponseWriter, r *http.Request) {
+	event, ok := pt.event(mux.Vars(r)["id"])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
+
+// streamEvents writes the matching events as a JSON array one at a time,
+// byte for byte what encoding the whole slice would produce. Once the
+// first byte is out errors can't change the status, so a failed scan just
+// ends the response early.
+func (pt *PixelTracker) streamEvents(w http.ResponseWriter, scanner EventScanner, filter QueryFilter) {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('[')
+	first := true
+	err := scanner.Scan(filter, func(event TrackingData) error {
+		line, err := json.Marshal(pt.outputEvent(event))
+		if err != nil {
+			return err
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		_, err = bw.Write(line)
+		return err
+	})
+	if err != nil {
+		log.Printf("Streaming stats failed: %v", err)
+		bw.Flush()
+		return
+	}
+	bw.WriteString("]\n")
+	bw.Flush()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSharedStorageTenants(t *testing.T) {
+	shared := &DataStore{}
+
+	newTenant := func(name string) *PixelTracker {
+		tracker := NewPixelTracker()
+		tracker.SetStorage(shared)
+		config := *tracker.config()
+		config.Tenant = name
+		tracker.Configure(config)
+		return tracker
+	}
+	acme := newTenant("acme")
+	globex := newTenant("globex")
+
+	acme.storeAndDispatch(&TrackingData{Path: "/acme/1", Timestamp: time.Now()})
+	globex.storeAndDispatch(&TrackingData{Path: "/globex/1", Timestamp: time.Now()})
+	acme.storeAndDispatch(&TrackingData{Path: "/acme/2", Timestamp: time.Now()})
+
+	if all, _ := shared.Query(QueryFilter{}); len(all) != 3 {
+		t.Fatalf("Expected 3 events in the shared store, got %d", len(all))
+	}
+
+	for tracker, expected := range map[*PixelTracker][]string{
+		acme:   {"/acme/1", "/acme/2"},
+		globex: {"/globex/1"},
+	} {
+		var paths []string
+		for _, event := range tracker.GetTrackingData() {
+			if event.Tenant != tracker.config().Tenant {
+				t.Errorf("Tenant %s got event stamped %q", tracker.config().Tenant, event.Tenant)
+			}
+			paths = append(paths, event.Path)
+		}
+		if !slicesEqual(paths, expected) {
+			t.Errorf("Tenant %s: expected %v, got %v", tracker.config().Tenant, expected, paths)
+		}
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	tracker.Configure(config)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		tracker.storeAndDispatch(&TrackingData{Path: path, Timestamp: time.Now()})
+	}
+	stored := tracker.GetTrackingData()
+	if stored[0].ID == "" || stored[0].ID == stored[1].ID {
+		t.Fatalf("Expected unique event IDs, got %q and %q", stored[0].ID, stored[1].ID)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/stats/{id}", tracker.requireAdmin(tracker.EventHandler))
+
+	fetch := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/stats/"+id, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := fetch(stored[1].ID)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var event TrackingData
+	if err := json.Unmarshal(rr.Body.Bytes(), &event); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if event.ID != stored[1].ID || event.Path != "/b" {
+		t.Errorf("Expected event %s at /b, got %s at %s", stored[1].ID, event.ID, event.Path)
+	}
+
+	if rr := fetch("doesnotexist"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown ID, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/stats/"+stored[1].ID, nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without admin token, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestStatsStreaming(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	fileStore, err := OpenFileStore(t.TempDir(), PartitionDaily, nil)
+	if err != nil {
+		t.Fatalf("OpenFileStore() returned error: %v", err)
+	}
+	backends := []struct {
+		name    string
+		storage Storage
+	}{
+		{"Memory", &DataStore{}},
+		{"File", fileStore},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			for i := 0; i < 5000; i++ {
+				ts := start.Add(time.Duration(i) * time.Minute)
+				backend.storage.Append(TrackingData{
+					ID:         fmt.Sprintf("event-%d", i),
+					Tenant:     []string{"shop", "blog"}[i%2],
+					Path:       fmt.Sprintf("/page/%d?<b>", i%7),
+					Query:      map[string]string{"event": "view", "n": fmt.Sprint(i)},
+					Timestamp:  ts,
+					ReceivedAt: ts,
+				})
+			}
+
+			tracker := NewPixelTracker()
+			tracker.SetStorage(backend.storage)
+			config := *tracker.config()
+			config.Tenant = "shop"
+			config.FieldMapping = map[string]string{"path": "page_url"}
+			tracker.Configure(config)
+
+			since := start.Add(24 * time.Hour)
+			req := httptest.NewRequest("GET", "/stats?since="+since.Format(time.RFC3339), nil)
+			rr := httptest.NewRecorder()
+			tracker.StatsHandler(rr, req)
+
+			var buffered bytes.Buffer
+			json.NewEncoder(&buffered).Encode(tracker.outputEvents(tracker.query(QueryFilter{Since: since})))
+			if !bytes.Equal(rr.Body.Bytes(), buffered.Bytes()) {
+				t.Fatalf("Streamed output differs from buffered output (%d vs %d bytes)", rr.Body.Len(), buffered.Len())
+			}
+
+			var events []map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("Expected valid JSON, got %v", err)
+			}
+			// 5000 minutes less the first day, half of them for this tenant.
+			if len(events) != (5000-24*60)/2 {
+				t.Errorf("Expected %d events, got %d", (5000-24*60)/2, len(events))
+			}
+		})
+	}
+}
+
+func TestStatsStreamingEmpty(t *testing.T) {
+	tracker := NewPixelTracker()
+	rr := httptest.NewRecorder()
+	tracker.StatsHandler(rr, httptest.NewRequest("GET", "/stats", nil))
+	if rr.Body.String() != "[]\n" {
+		t.Errorf("Expected an empty array, got %q", rr.Body.String())
+	}
+}
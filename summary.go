@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// messageIDParam identifies the email message a pixel was embedded in.
+const messageIDParam = "message_id"
+
+// exactUniqueThreshold is the event count up to which unique visitors are
+// also counted exactly alongside the HyperLogLog estimate, and unique opens
+// are counted exactly instead of estimated.
+const exactUniqueThreshold = 10000
+
+type Summary struct {
+	TotalOpens         int `json:"total_opens"`
+	UniqueOpens        int `json:"unique_opens"`
+	HighVelocityEvents int `json:"high_velocity_events"`
+	BotHits            int `json:"bot_hits"`
+	NewVisitors        int `json:"new_visitors"`
+	ReturningVisitors  int `json:"returning_visitors"`
+
+	// UniqueVisitors is exact and only set for small stores; the estimates
+	// are always present.
+	UniqueVisitors         *int    `json:"unique_visitors,omitempty"`
+	UniqueVisitorsEstimate uint64  `json:"unique_visitors_estimate"`
+	UniqueIPsEstimate      uint64  `json:"unique_ips_estimate"`
+	SampleRate             float64 `json:"sample_rate"`
+	EstimatedTotal         float64 `json:"estimated_total"`
+
+	// Breakdowns for the dashboard. Hours are keyed by their UTC start in
+	// RFC 3339.
+	HitsPerHour map[string]int `json:"hits_per_hour"`
+	Paths       map[string]int `json:"paths"`
+	Browsers    map[string]int `json:"browsers"`
+	Countries   map[string]int `json:"countries"`
+}
+
+func Summarize(data []TrackingData) Summary {
+	b := newSummaryBuilder()
+	for _, event := range data {
+		b.add(event)
+	}
+	return b.result()
+}
+
+// summaryBuilder accumulates a Summary one event at a time, so it can be
+// kept up to date on write as well as computed over a stored slice.
+type summaryBuilder struct {
+	summary       Summary
+	opens         *hyperLogLog
+	seen          map[string]bool
+	keylessOpens  int
+	visitors      *hyperLogLog
+	ips           *hyperLogLog
+	exactVisitors map[string]bool
+}
+
+func newSummaryBuilder() *summaryBuilder {
+	return &summaryBuilder{
+		summary: Summary{
+			SampleRate:  1,
+			HitsPerHour: make(map[string]int),
+			Paths:       make(map[string]int),
+			Browsers:    make(map[string]int),
+			Countries:   make(map[string]int),
+		},
+		opens:         newHyperLogLog(),
+		seen:          make(map[string]bool),
+		visitors:      newHyperLogLog(),
+		ips:           newHyperLogLog(),
+		exactVisitors: make(map[string]bool),
+	}
+}
+
+func (b *summaryBuilder) add(event TrackingData) {
+	summary := &b.summary
+	summary.TotalOpens++
+	if summary.TotalOpens > exactUniqueThreshold {
+		// Past the threshold the sets would grow with every visitor, so
+		// only the estimates are kept.
+		b.exactVisitors = nil
+		b.seen = nil
+	}
+	if event.Token != "" {
+		b.visitors.add(event.Token)
+		if b.exactVisitors != nil {
+			b.exactVisitors[event.Token] = true
+		}
+	}
+	if ip := eventIP(event); ip != "" {
+		b.ips.add(ip)
+	}
+	if event.IsBot {
+		summary.BotHits++
+	}
+	if event.HighVelocity {
+		summary.HighVelocityEvents++
+	}
+	if event.NewVisitor {
+		summary.NewVisitors++
+	} else {
+		summary.ReturningVisitors++
+	}
+	summary.EstimatedTotal += sampleWeight(event)
+	summary.countBreakdowns(event)
+
+	key := openKey(event)
+	if key == "" {
+		// Nothing to deduplicate on, so every such hit is its own open.
+		b.keylessOpens++
+		return
+	}
+	b.opens.add(key)
+	if b.seen != nil {
+		b.seen[key] = true
+	}
+}
+
+// result returns the summary so far. Breakdown maps are copied so the
+// caller can't modify the builder's state.
+func (b *summaryBuilder) result() Summary {
+	summary := b.summary
+	summary.HitsPerHour = maps.Clone(b.summary.HitsPerHour)
+	summary.Paths = maps.Clone(b.summary.Paths)
+	summary.Browsers = maps.Clone(b.summary.Browsers)
+	summary.Countries = maps.Clone(b.summary.Countries)
+	summary.UniqueVisitorsEstimate = b.visitors.estimate()
+	summary.UniqueIPsEstimate = b.ips.estimate()
+	if b.seen != nil {
+		summary.UniqueOpens = b.keylessOpens + len(b.seen)
+	} else {
+		summary.UniqueOpens = b.keylessOpens + int(b.opens.estimate())
+	}
+	if b.exactVisitors != nil {
+		unique := len(b.exactVisitors)
+		summary.UniqueVisitors = &unique
+	}
+	return summary
+}
+
+func eventIP(event TrackingData) string {
+	if event.IP != "" {
+		return event.IP
+	}
+	return event.Geo.IP
+}
+
+func (s *Summary) countBreakdowns(event TrackingData) {
+	if !event.Timestamp.IsZero() {
+		s.HitsPerHour[event.Timestamp.UTC().Truncate(time.Hour).Format(time.RFC3339)]++
+	}
+	if event.Path != "" {
+		s.Paths[event.Path]++
+	}
+	if event.UserAgent.Browser != "" {
+		s.Browsers[event.UserAgent.Browser]++
+	}
+	if event.Geo.Country != "" {
+		s.Countries[event.Geo.Country]++
+	}
+}
+
+// openKey prefers the message ID and falls back to the visitor token.
+func openKey(event TrackingData) string {
+	if id := event.Query[messageIDParam]; id != "" {
+		return "message:" + id
+	}
+	if event.Token != "" {
+		return "token:" + event.Token
+	}
+	return ""
+}
+
+func (pt *PixelTracker) SummaryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	includeBots, _ := strconv.ParseBool(r.URL.Query().Get("includeBots"))
+
+	var all, humans Summary
+	if aggregates := pt.summaryAggregates(); aggregates != nil {
+		all, humans = aggregates.summaries(pt.GetTrackingData)
+	} else {
+		data := pt.GetTrackingData()
+		all = Summarize(data)
+		if !includeBots {
+			humans = Summarize(withoutBots(data))
+		}
+	}
+
+	summary := all
+	if !includeBots {
+		// Rollups cover humans only, but BotHits still reports what was dropped.
+		summary = humans
+		summary.BotHits = all.BotHits
+	}
+	summary.SampleRate = pt.effectiveSampleRate()
+	json.NewEncoder(w).Encode(summary)
+}
+
+func withoutBots(data []TrackingData) []TrackingData {
+	humans := make([]TrackingData, 0, len(data))
+	for _, event := range data {
+		if !event.IsBot {
+			humans = append(humans, event)
+		}
+	}
+	return humans
+}
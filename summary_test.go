@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSummarizeOpens(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           []TrackingData
+		expectedTotal  int
+		expectedUnique int
+	}{
+		{
+			name:           "Empty",
+			data:           []TrackingData{},
+			expectedTotal:  0,
+			expectedUnique: 0,
+		},
+		{
+			name: "Repeated message opens",
+			data: []TrackingData{
+				{Query: map[string]string{"message_id": "m1"}, Token: "a"},
+				{Query: map[string]string{"message_id": "m1"}, Token: "a"},
+				{Query: map[string]string{"message_id": "m1"}, Token: "b"},
+				{Query: map[string]string{"message_id": "m2"}, Token: "a"},
+			},
+			expectedTotal:  4,
+			expectedUnique: 2,
+		},
+		{
+			name: "Missing message ID falls back to token",
+			data: []TrackingData{
+				{Query: map[string]string{}, Token: "a"},
+				{Query: map[string]string{}, Token: "a"},
+				{Query: map[string]string{}, Token: "b"},
+			},
+			expectedTotal:  3,
+			expectedUnique: 2,
+		},
+		{
+			name: "No identifier at all",
+			data: []TrackingData{
+				{Query: map[string]string{}},
+				{Query: map[string]string{}},
+			},
+			expectedTotal:  2,
+			expectedUnique: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := Summarize(tt.data)
+			if summary.TotalOpens != tt.expectedTotal {
+				t.Errorf("Expected %d total opens, got %d", tt.expectedTotal, summary.TotalOpens)
+			}
+			if summary.UniqueOpens != tt.expectedUnique {
+				t.Errorf("Expected %d unique opens, got %d", tt.expectedUnique, summary.UniqueOpens)
+			}
+		})
+	}
+}
+
+func TestSummaryHandler(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/pixel.gif?message_id=welcome", nil)
+		req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: "visitor"})
+		tracker.PixelHandler(httptest.NewRecorder(), req)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	tracker.SummaryHandler(rr, httptest.NewRequest("GET", "/stats/summary", nil))
+
+	var summary Summary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if summary.TotalOpens != 3 {
+		t.Errorf("Expected 3 total opens, got %d", summary.TotalOpens)
+	}
+	if summary.UniqueOpens != 1 {
+		t.Errorf("Expected 1 unique open, got %d", summary.UniqueOpens)
+	}
+}
+
+func TestSummaryHandlerBots(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	hits := []struct {
+		token     string
+		userAgent string
+	}{
+		{"alice", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/118.0"},
+		{"bob", "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1"},
+		{"crawler", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"},
+		{"crawler", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"},
+		{"script", "curl/8.4.0"},
+	}
+	for _, hit := range hits {
+		req := httptest.NewRequest("GET", "/pixel.gif", nil)
+		req.Header.Set("User-Agent", hit.userAgent)
+		req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: hit.token})
+		tracker.PixelHandler(httptest.NewRecorder(), req)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	tests := []struct {
+		name           string
+		target         string
+		expectedTotal  int
+		expectedUnique int
+	}{
+		{"Bots excluded by default", "/stats/summary", 2, 2},
+		{"Bots excluded explicitly", "/stats/summary?includeBots=false", 2, 2},
+		{"Bots included", "/stats/summary?includeBots=true", 5, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tracker.SummaryHandler(rr, httptest.NewRequest("GET", tt.target, nil))
+
+			var summary Summary
+			if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if summary.TotalOpens != tt.expectedTotal {
+				t.Errorf("Expected %d total opens, got %d", tt.expectedTotal, summary.TotalOpens)
+			}
+			if summary.UniqueOpens != tt.expectedUnique {
+				t.Errorf("Expected %d unique opens, got %d", tt.expectedUnique, summary.UniqueOpens)
+			}
+			if summary.BotHits != 3 {
+				t.Errorf("Expected 3 bot hits, got %d", summary.BotHits)
+			}
+		})
+	}
+}
+
+func TestNewVisitor(t *testing.T) {
+	tracker := NewPixelTracker()
+
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, httptest.NewRequest("GET", "/pixel.gif", nil))
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("Expected a tracking cookie for the new visitor")
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/pixel.gif", nil)
+		req.AddCookie(cookies[0])
+		tracker.PixelHandler(httptest.NewRecorder(), req)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	data := tracker.GetTrackingData()
+	if len(data) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(data))
+	}
+	newVisitors := 0
+	for _, event := range data {
+		if event.NewVisitor {
+			newVisitors++
+			if event.Token != cookies[0].Value {
+				t.Errorf("Expected new visitor event to carry the issued token")
+			}
+		}
+	}
+	if newVisitors != 1 {
+		t.Errorf("Expected 1 new visitor event, got %d", newVisitors)
+	}
+
+	summary := Summarize(data)
+	if summary.NewVisitors != 1 {
+		t.Errorf("Expected 1 new visitor in summary, got %d", summary.NewVisitors)
+	}
+	if summary.ReturningVisitors != 2 {
+		t.Errorf("Expected 2 returning visitors in summary, got %d", summary.ReturningVisitors)
+	}
+}
+
+func TestSummarizeUniqueVisitors(t *testing.T) {
+	small := []TrackingData{
+		{Token: "a", IP: "203.0.113.1"},
+		{Token: "a", IP: "203.0.113.1"},
+		{Token: "b", IP: "203.0.113.2"},
+		{Token: "c", IP: "203.0.113.2"},
+	}
+	summary := Summarize(small)
+	if summary.UniqueVisitors == nil || *summary.UniqueVisitors != 3 {
+		t.Errorf("Expected exact 3 unique visitors, got %v", summary.UniqueVisitors)
+	}
+	if summary.UniqueVisitorsEstimate != 3 {
+		t.Errorf("Expected estimate of 3 unique visitors, got %d", summary.UniqueVisitorsEstimate)
+	}
+	if summary.UniqueIPsEstimate != 2 {
+		t.Errorf("Expected estimate of 2 unique IPs, got %d", summary.UniqueIPsEstimate)
+	}
+
+	large := make([]TrackingData, 50000)
+	for i := range large {
+		large[i] = TrackingData{Token: fmt.Sprintf("visitor-%d", i%25000)}
+	}
+	summary = Summarize(large)
+	if summary.UniqueVisitors != nil {
+		t.Errorf("Expected no exact count above the threshold, got %d", *summary.UniqueVisitors)
+	}
+	if estimate := summary.UniqueVisitorsEstimate; estimate < 24000 || estimate > 26000 {
+		t.Errorf("Expected estimate near 25000 unique visitors, got %d", estimate)
+	}
+}
+
+func TestSummaryBuilderBoundsUniqueOpens(t *testing.T) {
+	b := newSummaryBuilder()
+	for i := 0; i < 3*exactUniqueThreshold; i++ {
+		b.add(TrackingData{Query: map[string]string{messageIDParam: fmt.Sprintf("message-%d", i%(2*exactUniqueThreshold))}})
+		if i == exactUniqueThreshold-1 {
+			if got := b.result().UniqueOpens; got != exactUniqueThreshold {
+				t.Errorf("Expected an exact count of %d unique opens, got %d", exactUniqueThreshold, got)
+			}
+		}
+	}
+	b.add(TrackingData{})
+
+	if b.seen != nil {
+		t.Errorf("Expected the exact open keys to be dropped past the threshold, still holding %d", len(b.seen))
+	}
+	// 2*exactUniqueThreshold messages plus the keyless open.
+	if got := b.result().UniqueOpens; got < 19000 || got > 21000 {
+		t.Errorf("Expected an estimate near 20001 unique opens, got %d", got)
+	}
+}
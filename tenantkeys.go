@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// requestTenant resolves the tenant for a /batch request from its API key,
+// sent as X-API-Key or the api_key query param. With no TenantKeys
+// configured every request is accepted under the tracker's own Tenant.
+func (pt *PixelTracker) requestTenant(r *http.Request) (string, bool) {
+	if len(pt.config().TenantKeys) == 0 {
+		return pt.config().Tenant, true
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return "", false
+	}
+	// Compare against every key so the time taken doesn't reveal which
+	// prefix matched.
+	var tenant string
+	found := false
+	for candidate, t := range pt.config().TenantKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(candidate)) == 1 {
+			tenant, found = t, true
+		}
+	}
+	return tenant, found
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// clientTimestampParam carries the client's own event time, either as Unix
+// seconds, Unix milliseconds or RFC 3339.
+const clientTimestampParam = "ts"
+
+// maxClockSkew caps ClockSkew. Client times further than this from the server
+// clock are treated as bogus whatever the configured window, which also
+// bounds how far Timestamp can stray from ReceivedAt.
+const maxClockSkew = 24 * time.Hour
+
+// enrichTimestamp records the client-supplied time and, when ClockSkew is
+// set, uses it as the event time if it lies within the skew window of the
+// server clock. Anything outside the window keeps the server time.
+// ReceivedAt always stays the server time.
+func (pt *PixelTracker) enrichTimestamp(data *TrackingData, r *http.Request) {
+	clientTime, ok := parseClientTimestamp(r.URL.Query().Get(clientTimestampParam))
+	if !ok {
+		return
+	}
+	data.ClientTimestamp = &clientTime
+
+	skew := min(pt.config().ClockSkew, maxClockSkew)
+	if skew <= 0 {
+		return
+	}
+	drift := clientTime.Sub(data.Timestamp)
+	if drift >= -skew && drift <= skew {
+		data.Timestamp = clientTime
+	}
+}
+
+func parseClientTimestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n <= 0 {
+			return time.Time{}, false
+		}
+		// Anything past 1e12 is too far in the future to be seconds.
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), true
+		}
+		return time.Unix(n, 0).UTC(), true
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEnrichTimestamp(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ClockSkew = 5 * time.Minute
+	tracker.Configure(config)
+
+	serverTime := time.Now()
+
+	tests := []struct {
+		name              string
+		ts                string
+		expectedTimestamp time.Time
+		expectClient      bool
+	}{
+		{
+			name:              "In-window client timestamp",
+			ts:                strconv.FormatInt(serverTime.Add(-2*time.Minute).UnixMilli(), 10),
+			expectedTimestamp: time.UnixMilli(serverTime.Add(-2 * time.Minute).UnixMilli()),
+			expectClient:      true,
+		},
+		{
+			name:              "Out-of-window client timestamp",
+			ts:                strconv.FormatInt(serverTime.Add(48*time.Hour).Unix(), 10),
+			expectedTimestamp: serverTime,
+			expectClient:      true,
+		},
+		{
+			name:              "RFC 3339 client timestamp",
+			ts:                serverTime.Add(time.Minute).UTC().Format(time.RFC3339),
+			expectedTimestamp: serverTime.Add(time.Minute).Truncate(time.Second),
+			expectClient:      true,
+		},
+		{
+			name:              "Missing client timestamp",
+			ts:                "",
+			expectedTimestamp: serverTime,
+			expectClient:      false,
+		},
+		{
+			name:              "Invalid client timestamp",
+			ts:                "yesterday",
+			expectedTimestamp: serverTime,
+			expectClient:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/pixel.gif?ts="+tt.ts, nil)
+			data := &TrackingData{Timestamp: serverTime}
+			tracker.enrichTimestamp(data, req)
+
+			if !data.Timestamp.Equal(tt.expectedTimestamp) {
+				t.Errorf("Expected timestamp %v, got %v", tt.expectedTimestamp, data.Timestamp)
+			}
+			if (data.ClientTimestamp != nil) != tt.expectClient {
+				t.Errorf("Expected client timestamp recorded: %v, got %v", tt.expectClient, data.ClientTimestamp)
+			}
+		})
+	}
+}
+
+func TestEnrichTimestampWithoutSkewWindow(t *testing.T) {
+	tracker := NewPixelTracker()
+	serverTime := time.Now()
+	clientTime := serverTime.Add(-time.Minute)
+
+	req := httptest.NewRequest("GET", "/pixel.gif?ts="+strconv.FormatInt(clientTime.Unix(), 10), nil)
+	data := &TrackingData{Timestamp: serverTime}
+	tracker.enrichTimestamp(data, req)
+
+	if !data.Timestamp.Equal(serverTime) {
+		t.Errorf("Expected server time to be kept without ClockSkew, got %v", data.Timestamp)
+	}
+	if data.ClientTimestamp == nil || data.ClientTimestamp.Unix() != clientTime.Unix() {
+		t.Errorf("Expected raw client timestamp to be recorded, got %v", data.ClientTimestamp)
+	}
+}
+
+func TestClientTimestampClamped(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.ClockSkew = 365 * 24 * time.Hour
+	tracker.Configure(config)
+
+	future := time.Now().Add(30 * 24 * time.Hour).Unix()
+	req := httptest.NewRequest("GET", "/pixel.gif?ts="+strconv.FormatInt(future, 10), nil)
+	data := tracker.buildTrackingData(req, "")
+
+	if data.ClientTimestamp == nil || data.ClientTimestamp.Unix() != future {
+		t.Errorf("Expected the raw client timestamp to be kept, got %v", data.ClientTimestamp)
+	}
+	if data.Timestamp.After(time.Now()) {
+		t.Errorf("Expected a month-ahead client time to be rejected despite the skew window, got %v", data.Timestamp)
+	}
+	if !data.ReceivedAt.Equal(data.Timestamp) {
+		t.Errorf("Expected received_at %v to match the server timestamp %v", data.ReceivedAt, data.Timestamp)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	// Embedded so zone lookups work in minimal containers without
+	// /usr/share/zoneinfo.
+	_ "time/tzdata"
+)
+
+// timezoneParam carries the browser's Date.getTimezoneOffset(): minutes
+// behind UTC, so UTC+8 is -480.
+const timezoneParam = "tz"
+
+// Offsets in use run from UTC+14 to UTC-12.
+const (
+	minTimezoneOffset = -14 * 60
+	maxTimezoneOffset = 12 * 60
+)
+
+// parseTimezoneOffset accepts whole minutes within the range real zones
+// use.
+func parseTimezoneOffset(value string) (int, bool) {
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < minTimezoneOffset || offset > maxTimezoneOffset {
+		return 0, false
+	}
+	return offset, true
+}
+
+// geoTimezoneOffset is the getTimezoneOffset() value a browser in the named
+// IANA zone would report at t.
+func geoTimezoneOffset(zone string, t time.Time) (int, bool) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return 0, false
+	}
+	_, seconds := t.In(loc).Zone()
+	return -seconds / 60, true
+}
+
+// enrichTimezone records the tz param when CaptureTimezone is on, and flags
+// a mismatch with the GeoIP time zone. Automation often runs in UTC
+// wherever the IP is, so a mismatch is a bot signal, though VPN users and
+// travellers trip it too.
+func (pt *PixelTracker) enrichTimezone(data *TrackingData, r *http.Request) {
+	if !pt.config().CaptureTimezone {
+		return
+	}
+	offset, ok := parseTimezoneOffset(r.URL.Query().Get(timezoneParam))
+	if !ok {
+		return
+	}
+	data.TimezoneOffset = &offset
+	if data.Geo.TimeZone == "" {
+		return
+	}
+	if expected, ok := geoTimezoneOffset(data.Geo.TimeZone, time.Now()); ok {
+		data.TimezoneMismatch = expected != offset
+	}
+}
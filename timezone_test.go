@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnrichTimezone(t *testing.T) {
+	// Tokyo has no daylight saving, so its offset is always -540.
+	tests := []struct {
+		name             string
+		tz               string
+		geoZone          string
+		expectedOffset   *int
+		expectedMismatch bool
+	}{
+		{"Valid offset", "-540", "", intPtr(-540), false},
+		{"UTC", "0", "", intPtr(0), false},
+		{"Missing", "", "", nil, false},
+		{"Not a number", "abc", "Asia/Tokyo", nil, false},
+		{"Out of range", "-900", "Asia/Tokyo", nil, false},
+		{"Matches geo", "-540", "Asia/Tokyo", intPtr(-540), false},
+		{"Mismatches geo", "0", "Asia/Tokyo", intPtr(0), true},
+		{"Unknown geo zone", "0", "Mars/Olympus", intPtr(0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.CaptureTimezone = true
+			tracker.Configure(config)
+
+			req := httptest.NewRequest("GET", "/pixel.gif?tz="+tt.tz, nil)
+			data := &TrackingData{Geo: GeoInfo{TimeZone: tt.geoZone}}
+			tracker.enrichTimezone(data, req)
+
+			switch {
+			case tt.expectedOffset == nil && data.TimezoneOffset != nil:
+				t.Errorf("Expected no offset, got %d", *data.TimezoneOffset)
+			case tt.expectedOffset != nil && (data.TimezoneOffset == nil || *data.TimezoneOffset != *tt.expectedOffset):
+				t.Errorf("Expected offset %d, got %v", *tt.expectedOffset, data.TimezoneOffset)
+			}
+			if data.TimezoneMismatch != tt.expectedMismatch {
+				t.Errorf("Expected mismatch=%v, got %v", tt.expectedMismatch, data.TimezoneMismatch)
+			}
+		})
+	}
+}
+
+func TestGeoTimezoneOffset(t *testing.T) {
+	summer := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if offset, _ := geoTimezoneOffset("America/New_York", summer); offset != 240 {
+		t.Errorf("Expected 240 in New York summer, got %d", offset)
+	}
+	if offset, _ := geoTimezoneOffset("America/New_York", winter); offset != 300 {
+		t.Errorf("Expected 300 in New York winter, got %d", offset)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// tokenSet builds the blocked-token set from BlockedTokens.
+func tokenSet(tokens []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(tokens))
+	for _, token := range tokens {
+		if token != "" {
+			set[token] = struct{}{}
+		}
+	}
+	return set
+}
+
+// blockedToken reports whether the visitor token is on the blocklist.
+// Requests from blocked visitors still get the pixel.
+func (pt *PixelTracker) blockedToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	_, blocked := pt.blockedTokens[token]
+	return blocked
+}
+
+// BlockToken stops recording events from the visitor token until
+// UnblockToken or the next Configure.
+func (pt *PixelTracker) BlockToken(token string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.blockedTokens == nil {
+		pt.blockedTokens = make(map[string]struct{})
+	}
+	pt.blockedTokens[token] = struct{}{}
+}
+
+func (pt *PixelTracker) UnblockToken(token string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	delete(pt.blockedTokens, token)
+}
+
+// BlockedTokens returns the blocked visitor tokens, sorted.
+func (pt *PixelTracker) BlockedTokens() []string {
+	pt.mu.RLock()
+	tokens := make([]string, 0, len(pt.blockedTokens))
+	for token := range pt.blockedTokens {
+		tokens = append(tokens, token)
+	}
+	pt.mu.RUnlock()
+	slices.Sort(tokens)
+	return tokens
+}
+
+// BlockedTokensHandler lists the blocked tokens on GET and, for
+// /admin/blocked-tokens/{token}, adds the token on PUT and removes it on
+// DELETE.
+func (pt *PixelTracker) BlockedTokensHandler(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	switch r.Method {
+	case http.MethodPut:
+		pt.BlockToken(token)
+	case http.MethodDelete:
+		pt.UnblockToken(token)
+	}
+	if token != "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pt.BlockedTokens())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func pixelWithToken(tracker *PixelTracker, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: token})
+	req.Header.Set(featuresHeader, featureSync)
+	rr := httptest.NewRecorder()
+	tracker.PixelHandler(rr, req)
+	return rr
+}
+
+func TestBlockedTokens(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.BlockedTokens = []string{"abuser"}
+	config.FeatureAllowlist = []string{featureSync}
+	tracker.Configure(config)
+
+	handled := 0
+	tracker.Use(func(data *TrackingData) { handled++ })
+
+	rr := pixelWithToken(tracker, "abuser")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+		t.Errorf("Expected blocked visitor to get the pixel, got %d", rr.Code)
+	}
+	pixelWithToken(tracker, "alice")
+
+	data := tracker.GetTrackingData()
+	if len(data) != 1 || data[0].Token != "alice" {
+		t.Errorf("Expected only alice's event to be stored, got %+v", data)
+	}
+	if handled != 1 {
+		t.Errorf("Expected handlers to run once, got %d", handled)
+	}
+
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`[{"event":"a"}]`))
+	req.AddCookie(&http.Cookie{Name: tracker.config().CookieName, Value: "abuser"})
+	rr = httptest.NewRecorder()
+	tracker.BatchHandler(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected blocked batch to be accepted, got %d", rr.Code)
+	}
+	if n := len(tracker.GetTrackingData()); n != 1 {
+		t.Errorf("Expected blocked batch not to be stored, got %d events", n)
+	}
+}
+
+func TestBlockedTokensEndpoint(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.AdminToken = "secret"
+	config.FeatureAllowlist = []string{featureSync}
+	tracker.Configure(config)
+	router := tracker.Router()
+
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("PUT", "/admin/blocked-tokens/bob", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without admin token, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := admin("PUT", "/admin/blocked-tokens/bob"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d blocking a token, got %d", http.StatusNoContent, rr.Code)
+	}
+	rr = admin("GET", "/admin/blocked-tokens")
+	var tokens []string
+	if err := json.Unmarshal(rr.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0] != "bob" {
+		t.Errorf("Expected [bob], got %v", tokens)
+	}
+
+	pixelWithToken(tracker, "bob")
+	if n := len(tracker.GetTrackingData()); n != 0 {
+		t.Errorf("Expected blocked token not to be recorded, got %d events", n)
+	}
+
+	if rr := admin("DELETE", "/admin/blocked-tokens/bob"); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d unblocking a token, got %d", http.StatusNoContent, rr.Code)
+	}
+	pixelWithToken(tracker, "bob")
+	if n := len(tracker.GetTrackingData()); n != 1 {
+		t.Errorf("Expected unblocked token to be recorded, got %d events", n)
+	}
+}
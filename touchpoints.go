@@ -0,0 +1,63 @@
+package main
+
+import "sync"
+
+// defaultMaxTouchpointKeys bounds how many visitors' first and last
+// referrers are remembered when MaxTouchpointKeys is unset.
+const defaultMaxTouchpointKeys = 100000
+
+type touchpoint struct {
+	first string
+	last  string
+}
+
+// touchpointCache remembers each visitor's first and latest referrer. Once
+// maxKeys is reached the least recently seen visitor is evicted, and their
+// next hit starts a new first touch.
+type touchpointCache struct {
+	mu      sync.Mutex
+	touches *lruCache[touchpoint]
+}
+
+func newTouchpointCache(maxKeys int) *touchpointCache {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxTouchpointKeys
+	}
+	return &touchpointCache{touches: newLRUCache[touchpoint](maxKeys)}
+}
+
+// record makes referer the visitor's last touch, and their first touch if
+// they have none yet, and returns both.
+func (c *touchpointCache) record(token, referer string) touchpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	touch, ok := c.touches.get(token)
+	if !ok {
+		touch.first = referer
+	}
+	touch.last = referer
+	c.touches.set(token, touch)
+	return touch
+}
+
+func (c *touchpointCache) cardinality() (keys int, evictions int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.touches.len(), c.touches.evictions
+}
+
+// stampTouchpoints sets FirstReferer and LastReferer from the visitor's
+// earlier hits when TrackTouchpoints is on. Events without a token can't be
+// tied to a visitor and are left alone.
+func (pt *PixelTracker) stampTouchpoints(data *TrackingData) {
+	pt.mu.RLock()
+	touches := pt.touchpoints
+	pt.mu.RUnlock()
+	if touches == nil || data.Token == "" {
+		return
+	}
+	touch := touches.record(data.Token, data.Referer)
+	data.FirstReferer = touch.first
+	data.LastReferer = touch.last
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestTouchpoints(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.TrackTouchpoints = true
+	tracker.Configure(config)
+
+	hits := []struct {
+		token   string
+		referer string
+	}{
+		{"visitor-a", "https://search.example/"},
+		{"visitor-b", "direct"},
+		{"visitor-a", "https://news.example/"},
+		{"visitor-a", "https://social.example/"},
+		{"", "https://anon.example/"},
+	}
+	for _, hit := range hits {
+		tracker.storeAndDispatch(&TrackingData{Token: hit.token, Referer: hit.referer})
+	}
+
+	expected := []struct{ first, last string }{
+		{"https://search.example/", "https://search.example/"},
+		{"direct", "direct"},
+		{"https://search.example/", "https://news.example/"},
+		{"https://search.example/", "https://social.example/"},
+		{"", ""},
+	}
+	data := tracker.GetTrackingData()
+	if len(data) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(data))
+	}
+	for i, want := range expected {
+		if data[i].FirstReferer != want.first || data[i].LastReferer != want.last {
+			t.Errorf("Event %d: expected first %q and last %q, got %q and %q",
+				i, want.first, want.last, data[i].FirstReferer, data[i].LastReferer)
+		}
+	}
+}
+
+func TestTouchpointEviction(t *testing.T) {
+	cache := newTouchpointCache(1)
+	cache.record("visitor-a", "https://first.example/")
+	cache.record("visitor-b", "https://other.example/")
+
+	// visitor-a was evicted, so their next hit starts over.
+	if touch := cache.record("visitor-a", "https://again.example/"); touch.first != "https://again.example/" {
+		t.Errorf("Expected a new first touch after eviction, got %q", touch.first)
+	}
+	if keys, evictions := cache.cardinality(); keys != 1 || evictions != 2 {
+		t.Errorf("Expected 1 key and 2 evictions, got %d and %d", keys, evictions)
+	}
+}
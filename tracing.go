@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "pixel-tracker"
+
+var traceContextPropagator = propagation.TraceContext{}
+
+// SetTracerProvider overrides the global OpenTelemetry provider used when
+// EnableTracing is set.
+func (pt *PixelTracker) SetTracerProvider(provider trace.TracerProvider) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.tracerProvider = provider
+}
+
+func (pt *PixelTracker) tracer() trace.Tracer {
+	pt.mu.RLock()
+	provider := pt.tracerProvider
+	pt.mu.RUnlock()
+
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startSpan starts a span when tracing is enabled and otherwise returns a
+// no-op span, so callers can always defer span.End().
+func (pt *PixelTracker) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !pt.config().EnableTracing {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return pt.tracer().Start(ctx, name, opts...)
+}
+
+// extractTraceContext continues a trace from an incoming traceparent header.
+func (pt *PixelTracker) extractTraceContext(r *http.Request) context.Context {
+	if !pt.config().EnableTracing {
+		return r.Context()
+	}
+	return traceContextPropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpanHierarchy(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.EnableTracing = true
+	tracker.Configure(config)
+	tracker.SetTracerProvider(provider)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/pixel.gif", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	tracker.PixelHandler(httptest.NewRecorder(), req)
+
+	time.Sleep(100 * time.Millisecond)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	handler, ok := spans["PixelHandler"]
+	if !ok {
+		t.Fatalf("Expected a PixelHandler span, got %v", spanNames(recorder.Ended()))
+	}
+	if got := handler.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected trace ID %s from traceparent, got %s", traceID, got)
+	}
+	if got := handler.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("Expected PixelHandler to continue the remote span, got parent %s", got)
+	}
+
+	process, ok := spans["processRequest"]
+	if !ok {
+		t.Fatal("Expected a processRequest span")
+	}
+	if process.Parent().SpanID() != handler.SpanContext().SpanID() {
+		t.Error("Expected processRequest to be a child of PixelHandler")
+	}
+
+	for _, name := range tracker.Enrichers() {
+		span, ok := spans["enrich."+name]
+		if !ok {
+			t.Errorf("Expected a span for enricher %q", name)
+			continue
+		}
+		if span.Parent().SpanID() != process.SpanContext().SpanID() {
+			t.Errorf("Expected enrich.%s to be a child of processRequest", name)
+		}
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracker := NewPixelTracker()
+	tracker.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	tracker.PixelHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/pixel.gif", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	if ended := recorder.Ended(); len(ended) != 0 {
+		t.Errorf("Expected no spans with tracing disabled, got %v", spanNames(ended))
+	}
+}
+
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name()
+	}
+	return names
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+)
+
+// compileUABlocklist compiles the UABlocklist patterns once at Configure
+// time so a typo fails loudly instead of silently matching nothing.
+func compileUABlocklist(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UABlocklist pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// blockedUserAgent reports whether the request's user agent matches the
+// blocklist, counting it if so. Blocked requests still get the pixel.
+func (pt *PixelTracker) blockedUserAgent(r *http.Request) bool {
+	pt.mu.RLock()
+	blocklist := pt.uaBlocklist
+	pt.mu.RUnlock()
+
+	userAgent := r.UserAgent()
+	for _, re := range blocklist {
+		if re.MatchString(userAgent) {
+			atomic.AddInt64(&pt.blockedUA, 1)
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedUserAgentRequests returns how many requests were served without
+// tracking because their user agent matched UABlocklist.
+func (pt *PixelTracker) BlockedUserAgentRequests() int64 {
+	return atomic.LoadInt64(&pt.blockedUA)
+}
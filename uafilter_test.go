@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUABlocklist(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.UABlocklist = []string{`^UptimeRobot/`, `(?i)internal-healthcheck`}
+	if err := tracker.Configure(config); err != nil {
+		t.Fatalf("Configure() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		userAgent     string
+		expectedStore bool
+	}{
+		{"Monitoring probe", "UptimeRobot/2.0 (http://www.uptimerobot.com/)", false},
+		{"Internal check", "Internal-HealthCheck/1.0", false},
+		{"Regular browser", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/118.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(tracker.GetTrackingData())
+			blockedBefore := tracker.BlockedUserAgentRequests()
+
+			req := httptest.NewRequest("GET", "/pixel.gif", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			rr := httptest.NewRecorder()
+			tracker.PixelHandler(rr, req)
+			time.Sleep(100 * time.Millisecond)
+
+			if !bytes.Equal(rr.Body.Bytes(), pixel1x1) {
+				t.Errorf("Expected the pixel to be served, got %q", rr.Body.Bytes())
+			}
+			stored := len(tracker.GetTrackingData()) > before
+			if stored != tt.expectedStore {
+				t.Errorf("Expected stored %v, got %v", tt.expectedStore, stored)
+			}
+			blocked := tracker.BlockedUserAgentRequests() > blockedBefore
+			if blocked == tt.expectedStore {
+				t.Errorf("Expected blocked counter to increase: %v", !tt.expectedStore)
+			}
+		})
+	}
+}
+
+func TestUABlocklistInvalidPattern(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.UABlocklist = []string{`UptimeRobot(`}
+	if err := tracker.Configure(config); err == nil {
+		t.Fatal("Expected error for invalid pattern")
+	}
+	if len(tracker.config().UABlocklist) != 0 {
+		t.Errorf("Expected the previous configuration to be kept, got %v", tracker.config().UABlocklist)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultMaxVelocityKeys bounds how many distinct IPs and tokens are
+// tracked when MaxVelocityKeys is unset.
+const defaultMaxVelocityKeys = 100000
+
+// velocityCounter keeps a sliding window of recent hit times per key. Only
+// threshold+1 timestamps are retained per key since anything beyond that is
+// already over the limit. Once maxKeys is reached the least recently seen
+// key is evicted.
+type velocityCounter struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	hits      *lruCache[[]time.Time]
+}
+
+func newVelocityCounter(threshold int, window time.Duration, maxKeys int) *velocityCounter {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxVelocityKeys
+	}
+	return &velocityCounter{
+		threshold: threshold,
+		window:    window,
+		hits:      newLRUCache[[]time.Time](maxKeys),
+	}
+}
+
+// exceeded records a hit for key and reports whether the key has now seen
+// more than threshold hits within the window.
+func (v *velocityCounter) exceeded(key string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	hits, _ := v.hits.get(key)
+	cutoff := now.Add(-v.window)
+	kept := hits[:0]
+	for _, hit := range hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+	kept = append(kept, now)
+	if len(kept) > v.threshold+1 {
+		kept = kept[len(kept)-v.threshold-1:]
+	}
+	v.hits.set(key, kept)
+
+	return len(kept) > v.threshold
+}
+
+func (v *velocityCounter) cardinality() (keys int, evictions int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.hits.len(), v.hits.evictions
+}
+
+func (pt *PixelTracker) flagVelocity(data *TrackingData) {
+	pt.mu.RLock()
+	counter := pt.velocity
+	pt.mu.RUnlock()
+	if counter == nil {
+		return
+	}
+
+	now := time.Now()
+	ip := data.IP
+	if ip == "" {
+		ip = data.Geo.IP
+	}
+
+	flagged := false
+	if ip != "" && counter.exceeded("ip:"+ip, now) {
+		flagged = true
+	}
+	if data.Token != "" && counter.exceeded("token:"+data.Token, now) {
+		flagged = true
+	}
+	data.HighVelocity = flagged
+}
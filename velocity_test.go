@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHighVelocityFlagging(t *testing.T) {
+	tracker := NewPixelTracker()
+	config := *tracker.config()
+	config.VelocityThreshold = 3
+	config.VelocityWindow = time.Minute
+	tracker.Configure(config)
+
+	for i := 0; i < 5; i++ {
+		tracker.storeAndDispatch(&TrackingData{IP: "203.0.113.1", Query: map[string]string{"n": fmt.Sprint(i)}})
+	}
+	for i := 0; i < 2; i++ {
+		tracker.storeAndDispatch(&TrackingData{IP: "198.51.100.7"})
+	}
+
+	data := tracker.GetTrackingData()
+	for i, event := range data[:5] {
+		expected := i >= 3
+		if event.HighVelocity != expected {
+			t.Errorf("Burst event %d: expected HighVelocity %v, got %v", i, expected, event.HighVelocity)
+		}
+	}
+	for i, event := range data[5:] {
+		if event.HighVelocity {
+			t.Errorf("Normal event %d should not be flagged", i)
+		}
+	}
+
+	summary := Summarize(data)
+	if summary.HighVelocityEvents != 2 {
+		t.Errorf("Expected 2 high-velocity events in summary, got %d", summary.HighVelocityEvents)
+	}
+}
+
+func TestVelocityCounterWindow(t *testing.T) {
+	counter := newVelocityCounter(2, time.Minute, 0)
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		counter.exceeded("token:a", start)
+	}
+	if !counter.exceeded("token:a", start.Add(time.Second)) {
+		t.Error("Expected key to exceed threshold inside the window")
+	}
+	if counter.exceeded("token:a", start.Add(2*time.Minute)) {
+		t.Error("Expected old hits to slide out of the window")
+	}
+	if hits, _ := counter.hits.get("token:a"); len(hits) > 3 {
+		t.Errorf("Expected at most threshold+1 timestamps per key, got %d", len(hits))
+	}
+}
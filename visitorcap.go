@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxVisitorCapKeys bounds how many visitor tokens are counted when
+// MaxVisitorCapKeys is unset.
+const defaultMaxVisitorCapKeys = 100000
+
+type visitorWindow struct {
+	start time.Time
+	count int
+}
+
+// visitorCapCounter counts stored events per visitor token in fixed windows
+// that start at the visitor's first event and reset once they elapse. Once
+// maxKeys is reached the least recently seen token is evicted, which at
+// worst gives that visitor a fresh window.
+type visitorCapCounter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows *lruCache[visitorWindow]
+}
+
+func newVisitorCapCounter(limit int, window time.Duration, maxKeys int) *visitorCapCounter {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxVisitorCapKeys
+	}
+	return &visitorCapCounter{
+		limit:   limit,
+		window:  window,
+		windows: newLRUCache[visitorWindow](maxKeys),
+	}
+}
+
+// over counts an event for token and reports whether the token has now
+// stored more than limit events in its current window.
+func (v *visitorCapCounter) over(token string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	w, ok := v.windows.get(token)
+	if !ok || now.Sub(w.start) >= v.window {
+		w = visitorWindow{start: now}
+	}
+	w.count++
+	v.windows.set(token, w)
+	return w.count > v.limit
+}
+
+func (v *visitorCapCounter) cardinality() (keys int, evictions int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.windows.len(), v.windows.evictions
+}
+
+// capVisitor reports whether the event should be dropped because its
+// visitor went over VisitorEventCap. With KeepOverCap the event is kept and
+// flagged OverCap instead. Events without a token are never capped.
+func (pt *PixelTracker) capVisitor(data *TrackingData) bool {
+	pt.mu.RLock()
+	counter := pt.visitorCap
+	pt.mu.RUnlock()
+	if counter == nil || data.Token == "" {
+		return false
+	}
+	if !counter.over(data.Token, time.Now()) {
+		return false
+	}
+	atomic.AddInt64(&pt.cappedEvents, 1)
+	if pt.config().KeepOverCap {
+		data.OverCap = true
+		return false
+	}
+	return true
+}
+
+// CappedEvents returns how many events went over VisitorEventCap, whether
+// dropped or kept flagged.
+func (pt *PixelTracker) CappedEvents() int64 {
+	return atomic.LoadInt64(&pt.cappedEvents)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVisitorEventCap(t *testing.T) {
+	tests := []struct {
+		name        string
+		keepOverCap bool
+	}{
+		{"Drop over cap", false},
+		{"Keep flagged", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewPixelTracker()
+			config := *tracker.config()
+			config.VisitorEventCap = 3
+			config.VisitorCapWindow = time.Minute
+			config.KeepOverCap = tt.keepOverCap
+			tracker.Configure(config)
+
+			for i := 0; i < 10; i++ {
+				tracker.storeAndDispatch(&TrackingData{Token: "looping", Timestamp: time.Now()})
+			}
+			for i := 0; i < 3; i++ {
+				tracker.storeAndDispatch(&TrackingData{Token: "normal", Timestamp: time.Now()})
+				tracker.storeAndDispatch(&TrackingData{Timestamp: time.Now()})
+			}
+
+			counts := map[string]int{}
+			flagged := map[string]int{}
+			for _, event := range tracker.GetTrackingData() {
+				counts[event.Token]++
+				if event.OverCap {
+					flagged[event.Token]++
+				}
+			}
+			expectedLooping := 3
+			if tt.keepOverCap {
+				expectedLooping = 10
+			}
+			if counts["looping"] != expectedLooping {
+				t.Errorf("Expected %d events from the looping visitor, got %d", expectedLooping, counts["looping"])
+			}
+			if tt.keepOverCap && flagged["looping"] != 7 {
+				t.Errorf("Expected 7 flagged events, got %d", flagged["looping"])
+			}
+			if counts["normal"] != 3 || flagged["normal"] != 0 {
+				t.Errorf("Expected the other visitor unaffected, got %d events, %d flagged", counts["normal"], flagged["normal"])
+			}
+			if counts[""] != 3 {
+				t.Errorf("Expected tokenless events uncapped, got %d", counts[""])
+			}
+			if capped := tracker.CappedEvents(); capped != 7 {
+				t.Errorf("Expected 7 capped events, got %d", capped)
+			}
+		})
+	}
+}
+
+func TestVisitorCapWindowResets(t *testing.T) {
+	counter := newVisitorCapCounter(1, time.Minute, 0)
+	now := time.Now()
+	if counter.over("a", now) {
+		t.Error("Expected the first event within the cap")
+	}
+	if !counter.over("a", now.Add(30*time.Second)) {
+		t.Error("Expected the second event in the window over the cap")
+	}
+	if counter.over("a", now.Add(time.Minute)) {
+		t.Error("Expected a new window once the old one elapsed")
+	}
+}